@@ -30,15 +30,50 @@ func NewRootCommand(serv service.IService) *RootCommand {
 			Short: "Bring Game's save data to cloud",
 			Long: `Synchronize game save data to cloud (git) by
 					specifying game name as folder in git
-					repository`,
+					repository. Config of every game is kept in
+					$XDG_CONFIG_HOME/gamesave/config.json, the game is
+					selected by --game, then by .gamesave.json of the
+					current directory, then by the active game.
+					Game save repository is kept in --root, then in
+					GAMESAVE_HOME, then in root of the global config,
+					then in ~/.gamesave, backups are kept next to it`,
+			PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+				root, err := cmd.Flags().GetString("root")
+				if err != nil {
+					return err
+				}
+				if err = rootService.InitRoot(root); err != nil {
+					return err
+				}
+				gameName, err := cmd.Flags().GetString("game")
+				if err != nil || gameName == "" {
+					return err
+				}
+				return rootService.SelectGame(gameName)
+			},
 		},
 	}
+	root.rootCmd.PersistentFlags().StringP("game", "g", "", "name of added game used instead of the selected one")
+	root.rootCmd.PersistentFlags().String("root", "", "directory of game save repository used instead of ~/.gamesave")
 	rootService = serv
 	root.rootCmd.AddCommand(addCommand)
+	root.rootCmd.AddCommand(catalogCommand)
+	root.rootCmd.AddCommand(configCommand)
+	root.rootCmd.AddCommand(diffCommand)
 	root.rootCmd.AddCommand(initCommand)
+	root.rootCmd.AddCommand(keyCommand)
 	root.rootCmd.AddCommand(loadCommand)
+	root.rootCmd.AddCommand(machinesCommand)
 	root.rootCmd.AddCommand(saveCommand)
+	root.rootCmd.AddCommand(setLimitCommand)
 	root.rootCmd.AddCommand(setPathCommand)
+	root.rootCmd.AddCommand(setStorageCommand)
+	root.rootCmd.AddCommand(setSymlinksCommand)
+	root.rootCmd.AddCommand(statusCommand)
+	root.rootCmd.AddCommand(syncCommand)
+	root.rootCmd.AddCommand(undoLoadCommand)
+	root.rootCmd.AddCommand(useCommand)
+	root.rootCmd.AddCommand(verifyCommand)
 	root.rootCmd.AddCommand(versionCommand)
 	return &root
 }
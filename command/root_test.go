@@ -18,4 +18,13 @@ func TestRoot(t *testing.T) {
 			t.Error("Should show help on empty command")
 		}
 	})
+
+	t.Run("pass root flag", func(t *testing.T) {
+		serv := newServiceMock()
+		root := NewRootCommand(serv)
+		testRoot(t, root, true, "root flag", "--root", "/media/sd/gamesave", "version")
+		if serv.root != "/media/sd/gamesave" {
+			t.Errorf("Got root '%s' expect '/media/sd/gamesave'", serv.root)
+		}
+	})
 }
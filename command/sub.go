@@ -1,16 +1,50 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+	"github.com/yusufRahmatullah/game_save/service"
 
 	"github.com/spf13/cobra"
 )
 
+func init() {
+	catalogCommand.AddCommand(catalogListCommand)
+	catalogCommand.AddCommand(catalogNameCommand)
+	configCommand.AddCommand(configGetCommand)
+	configCommand.AddCommand(configListCommand)
+	configCommand.AddCommand(configSetCommand)
+	configCommand.AddCommand(configUnsetCommand)
+	configCommand.PersistentFlags().Bool("global", false, "use defaults shared by every game")
+	configCommand.PersistentFlags().Bool("local", false, "use the nearest .gamesave.json of the current directory or its parents")
+	configCommand.Flags().Bool("show-origin", false, "list effective values along with where they come from")
+	configListCommand.Flags().Bool("json", false, "print config as JSON object")
+	diffCommand.Flags().String("rev", "", "git revision of snapshot to compare with, such as commit hash or ~1")
+	initCommand.Flags().BoolP("yes", "y", false, "set up cataloged games without confirmation")
+	keyCommand.AddCommand(keyInitCommand)
+	keyCommand.AddCommand(keyRotateCommand)
+	keyInitCommand.Flags().StringP("key-file", "k", "", "derive key from key file, generated if it is not exist")
+	keyInitCommand.Flags().Bool("names", false, "encrypt file names too")
+	keyRotateCommand.Flags().StringP("key-file", "k", "", "derive new key from key file, generated if it is not exist")
+	loadCommand.Flags().String("decrypt-to", "", "write plain copy of game save into directory instead of save folder")
+	loadCommand.Flags().Bool("dry-run", false, "list files which would be copied and deleted without changing anything")
+	loadCommand.Flags().BoolP("yes", "y", false, "overwrite existing files without confirmation")
+	saveCommand.Flags().Bool("dry-run", false, "list files which would be copied, deleted and committed without changing anything")
+	setPathCommand.Flags().StringP("name", "n", "", "name of additional save location")
+	statusCommand.Flags().Bool("json", false, "print status as JSON array")
+}
+
 var addCommand = &cobra.Command{
 	Use:   "add <game name>",
 	Short: "Add game name",
-	Long:  "Specify a unique name of the current game",
-	Args:  cobra.ExactArgs(1),
+	Long: `Specify a unique name of the current game and
+			make it the active game. .gamesave.json of the
+			current directory is pointed to it if it exists`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		gameName := args[0]
 		err := rootService.AddConfig("game_name", gameName)
@@ -26,49 +60,584 @@ var addCommand = &cobra.Command{
 	},
 }
 
+var catalogCommand = &cobra.Command{
+	Use:   "catalog <command>",
+	Short: "Manage game catalog",
+	Long: `Manage catalog of games committed to Git repository.
+			Save paths and patterns of a game are recorded and
+			pushed on save, catalogs changed by several machines
+			are merged, so init can set up the games on another
+			machine`,
+}
+
+var catalogListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List cataloged games",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		catalog, err := rootService.ListCatalog()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(catalog.Games))
+		for name := range catalog.Games {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out := cmd.OutOrStdout()
+		for _, name := range names {
+			game := catalog.Games[name]
+			if game.DisplayName == "" {
+				fmt.Fprintln(out, name)
+			} else {
+				fmt.Fprintf(out, "%s (%s)\n", name, game.DisplayName)
+			}
+		}
+		return nil
+	},
+}
+
+var catalogNameCommand = &cobra.Command{
+	Use:   "name <display name>",
+	Short: "Set display name of the game",
+	Long: `Set display name of the game and record it into
+			the catalog along with its save paths and patterns`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rootService.SetDisplayName(args[0])
+	},
+}
+
+var configCommand = &cobra.Command{
+	Use:   "config [--global|--game <game name>|--local|--show-origin] <command>",
+	Short: "Manage configuration",
+	Long: `Get, set, unset or list config keys such as save_path,
+			save_path.<location>, save_path@<machine>, include,
+			exclude, storage, symlinks, key_file, the limits and
+			the hooks pre_save, post_save, pre_load, post_load and
+			on_conflict. --global uses defaults shared by every
+			game, --game uses config of the game and --local uses
+			the nearest .gamesave.json of the current directory or
+			its parents, .gamesave.yaml and .gamesave.toml are read
+			and written in their own format keeping comments.
+			Without them get and list show the effective values and
+			set changes the game. Effective values are merged from
+			--global, GAMESAVE_<KEY> environment variables, --game
+			then --local, --show-origin tells where each of them
+			comes from`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showOrigin, err := cmd.Flags().GetBool("show-origin")
+		if err != nil || !showOrigin {
+			return cmd.Help()
+		}
+		scope, err := configScope(cmd)
+		if err != nil {
+			return err
+		}
+		if scope != repository.ScopeEffective {
+			return fmt.Errorf("--show-origin lists effective config, use it without --global, --game and --local")
+		}
+		configs, err := rootService.ListConfigOrigins()
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(configs))
+		for key := range configs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := cmd.OutOrStdout()
+		for _, key := range keys {
+			fmt.Fprintf(out, "%s\t%s=%s\n", configs[key].Origin, key, configs[key].Value)
+		}
+		return nil
+	},
+}
+
+var configGetCommand = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show config value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := configScope(cmd)
+		if err != nil {
+			return err
+		}
+		value, err := rootService.GetConfig(scope, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), value)
+		return nil
+	},
+}
+
+var configListCommand = &cobra.Command{
+	Use:   "list [--json]",
+	Short: "List config values",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := configScope(cmd)
+		if err != nil {
+			return err
+		}
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+		config, err := rootService.ListConfig(scope)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if asJSON {
+			data, err := json.MarshalIndent(config, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, string(data))
+			return nil
+		}
+		keys := make([]string, 0, len(config))
+		for key := range config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(out, "%s=%s\n", key, config[key])
+		}
+		return nil
+	},
+}
+
+var configSetCommand = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set config value",
+	Long: `Set config value after it is validated. include and
+			exclude take comma separated patterns relative to save
+			folder. Hooks are shell commands run with
+			GAMESAVE_HOOK, GAMESAVE_GAME, GAMESAVE_HOME,
+			GAMESAVE_MACHINE, GAMESAVE_SAVE_PATHS and GAMESAVE_COMMIT
+			set, failure of pre_save, pre_load or on_conflict aborts
+			the save, load or sync`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := configScope(cmd)
+		if err != nil {
+			return err
+		}
+		return rootService.SetConfig(scope, args[0], args[1])
+	},
+}
+
+var configUnsetCommand = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove config value",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := configScope(cmd)
+		if err != nil {
+			return err
+		}
+		return rootService.SetConfig(scope, args[0], "")
+	},
+}
+
+var diffCommand = &cobra.Command{
+	Use:   "diff [--rev <revision>]",
+	Short: "Show difference between save folder and snapshot",
+	Long: `List files added, removed and modified in save folder
+			since the latest snapshot, or since the snapshot at
+			--rev, along with size change. Content diff is shown
+			for text save such as JSON, INI and XML. Revision
+			starting with ~ or ^ is relative to the latest snapshot`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rev, err := cmd.Flags().GetString("rev")
+		if err != nil {
+			return err
+		}
+		diffs, err := rootService.Diff(rev)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if len(diffs) == 0 {
+			fmt.Fprintln(out, "Save folder matches the snapshot")
+		}
+		for _, diff := range diffs {
+			fmt.Fprintf(out, "%s %s (%s)\n", diff.Change, diff.Path, diff.SizeDelta())
+			fmt.Fprint(out, diff.Patch)
+		}
+		return nil
+	},
+}
+
 var initCommand = &cobra.Command{
-	Use:   "init <git repo URL>",
+	Use:   "init [--yes] <git repo URL>",
 	Short: "Initialize GameSave in this machine",
 	Long: `Initialize GameSave in this machine by clone
 			given Git Repository URL. Ensure the repository
-			is exist`,
+			is exist. Games in its catalog which have not been
+			added are set up after confirmation`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		repoURL := args[0]
-		return rootService.InitGitRepo(repoURL)
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+		err = rootService.InitGitRepo(repoURL)
+		if err != nil {
+			return err
+		}
+		names, err := rootService.SetupCatalog(yes)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintf(cmd.OutOrStdout(), "Game %s is set up\n", name)
+		}
+		return nil
+	},
+}
+
+var keyCommand = &cobra.Command{
+	Use:   "key",
+	Short: "Manage encryption key",
+	Long: `Manage key encrypting game save before it is
+			committed. Passphrase is read from GAMESAVE_PASSPHRASE
+			or asked on terminal, new passphrase on rotation is read
+			from GAMESAVE_NEW_PASSPHRASE`,
+}
+
+var keyInitCommand = &cobra.Command{
+	Use:   "init [--key-file <path>] [--names]",
+	Short: "Encrypt game save",
+	Long: `Encrypt game save by key derived from passphrase
+			or key file and commit it. Saved data is re-encrypted,
+			but its plain copies stay in Git history. With --names
+			file names longer than 163 bytes can not be saved`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyFile, err := cmd.Flags().GetString("key-file")
+		if err != nil {
+			return err
+		}
+		names, err := cmd.Flags().GetBool("names")
+		if err != nil {
+			return err
+		}
+		if err := rootService.PrepareGame(); err != nil {
+			return err
+		}
+		return rootService.InitKey(keyFile, names)
+	},
+}
+
+var keyRotateCommand = &cobra.Command{
+	Use:   "rotate [--key-file <path>]",
+	Short: "Change encryption key",
+	Long: `Re-encrypt game save by new key derived from
+			new passphrase or from key file and commit it`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyFile, err := cmd.Flags().GetString("key-file")
+		if err != nil {
+			return err
+		}
+		if err := rootService.PrepareGame(); err != nil {
+			return err
+		}
+		return rootService.RotateKey(keyFile)
 	},
 }
 
 var loadCommand = &cobra.Command{
-	Use:   "load",
+	Use:   "load [--yes] [--decrypt-to <dir>] [--dry-run]",
 	Short: "Load game",
-	Long:  `Load game by synchronize save from the cloud`,
-	Args:  cobra.NoArgs,
+	Long: `Load game by synchronize save from the cloud.
+			Confirmation is asked before many existing files
+			are overwritten unless --yes is given. Use --decrypt-to
+			to recover plain copy of game save into a directory
+			without touching save folder. Use --dry-run to list
+			files which would be copied and deleted without
+			changing anything, remote commits not fetched yet
+			are reported instead of planned`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := cmd.Flags().GetString("decrypt-to")
+		if err != nil {
+			return err
+		}
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			if dir != "" {
+				return fmt.Errorf("Use only one of --decrypt-to and --dry-run")
+			}
+			plan, err := rootService.PlanLoad()
+			if err != nil {
+				return err
+			}
+			printPlan(cmd.OutOrStdout(), plan)
+			return nil
+		}
 		if err := rootService.PrepareGame(); err != nil {
 			return err
 		}
-		return rootService.LoadGame()
+		if dir != "" {
+			return rootService.DecryptTo(dir)
+		}
+		return rootService.LoadGame(service.LoadOptions{AssumeYes: yes})
+	},
+}
+
+var machinesCommand = &cobra.Command{
+	Use:   "machines",
+	Short: "List machines of the game",
+	Long: `List machines mapping save paths of the game in its
+			config or in the catalog along with the mapped paths.
+			Save path is mapped by config key such as
+			save_path@<machine> or save_path.<location>@<machine>,
+			machine is GAMESAVE_MACHINE or the host name`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		machines, err := rootService.ListMachines()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, machine := range machines {
+			if machine.Current {
+				fmt.Fprintf(out, "%s (this machine)\n", machine.Name)
+			} else {
+				fmt.Fprintln(out, machine.Name)
+			}
+			if len(machine.SavePaths) == 0 {
+				fmt.Fprintln(out, "  uses default save paths")
+			}
+			keys := make([]string, 0, len(machine.SavePaths))
+			for key := range machine.SavePaths {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(out, "  %s=%s\n", key, machine.SavePaths[key])
+			}
+		}
+		return nil
 	},
 }
 
 var saveCommand = &cobra.Command{
-	Use:   "save",
+	Use:   "save [--dry-run]",
 	Short: "Save game",
-	Long:  "Save game by synchronize save to the cloud",
-	Args:  cobra.NoArgs,
+	Long: `Save game by synchronize save to the cloud. Use
+			--dry-run to list files which would be copied,
+			deleted and committed without changing anything`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			plan, err := rootService.PlanSave()
+			if err != nil {
+				return err
+			}
+			printPlan(cmd.OutOrStdout(), plan)
+			return nil
+		}
 		return rootService.SaveGame()
 	},
 }
 
+var setLimitCommand = &cobra.Command{
+	Use:   "set-limit <max_size|max_files|growth_warning> <value>",
+	Short: "Set game save limit",
+	Long: `Set limit of the game checked on save: max_size such
+			as 200MB or 1GiB, max_files as number of files and
+			growth_warning as percentage of growth since previous
+			save. 0 disables the limit and empty value unsets it,
+			so GAMESAVE_MAX_SIZE, GAMESAVE_MAX_FILES or
+			GAMESAVE_GROWTH_WARNING environment variable is used,
+			then the limit of global config, then the default one`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "max_size", "max_files", "growth_warning":
+			return rootService.AddConfig(args[0], args[1])
+		}
+		return fmt.Errorf("Unknown limit %s, use max_size, max_files or growth_warning", args[0])
+	},
+}
+
 var setPathCommand = &cobra.Command{
-	Use:   "set-path <game save path>",
+	Use:   "set-path [--name <location>] <game save path>",
 	Short: "Set game save path",
-	Args:  cobra.ExactArgs(1),
+	Long: `Set game save path. Use --name to set additional
+			save location of the game, such as profile or
+			memory card folder, empty path removes it.
+			Path should exist and should not be a system,
+			home or gamesave directory.
+			Path may start with ~ and contain <home>, <xdgData>,
+			<xdgConfig>, <winePrefix> or $ENV_VAR, which are
+			expanded on every machine when the path is used.
+			Relative path is stored as absolute path`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		savePath := args[0]
-		return rootService.AddConfig("save_path", savePath)
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return err
+		}
+		return rootService.SetSavePath(name, savePath)
+	},
+}
+
+var setStorageCommand = &cobra.Command{
+	Use:   "set-storage <files|archive>",
+	Short: "Set how game save is stored",
+	Long: `Set how game save is stored in Git repository:
+			files stores every file as is and archive packs
+			each save location into one compressed archive`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rootService.AddConfig("storage", args[0])
+	},
+}
+
+var setSymlinksCommand = &cobra.Command{
+	Use:   "set-symlinks <follow|preserve|skip>",
+	Short: "Set symbolic link handling",
+	Long: `Set how symbolic links inside game save folder
+			are copied: follow copies what the link points to,
+			preserve copies the link itself and skip ignores it.
+			Links pointing outside save folder are refused`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rootService.AddConfig("symlinks", args[0])
+	},
+}
+
+var statusCommand = &cobra.Command{
+	Use:   "status [game name] [--json]",
+	Short: "Show status of game saves",
+	Long: `Show whether save folder differs from the last snapshot
+			and whether remote branch is ahead, behind or diverged,
+			along with time and machine of the last save. Every
+			added game is shown unless a game is given`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gameName, err := cmd.Flags().GetString("game")
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 {
+			gameName = args[0]
+		}
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+		statuses, err := rootService.Status(gameName)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if asJSON {
+			data, err := json.MarshalIndent(statuses, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, string(data))
+			return nil
+		}
+		for _, status := range statuses {
+			printStatus(out, status)
+		}
+		return nil
+	},
+}
+
+var syncCommand = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync game",
+	Long: `Save or load game, whichever of save folder and the
+			latest snapshot changed since the last sync on this
+			machine. Save folder is saved if the game has not been
+			synced on this machine and the folder is modified after
+			the latest snapshot, otherwise it is loaded. Confirmation
+			is asked if both changed and sync fails if it can not be
+			asked`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := rootService.PrepareGame(); err != nil {
+			return err
+		}
+		action, err := rootService.Sync()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Game save is %s\n", action)
+		return nil
+	},
+}
+
+var undoLoadCommand = &cobra.Command{
+	Use:   "undo-load",
+	Short: "Undo last load",
+	Long:  "Restore save data that was backed up before the last load",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rootService.UndoLoad()
+	},
+}
+
+var useCommand = &cobra.Command{
+	Use:   "use <game name>",
+	Short: "Switch active game",
+	Long: `Make added game the active game, which is used
+			wherever .gamesave.json and --game do not select one`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return rootService.UseGame(args[0])
+	},
+}
+
+var verifyCommand = &cobra.Command{
+	Use:   "verify [game name]",
+	Short: "Verify game save",
+	Long: `Verify committed game save and save folder against
+			checksum manifest recorded on save`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gameName := ""
+		if len(args) > 0 {
+			gameName = args[0]
+		}
+		report, err := rootService.Verify(gameName)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		printProblems(out, "Repository", report.Repo)
+		if report.SaveChecked {
+			printProblems(out, "Save folder", report.Save)
+		}
+		if !report.OK() {
+			return service.ErrVerifyFailed
+		}
+		return nil
 	},
 }
 
@@ -82,3 +651,94 @@ var versionCommand = &cobra.Command{
 		fmt.Println("")
 	},
 }
+
+// configScope returns scope selected by --global, --game or --local,
+// ScopeEffective if none of them is given
+func configScope(cmd *cobra.Command) (repository.ConfigScope, error) {
+	global, err := cmd.Flags().GetBool("global")
+	if err != nil {
+		return "", err
+	}
+	local, err := cmd.Flags().GetBool("local")
+	if err != nil {
+		return "", err
+	}
+	gameName, err := cmd.Flags().GetString("game")
+	if err != nil {
+		return "", err
+	}
+	game := gameName != ""
+	switch {
+	case global && (local || game), local && game:
+		return "", fmt.Errorf("Use only one of --global, --game and --local")
+	case global:
+		return repository.ScopeGlobal, nil
+	case local:
+		return repository.ScopeLocal, nil
+	case game:
+		return repository.ScopeGame, nil
+	}
+	return repository.ScopeEffective, nil
+}
+
+func printPlan(out io.Writer, plan service.Plan) {
+	printPaths(out, "Would copy", plan.Copied)
+	printPaths(out, "Would delete", plan.Deleted)
+	printPaths(out, "Would commit", plan.Committed)
+	if plan.Empty() {
+		fmt.Fprintln(out, "Nothing would change")
+	}
+	fmt.Fprintf(out, "Remote: %s\n", remoteSummary(plan.Remote, plan.Ahead, plan.Behind, plan.RemoteError))
+}
+
+func printPaths(out io.Writer, title string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "%s:\n", title)
+	for _, p := range paths {
+		fmt.Fprintf(out, "  %s\n", p)
+	}
+}
+
+func remoteSummary(remote string, ahead, behind int, remoteError string) string {
+	switch remote {
+	case service.RemoteAhead, service.RemoteBehind, service.RemoteDiverged:
+		return fmt.Sprintf("%s, %d ahead and %d behind", remote, ahead, behind)
+	case service.RemoteUnknown:
+		return fmt.Sprintf("%s, %s", remote, remoteError)
+	}
+	return remote
+}
+
+func printStatus(out io.Writer, status service.GameStatus) {
+	if status.CheckedOut {
+		fmt.Fprintf(out, "%s (checked out)\n", status.Game)
+	} else {
+		fmt.Fprintln(out, status.Game)
+	}
+	if status.Save == service.SaveModified {
+		fmt.Fprintf(out, "  Save: %s, %d files differ from the last snapshot\n", status.Save, status.ChangedFiles)
+	} else {
+		fmt.Fprintf(out, "  Save: %s\n", status.Save)
+	}
+	fmt.Fprintf(out, "  Remote: %s\n", remoteSummary(status.Remote, status.Ahead, status.Behind, status.RemoteError))
+	if status.SavedAt != nil {
+		savedOn := ""
+		if status.SavedOn != "" {
+			savedOn = " on " + status.SavedOn
+		}
+		fmt.Fprintf(out, "  Last save: %s%s\n", status.SavedAt.Local().Format("2006-01-02 15:04"), savedOn)
+	}
+}
+
+func printProblems(out io.Writer, title string, problems []service.FileProblem) {
+	if len(problems) == 0 {
+		fmt.Fprintf(out, "%s: OK\n", title)
+		return
+	}
+	fmt.Fprintf(out, "%s: %d problem(s)\n", title, len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  %s: %s\n", problem.Path, problem.Problem)
+	}
+}
@@ -1,16 +1,31 @@
 package command
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+	"github.com/yusufRahmatullah/game_save/service"
+)
 
 var (
+	errBackupNotExist   = errors.New("Backup is not exist, call load first")
+	errConfigNotSet     = errors.New("Config key has not been set")
 	errGameNotExist     = errors.New("Game is not exist, call add first")
 	errGitInitialized   = errors.New("Git repo has been initialized")
 	errGitUninitialized = errors.New("Git repo uninitialized, call init first")
+	errKeyExists        = errors.New("Game save is already encrypted")
+	errKeyNotExist      = errors.New("Game save is not encrypted")
 	errSavePathNotExist = errors.New("Game save path is not exist, call set-path first")
 )
 
 type serviceMock struct {
+	catalog      repository.Catalog
+	root         string
+	config       map[string]string
+	configScope  repository.ConfigScope
+	encrypted    bool
 	gameAdded    bool
+	gameLoaded   bool
 	gamePrepared bool
 	gitRepo      bool
 	savePrepared bool
@@ -18,7 +33,10 @@ type serviceMock struct {
 
 func newServiceMock() *serviceMock {
 	return &serviceMock{
+		catalog:      repository.NewCatalog(),
+		config:       map[string]string{},
 		gameAdded:    false,
+		gameLoaded:   false,
 		gamePrepared: false,
 		gitRepo:      false,
 		savePrepared: false,
@@ -37,6 +55,38 @@ func (s *serviceMock) AddConfig(key, value string) error {
 	return nil
 }
 
+func (s *serviceMock) DecryptTo(dir string) error {
+	if !s.gamePrepared {
+		return errGameNotExist
+	}
+	return nil
+}
+
+func (s *serviceMock) Diff(rev string) ([]service.FileDiff, error) {
+	if !s.gamePrepared {
+		return nil, errGameNotExist
+	}
+	if rev == "missing" {
+		return nil, service.ErrRevisionNotExist
+	}
+	return []service.FileDiff{{
+		Path:    "save/settings.ini",
+		Change:  service.DiffModified,
+		OldSize: 8,
+		NewSize: 10,
+		Patch:   "@@ -1 +1 @@\n-a=1\n+a=10\n",
+	}}, nil
+}
+
+func (s *serviceMock) GetConfig(scope repository.ConfigScope, key string) (string, error) {
+	s.configScope = scope
+	value, ok := s.config[key]
+	if !ok {
+		return "", errConfigNotSet
+	}
+	return value, nil
+}
+
 func (s *serviceMock) InitGitRepo(repoURL string) error {
 	if s.gitRepo {
 		return errGitInitialized
@@ -45,15 +95,78 @@ func (s *serviceMock) InitGitRepo(repoURL string) error {
 	return nil
 }
 
-func (s *serviceMock) LoadGame() error {
+func (s *serviceMock) InitRoot(root string) error {
+	s.root = root
+	return nil
+}
+
+func (s *serviceMock) InitKey(keyFile string, names bool) error {
+	if !s.gamePrepared {
+		return errGameNotExist
+	} else if s.encrypted {
+		return errKeyExists
+	}
+	s.encrypted = true
+	return nil
+}
+
+func (s *serviceMock) ListCatalog() (repository.Catalog, error) {
+	return s.catalog, nil
+}
+
+func (s *serviceMock) ListConfig(scope repository.ConfigScope) (map[string]string, error) {
+	s.configScope = scope
+	return s.config, nil
+}
+
+func (s *serviceMock) ListConfigOrigins() (map[string]repository.ConfigValue, error) {
+	configs := map[string]repository.ConfigValue{}
+	for key, value := range s.config {
+		configs[key] = repository.ConfigValue{Value: value, Origin: "local /work/.gamesave.json"}
+	}
+	return configs, nil
+}
+
+func (s *serviceMock) ListMachines() ([]service.Machine, error) {
+	if !s.gameAdded {
+		return nil, errGameNotExist
+	}
+	return []service.Machine{{Name: "desktop", Current: true}}, nil
+}
+
+func (s *serviceMock) LoadGame(options service.LoadOptions) error {
 	if !s.gamePrepared {
 		return errGameNotExist
 	} else if !s.savePrepared {
 		return errSavePathNotExist
 	}
+	s.gameLoaded = true
 	return nil
 }
 
+func (s *serviceMock) PlanLoad() (service.Plan, error) {
+	if !s.gameAdded {
+		return service.Plan{}, errGameNotExist
+	} else if !s.savePrepared {
+		return service.Plan{}, errSavePathNotExist
+	}
+	return service.Plan{
+		Game:   "game1",
+		Copied: []string{"/home/save/slot1"},
+		Remote: service.RemoteBehind,
+		Behind: 1,
+	}, nil
+}
+
+func (s *serviceMock) PlanSave() (service.Plan, error) {
+	if !s.gameAdded {
+		return service.Plan{}, errGameNotExist
+	} else if !s.savePrepared {
+		return service.Plan{}, errSavePathNotExist
+	}
+	return service.Plan{Game: "game1", Remote: service.RemoteUpToDate}, nil
+}
+
 func (s *serviceMock) PrepareGame() error {
 	if !s.gameAdded {
 		return errGameNotExist
@@ -65,6 +178,15 @@ func (s *serviceMock) PrepareGame() error {
 	return nil
 }
 
+func (s *serviceMock) RotateKey(keyFile string) error {
+	if !s.gamePrepared {
+		return errGameNotExist
+	} else if !s.encrypted {
+		return errKeyNotExist
+	}
+	return nil
+}
+
 func (s *serviceMock) SaveGame() error {
 	if !s.gamePrepared {
 		return errGameNotExist
@@ -73,3 +195,90 @@ func (s *serviceMock) SaveGame() error {
 	}
 	return nil
 }
+
+func (s *serviceMock) SelectGame(name string) error {
+	if !s.gameAdded {
+		return errGameNotExist
+	}
+	return nil
+}
+
+func (s *serviceMock) SetConfig(scope repository.ConfigScope, key, value string) error {
+	s.configScope = scope
+	if value == "" {
+		delete(s.config, key)
+	} else {
+		s.config[key] = value
+	}
+	return nil
+}
+
+func (s *serviceMock) SetDisplayName(displayName string) error {
+	if !s.gameAdded {
+		return errGameNotExist
+	}
+	s.catalog.Games["game1"] = repository.CatalogGame{DisplayName: displayName}
+	return nil
+}
+
+func (s *serviceMock) SetupCatalog(assumeYes bool) ([]string, error) {
+	if !s.gitRepo {
+		return nil, errGitUninitialized
+	}
+	return []string{}, nil
+}
+
+func (s *serviceMock) SetSavePath(name, savePath string) error {
+	return s.AddConfig("save_path", savePath)
+}
+
+func (s *serviceMock) Status(gameName string) ([]service.GameStatus, error) {
+	if gameName == "" {
+		if !s.gameAdded {
+			return nil, errGameNotExist
+		}
+		gameName = "game1"
+	}
+	return []service.GameStatus{{
+		Game:       gameName,
+		CheckedOut: true,
+		Save:       service.SaveModified,
+		Remote:     service.RemoteBehind,
+		Behind:     1,
+	}}, nil
+}
+
+func (s *serviceMock) Sync() (string, error) {
+	if !s.gamePrepared {
+		return "", errGameNotExist
+	} else if !s.savePrepared {
+		return "", errSavePathNotExist
+	}
+	return service.SyncSaved, nil
+}
+
+func (s *serviceMock) UndoLoad() error {
+	if !s.gameLoaded {
+		return errBackupNotExist
+	}
+	s.gameLoaded = false
+	return nil
+}
+
+func (s *serviceMock) UseGame(name string) error {
+	if !s.gameAdded {
+		return errGameNotExist
+	}
+	return nil
+}
+
+func (s *serviceMock) Verify(gameName string) (service.VerifyReport, error) {
+	report := service.VerifyReport{Game: gameName}
+	if gameName == "" && !s.gameAdded {
+		return report, errGameNotExist
+	}
+	if gameName == "corrupted" {
+		report.Repo = []service.FileProblem{{Path: "save", Problem: service.ProblemModified}}
+	}
+	return report, nil
+}
@@ -2,7 +2,11 @@ package command
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+	"github.com/yusufRahmatullah/game_save/service"
 )
 
 const (
@@ -29,6 +33,133 @@ func TestAdd(t *testing.T) {
 	})
 }
 
+func TestCatalog(t *testing.T) {
+	t.Run("set display name and list catalog", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		root := NewRootCommand(serv)
+		testRoot(t, root, true, testOneArg, "catalog", "name", "The Game")
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"catalog", "list"}, &buffer)
+		if err != nil || buffer.String() != "game1 (The Game)\n" {
+			t.Errorf("Got '%s' and %v expect 'game1 (The Game)'", buffer.String(), err)
+		}
+	})
+
+	t.Run("parse arguments", func(t *testing.T) {
+		testCallInit(t, false, testNoArg, "catalog", "name")
+		testCallInit(t, false, testOneArg, "catalog", "list", "game1")
+	})
+
+	t.Run("show error if game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "catalog", "name", "The Game")
+	})
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("set, get and unset config", func(t *testing.T) {
+		serv := newServiceMock()
+		root := NewRootCommand(serv)
+		testRoot(t, root, true, "set", "config", "set", "max_files", "5")
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"config", "get", "max_files"}, &buffer)
+		if err != nil || buffer.String() != "5\n" {
+			t.Errorf("Got '%s' and %v expect '5'", buffer.String(), err)
+		}
+		testRoot(t, root, true, "unset", "config", "unset", "max_files")
+		testRoot(t, root, false, "unset key", "config", "get", "max_files")
+	})
+
+	t.Run("select scope by flag", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.gameAdded = true
+		root := NewRootCommand(serv)
+		scopes := map[repository.ConfigScope][]string{
+			repository.ScopeGlobal: {"config", "set", "--global", "storage", "archive"},
+			repository.ScopeGame:   {"--game", "game1", "config", "set", "storage", "archive"},
+			repository.ScopeLocal:  {"config", "set", "--local", "storage", "archive"},
+		}
+		for scope, args := range scopes {
+			testRoot(t, NewRootCommand(serv), true, string(scope), args...)
+			if serv.configScope != scope {
+				t.Errorf("Got scope '%s' expect '%s'", serv.configScope, scope)
+			}
+			resetConfigFlags()
+		}
+		testRoot(t, root, false, "conflicting flags", "config", "list", "--global", "--local")
+		resetConfigFlags()
+	})
+
+	t.Run("list config as JSON", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.config["storage"] = "archive"
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"config", "list", "--json"}, &buffer)
+		config := map[string]string{}
+		if err == nil {
+			err = json.Unmarshal(buffer.Bytes(), &config)
+		}
+		if err != nil || config["storage"] != "archive" {
+			t.Errorf("Got '%s' and %v expect storage archive", buffer.String(), err)
+		}
+		configListCommand.Flags().Set("json", "false")
+	})
+
+	t.Run("show origin of effective config", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.config["storage"] = "archive"
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"config", "--show-origin"}, &buffer)
+		want := "local /work/.gamesave.json\tstorage=archive\n"
+		if err != nil || buffer.String() != want {
+			t.Errorf("Got '%s' and %v expect '%s'", buffer.String(), err, want)
+		}
+		testRoot(t, root, false, "scoped origin", "config", "--show-origin", "--global")
+		resetConfigFlags()
+	})
+
+	t.Run("parse arguments", func(t *testing.T) {
+		testNotCallInit(t, false, "config", "set", "max_files")
+		testNotCallInit(t, false, "config", "get")
+	})
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("parse no argument", func(t *testing.T) {
+		testCallPrepared(t, true, true, testNoArg, "diff")
+	})
+
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallPrepared(t, false, true, testOneArg, "diff", "rev")
+	})
+
+	t.Run("print changed files and content diff", func(t *testing.T) {
+		defer diffCommand.Flags().Set("rev", "")
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		serv.PrepareGame()
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"diff", "--rev", "~1"}, &buffer)
+		want := "modified save/settings.ini (+2 B)\n@@ -1 +1 @@\n-a=1\n+a=10\n"
+		if got := buffer.String(); err != nil || got != want {
+			t.Errorf("Shouldn't show error. Error: %v, got: '%s', want: '%s'", err, got, want)
+		}
+		err = root.Parse([]string{"diff", "--rev", "missing"}, &buffer)
+		if err != service.ErrRevisionNotExist {
+			t.Errorf("Got %v expect %v", err, service.ErrRevisionNotExist)
+		}
+	})
+
+	t.Run("show error if game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "diff")
+	})
+}
+
 func TestInit(t *testing.T) {
 	t.Run("parse one argument", func(t *testing.T) {
 		testNotCallInit(t, true, "init", "http://test.com/test.git")
@@ -41,6 +172,10 @@ func TestInit(t *testing.T) {
 	t.Run("show help on empty argument", func(t *testing.T) {
 		testNotCallInit(t, false, "init")
 	})
+
+	t.Run("parse yes flag", func(t *testing.T) {
+		testNotCallInit(t, true, "init", "--yes", "http://test.com/test.git")
+	})
 }
 
 func TestLoad(t *testing.T) {
@@ -57,6 +192,89 @@ func TestLoad(t *testing.T) {
 		testNotCallInit(t, false, "load")
 		testCallInit(t, false, "not call set-path", "load")
 	})
+
+	t.Run("parse yes flag", func(t *testing.T) {
+		testCallPrepared(t, true, true, "yes flag", "load", "--yes")
+	})
+
+	t.Run("parse decrypt-to flag without set-path", func(t *testing.T) {
+		testCallPrepared(t, true, false, "decrypt-to flag", "load", "--decrypt-to", "recovered")
+	})
+
+	t.Run("print plan without loading on dry-run flag", func(t *testing.T) {
+		defer loadCommand.Flags().Set("dry-run", "false")
+		loadCommand.Flags().Set("decrypt-to", "")
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		serv.AddConfig("save_path", "./dummy/path")
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"load", "--dry-run"}, &buffer)
+		want := "Would copy:\n  /home/save/slot1\nRemote: behind, 0 ahead and 1 behind\n"
+		if got := buffer.String(); err != nil || got != want {
+			t.Errorf("Shouldn't show error. Error: %v, got: '%s', want: '%s'", err, got, want)
+		}
+		if serv.gamePrepared || serv.gameLoaded {
+			t.Error("Should not prepare nor load game on dry run")
+		}
+		err = root.Parse([]string{"load", "--dry-run", "--decrypt-to", "recovered"}, &buffer)
+		loadCommand.Flags().Set("decrypt-to", "")
+		if err == nil {
+			t.Error("Should show error on both dry-run and decrypt-to flags")
+		}
+	})
+}
+
+func TestKey(t *testing.T) {
+	t.Run("parse init with flags", func(t *testing.T) {
+		testCallPrepared(t, true, false, "flags", "key", "init", "--key-file", "game.key", "--names")
+	})
+
+	t.Run("parse init with arguments", func(t *testing.T) {
+		testCallPrepared(t, false, false, testOneArg, "key", "init", "secret")
+	})
+
+	t.Run("parse rotate after init", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		serv.PrepareGame()
+		serv.InitKey("", false)
+		root := NewRootCommand(serv)
+		testRoot(t, root, true, testNoArg, "key", "rotate")
+	})
+
+	t.Run("show error on rotate before init", func(t *testing.T) {
+		testCallPrepared(t, false, false, testNoArg, "key", "rotate")
+	})
+
+	t.Run("show error if not call init", func(t *testing.T) {
+		testNotCallInit(t, false, "key", "init")
+	})
+}
+
+func TestMachines(t *testing.T) {
+	t.Run("list machines", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"machines"}, &buffer)
+		want := "desktop (this machine)\n  uses default save paths\n"
+		if err != nil || buffer.String() != want {
+			t.Errorf("Got '%s' and %v expect '%s'", buffer.String(), err, want)
+		}
+	})
+
+	t.Run("parse arguments", func(t *testing.T) {
+		testCallPrepared(t, false, false, testOneArg, "machines", "desktop")
+	})
+
+	t.Run("show error if game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "machines")
+	})
 }
 
 func TestSave(t *testing.T) {
@@ -73,6 +291,30 @@ func TestSave(t *testing.T) {
 		testNotCallInit(t, false, "save")
 		testCallInit(t, false, "not call set-path", "save")
 	})
+
+	t.Run("parse game flag", func(t *testing.T) {
+		testCallPrepared(t, true, true, "game flag", "save", "--game", "game1")
+		testCallPrepared(t, true, true, "game flag", "save", "-g", "game1")
+	})
+
+	t.Run("show error if game flag names game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "save", "--game", "game1")
+	})
+
+	t.Run("print plan on dry-run flag", func(t *testing.T) {
+		defer saveCommand.Flags().Set("dry-run", "false")
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		serv.AddConfig("save_path", "./dummy/path")
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"save", "--dry-run"}, &buffer)
+		want := "Nothing would change\nRemote: up to date\n"
+		if got := buffer.String(); err != nil || got != want {
+			t.Errorf("Shouldn't show error. Error: %v, got: '%s', want: '%s'", err, got, want)
+		}
+	})
 }
 
 func TestSetPath(t *testing.T) {
@@ -80,6 +322,10 @@ func TestSetPath(t *testing.T) {
 		testCallPrepared(t, true, false, testOneArg, "set-path", "./game/save/path")
 	})
 
+	t.Run("parse named location", func(t *testing.T) {
+		testCallPrepared(t, true, false, testOneArg, "set-path", "--name", "memcard", "./game/memcard")
+	})
+
 	t.Run("parse more than one arguments", func(t *testing.T) {
 		testCallPrepared(t, false, false, testArgs, "set-path", "./game/save/path", "another args")
 	})
@@ -93,6 +339,169 @@ func TestSetPath(t *testing.T) {
 	})
 }
 
+func TestSetLimit(t *testing.T) {
+	t.Run("parse limit and value", func(t *testing.T) {
+		testCallPrepared(t, true, true, testArgs, "set-limit", "max_size", "200MB")
+	})
+
+	t.Run("parse empty value", func(t *testing.T) {
+		testCallPrepared(t, true, true, testArgs, "set-limit", "max_files", "")
+	})
+
+	t.Run("parse unknown limit", func(t *testing.T) {
+		testCallPrepared(t, false, true, testArgs, "set-limit", "max_depth", "5")
+	})
+
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallPrepared(t, false, true, testOneArg, "set-limit", "max_files")
+	})
+
+	t.Run("show error if not call init", func(t *testing.T) {
+		testNotCallInit(t, false, "set-limit", "max_files", "100")
+	})
+}
+
+func TestSetStorage(t *testing.T) {
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallPrepared(t, true, true, testOneArg, "set-storage", "archive")
+	})
+
+	t.Run("parse more than one arguments", func(t *testing.T) {
+		testCallPrepared(t, false, true, testArgs, "set-storage", "archive", "files")
+	})
+
+	t.Run("show error if not call init", func(t *testing.T) {
+		testNotCallInit(t, false, "set-storage", "archive")
+	})
+}
+
+func TestSetSymlinks(t *testing.T) {
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallPrepared(t, true, true, testOneArg, "set-symlinks", "follow")
+	})
+
+	t.Run("parse more than one arguments", func(t *testing.T) {
+		testCallPrepared(t, false, true, testArgs, "set-symlinks", "follow", "skip")
+	})
+
+	t.Run("show error if not call init", func(t *testing.T) {
+		testNotCallInit(t, false, "set-symlinks", "follow")
+	})
+}
+
+func TestStatus(t *testing.T) {
+	t.Run("parse no argument", func(t *testing.T) {
+		testCallPrepared(t, true, true, testNoArg, "status")
+	})
+
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallInit(t, true, testOneArg, "status", "game1")
+	})
+
+	t.Run("parse more than one arguments", func(t *testing.T) {
+		testCallInit(t, false, testArgs, "status", "game1", "game2")
+	})
+
+	t.Run("print status as text and JSON", func(t *testing.T) {
+		defer statusCommand.Flags().Set("json", "false")
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		serv.PrepareGame()
+		root := NewRootCommand(serv)
+		var buffer bytes.Buffer
+		err := root.Parse([]string{"status"}, &buffer)
+		want := "game1 (checked out)\n  Save: modified, 0 files differ from the last snapshot\n  Remote: behind, 0 ahead and 1 behind\n"
+		if got := buffer.String(); err != nil || got != want {
+			t.Errorf("Shouldn't show error. Error: %v, got: '%s', want: '%s'", err, got, want)
+		}
+
+		buffer.Reset()
+		err = root.Parse([]string{"status", "--json"}, &buffer)
+		var statuses []service.GameStatus
+		if err != nil || json.Unmarshal(buffer.Bytes(), &statuses) != nil || len(statuses) != 1 || statuses[0].Behind != 1 {
+			t.Errorf("Should print status as JSON. Error: %v, got: '%s'", err, buffer.String())
+		}
+	})
+
+	t.Run("show error if game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "status")
+	})
+}
+
+func TestSync(t *testing.T) {
+	t.Run("parse no argument", func(t *testing.T) {
+		testCallPrepared(t, true, true, testNoArg, "sync")
+	})
+
+	t.Run("parse arguments", func(t *testing.T) {
+		testCallPrepared(t, false, true, testOneArg, "sync", "arg1")
+	})
+
+	t.Run("show error if not call init and set-path", func(t *testing.T) {
+		testNotCallInit(t, false, "sync")
+		testCallInit(t, false, "not call set-path", "sync")
+	})
+}
+
+func TestUndoLoad(t *testing.T) {
+	t.Run("parse no argument after load", func(t *testing.T) {
+		serv := newServiceMock()
+		serv.InitGitRepo("")
+		serv.AddConfig("game_name", "game1")
+		serv.AddConfig("save_path", "./dummy/path")
+		serv.PrepareGame()
+		serv.LoadGame(service.LoadOptions{})
+		root := NewRootCommand(serv)
+		testRoot(t, root, true, testNoArg, "undo-load")
+	})
+
+	t.Run("parse arguments", func(t *testing.T) {
+		testCallPrepared(t, false, true, testOneArg, "undo-load", "arg1")
+	})
+
+	t.Run("show error if not call load", func(t *testing.T) {
+		testCallPrepared(t, false, true, testNoArg, "undo-load")
+	})
+}
+
+func TestUse(t *testing.T) {
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallPrepared(t, true, false, testOneArg, "use", "game1")
+	})
+
+	t.Run("parse arguments", func(t *testing.T) {
+		testCallPrepared(t, false, false, testNoArg, "use")
+		testCallPrepared(t, false, false, testArgs, "use", "game1", "game2")
+	})
+
+	t.Run("show error if game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "use", "game1")
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("parse no argument", func(t *testing.T) {
+		testCallPrepared(t, true, true, testNoArg, "verify")
+	})
+
+	t.Run("parse one argument", func(t *testing.T) {
+		testCallInit(t, true, testOneArg, "verify", "game1")
+	})
+
+	t.Run("parse more than one arguments", func(t *testing.T) {
+		testCallInit(t, false, testArgs, "verify", "game1", "game2")
+	})
+
+	t.Run("show error on problems", func(t *testing.T) {
+		testCallInit(t, false, "corrupted save", "verify", "corrupted")
+	})
+
+	t.Run("show error if game not added", func(t *testing.T) {
+		testCallInit(t, false, "not call add", "verify")
+	})
+}
+
 func TestVersion(t *testing.T) {
 	t.Run("return valid version", func(t *testing.T) {
 		t.Helper()
@@ -109,6 +518,17 @@ func TestVersion(t *testing.T) {
 	})
 }
 
+// resetConfigFlags clears scope flags kept by config commands between parses
+func resetConfigFlags() {
+	configCommand.PersistentFlags().Set("global", "false")
+	configCommand.PersistentFlags().Set("local", "false")
+	configCommand.Flags().Set("show-origin", "false")
+	configCommand.Flags().Set("game", "")
+	for _, cmd := range configCommand.Commands() {
+		cmd.Flags().Set("game", "")
+	}
+}
+
 func testCallInit(t *testing.T, shouldPass bool, testType string, commandAndArgs ...string) {
 	t.Helper()
 	serv := newServiceMock()
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ArchiveExt is extension of save archive inside GameSaveRoot
+	ArchiveExt string = ".tar.gz"
+	// StorageArchive stores each save location as one compressed archive
+	StorageArchive = "archive"
+	// StorageFiles stores each save location as plain files
+	StorageFiles = "files"
+)
+
+var (
+	// ErrStorageInvalid represents error if storage mode is unknown
+	ErrStorageInvalid = errors.New("Storage mode is invalid, use files or archive")
+)
+
+// ParseStorage validates storage mode, empty value means StorageFiles
+func ParseStorage(value string) (string, error) {
+	switch value {
+	case "":
+		return StorageFiles, nil
+	case StorageFiles, StorageArchive:
+		return value, nil
+	}
+	return "", ErrStorageInvalid
+}
+
+// PackArchive packs file or directory src into gzip compressed tar
+// archive dst. Entries are sorted and carry no owner nor modification
+// time, so identical content always produces identical archive.
+// Files are selected by filter like CopyTree
+func (rep *OSRepository) PackArchive(src, dst string, filter TreeFilter) error {
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	err = packArchive(file, src, filter)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// UnpackArchive extracts archive created by PackArchive into directory dst
+func (rep *OSRepository) UnpackArchive(src, dst string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = os.MkdirAll(dst, 0755)
+	if err != nil {
+		return err
+	}
+	return readArchive(file, func(header *tar.Header, content io.Reader) error {
+		target := filepath.Join(dst, filepath.FromSlash(header.Name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(target, os.FileMode(header.Mode).Perm()|0700)
+		case tar.TypeSymlink:
+			linked := path.Join(path.Dir(header.Name), header.Linkname)
+			if path.IsAbs(header.Linkname) || !isArchivePath(linked) {
+				return fmt.Errorf("Archive link %s points outside archive", header.Name)
+			}
+			return os.Symlink(filepath.FromSlash(header.Linkname), target)
+		case tar.TypeReg:
+			out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, content)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// ArchiveChecksums reads archive created by PackArchive and returns
+// checksum and size of every regular file in it keyed by its path
+func ArchiveChecksums(r io.Reader) (map[string]ManifestEntry, error) {
+	entries := map[string]ManifestEntry{}
+	err := readArchive(r, func(header *tar.Header, content io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, content)
+		if err != nil {
+			return err
+		}
+		entries[header.Name] = ManifestEntry{
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+			Size:   size,
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// ArchiveFile reads content of regular file name inside archive
+// created by PackArchive
+func ArchiveFile(r io.Reader, name string) ([]byte, error) {
+	var content []byte
+	err := readArchive(r, func(header *tar.Header, reader io.Reader) error {
+		if header.Typeflag != tar.TypeReg || header.Name != name {
+			return nil
+		}
+		var err error
+		content, err = ioutil.ReadAll(reader)
+		return err
+	})
+	if err == nil && content == nil {
+		err = fmt.Errorf("Archive has no file %s", name)
+	}
+	return content, err
+}
+
+func packArchive(w io.Writer, src string, filter TreeFilter) error {
+	compressor, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewWriter(compressor)
+	err = walkTree(src, filter, func(entry treeEntry) error {
+		if entry.Rel == "." && entry.Info.IsDir() {
+			return nil
+		}
+		name := entry.Rel
+		if name == "." {
+			name = path.Base(filepath.ToSlash(src))
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    int64(entry.Info.Mode().Perm()),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+		switch {
+		case entry.Info.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			return archive.WriteHeader(header)
+		case entry.Info.Mode()&os.ModeSymlink != 0:
+			link, err := filepath.Rel(filepath.Dir(entry.Source), entry.Target)
+			if err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = filepath.ToSlash(link)
+			return archive.WriteHeader(header)
+		}
+		header.Typeflag = tar.TypeReg
+		header.Size = entry.Info.Size()
+		err := archive.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(entry.Source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.CopyN(archive, file, header.Size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = archive.Close()
+	if err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+func readArchive(r io.Reader, fn func(*tar.Header, io.Reader) error) error {
+	decompressor, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+	archive := tar.NewReader(decompressor)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		header.Name = strings.TrimSuffix(header.Name, "/")
+		if !isArchivePath(header.Name) {
+			return fmt.Errorf("Archive entry %s is outside archive", header.Name)
+		}
+		err = fn(header, archive)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isArchivePath checks whether slash separated p stays inside archive root
+func isArchivePath(p string) bool {
+	p = path.Clean(p)
+	return p != ".." && !path.IsAbs(p) && !strings.HasPrefix(p, "../")
+}
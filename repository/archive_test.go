@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPackArchive(t *testing.T) {
+	t.Run("pack identical content into identical archive", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.PackArchive(src, dst+"1", TreeFilter{Links: SymlinkPreserve})
+		assertNotError(t, err)
+		later := time.Now().Add(time.Hour)
+		os.Chtimes(filepath.Join(src, "slots", "slot1.save"), later, later)
+		err = rep.PackArchive(src, dst+"2", TreeFilter{Links: SymlinkPreserve})
+		assertNotError(t, err)
+		first, _ := ioutil.ReadFile(dst + "1")
+		second, _ := ioutil.ReadFile(dst + "2")
+		if !bytes.Equal(first, second) {
+			t.Error("Archives should be identical")
+		}
+	})
+
+	t.Run("pack undefined directory", func(t *testing.T) {
+		rep := OSRepository{}
+		err := rep.PackArchive("test_undefined_dir", "test_undefined.tar.gz", TreeFilter{Links: SymlinkPreserve})
+		assertError(t, err)
+		if rep.Exists("test_undefined.tar.gz") {
+			t.Error("Should remove incomplete archive")
+		}
+	})
+}
+
+func TestUnpackArchive(t *testing.T) {
+	t.Run("unpack packed directory", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		archive := dst + ArchiveExt
+		rep.PackArchive(src, archive, TreeFilter{Links: SymlinkPreserve})
+		err := rep.UnpackArchive(archive, dst)
+		assertNotError(t, err)
+		assertSameContent(t, filepath.Join(dst, "slots", "slot1.save"), filepath.Join(src, "slots", "slot1.save"))
+		link, err := os.Readlink(filepath.Join(dst, "latest.save"))
+		assertNotError(t, err)
+		assertEqual(t, link, filepath.Join("slots", "slot1.save"))
+	})
+
+	t.Run("refuse entry outside archive", func(t *testing.T) {
+		rep := OSRepository{}
+		dir, _ := ioutil.TempDir("", "gamesave_archive")
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "evil"+ArchiveExt)
+		createTestArchive(t, archive, &tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644})
+		err := rep.UnpackArchive(archive, filepath.Join(dir, "out"))
+		assertError(t, err)
+		if rep.Exists(filepath.Join(dir, "evil")) {
+			t.Error("Should not write outside destination")
+		}
+	})
+
+	t.Run("refuse link outside archive", func(t *testing.T) {
+		rep := OSRepository{}
+		dir, _ := ioutil.TempDir("", "gamesave_archive")
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "evil"+ArchiveExt)
+		createTestArchive(t, archive, &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"})
+		err := rep.UnpackArchive(archive, filepath.Join(dir, "out"))
+		assertError(t, err)
+	})
+}
+
+func TestArchiveChecksums(t *testing.T) {
+	t.Run("read checksum of archived files", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		archive := dst + ArchiveExt
+		rep.PackArchive(src, archive, TreeFilter{Links: SymlinkSkip})
+		file, _ := os.Open(archive)
+		defer file.Close()
+		entries, err := ArchiveChecksums(file)
+		assertNotError(t, err)
+		if len(entries) != 2 {
+			t.Errorf("Got %d entries expect 2", len(entries))
+		}
+		want, _ := rep.HashFile(filepath.Join(src, "slots", "slot1.save"))
+		assertEqual(t, entries["slots/slot1.save"].SHA256, want)
+	})
+}
+
+func TestArchiveFile(t *testing.T) {
+	t.Run("read content of archived file", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		archive := dst + ArchiveExt
+		rep.PackArchive(src, archive, TreeFilter{Links: SymlinkSkip})
+		data, _ := ioutil.ReadFile(archive)
+		content, err := ArchiveFile(bytes.NewReader(data), "slots/slot1.save")
+		assertNotError(t, err)
+		want, _ := ioutil.ReadFile(filepath.Join(src, "slots", "slot1.save"))
+		assertEqual(t, string(content), string(want))
+		if _, err = ArchiveFile(bytes.NewReader(data), "slots/missing.save"); err == nil {
+			t.Error("Should show error on missing file")
+		}
+	})
+}
+
+func createTestArchive(t *testing.T, archive string, header *tar.Header) {
+	t.Helper()
+	var buffer bytes.Buffer
+	compressor := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressor)
+	err := writer.WriteHeader(header)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = compressor.Close()
+	}
+	if err == nil {
+		err = ioutil.WriteFile(archive, buffer.Bytes(), 0644)
+	}
+	if err != nil {
+		t.Errorf("[Helper-createTestArchive] Error: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+const (
+	// CatalogBranch is branch of gamesave Git repository holding CatalogFile
+	CatalogBranch string = "gamesave-catalog"
+	// CatalogFile is path of the game catalog inside CatalogBranch
+	CatalogFile string = "catalog.json"
+)
+
+// Catalog lists every game saved in gamesave Git repository keyed by
+// game name, so the games can be set up on another machine
+type Catalog struct {
+	Games map[string]CatalogGame `json:"games"`
+}
+
+// CatalogGame is display name of a game along with path template of
+// every save location keyed by its name, save paths mapped to machines
+// and patterns of TreeFilter
+type CatalogGame struct {
+	DisplayName string                       `json:"display_name,omitempty"`
+	SavePaths   map[string]string            `json:"save_paths,omitempty"`
+	Machines    map[string]map[string]string `json:"machines,omitempty"`
+	Include     []string                     `json:"include,omitempty"`
+	Exclude     []string                     `json:"exclude,omitempty"`
+}
+
+// NewCatalog instantiate empty Catalog
+func NewCatalog() Catalog {
+	return Catalog{Games: map[string]CatalogGame{}}
+}
+
+// NewCatalogGame returns CatalogGame holding save paths and patterns of config
+func NewCatalogGame(displayName string, config map[string]string) (CatalogGame, error) {
+	game := &GameConfig{}
+	for key, value := range config {
+		if key != "include" && key != "exclude" && !isSavePathKey(key) {
+			continue
+		}
+		if err := game.Set(key, value); err != nil {
+			return CatalogGame{}, err
+		}
+	}
+	return CatalogGame{
+		DisplayName: displayName,
+		SavePaths:   game.SavePaths,
+		Machines:    game.Machines,
+		Include:     game.Include,
+		Exclude:     game.Exclude,
+	}, nil
+}
+
+// Values returns config keys of save paths and patterns along with their value
+func (g CatalogGame) Values() map[string]string {
+	game := &GameConfig{
+		SavePaths: g.SavePaths,
+		Machines:  g.Machines,
+		Include:   g.Include,
+		Exclude:   g.Exclude,
+	}
+	return game.Values()
+}
+
+// MergeCatalog merges local and remote catalogs changed since their
+// common base. Games changed only on one side keep that change, games
+// changed on both sides keep the local change along with save paths
+// which remote maps to other machines
+func MergeCatalog(base, local, remote Catalog) Catalog {
+	merged := NewCatalog()
+	for name, game := range remote.Games {
+		merged.Games[name] = game
+	}
+	for name, game := range local.Games {
+		old, inBase := base.Games[name]
+		theirs, inRemote := remote.Games[name]
+		if inBase && reflect.DeepEqual(game, old) {
+			continue
+		}
+		if inRemote && !(inBase && reflect.DeepEqual(theirs, old)) {
+			machines := map[string]map[string]string{}
+			for machine, paths := range game.Machines {
+				machines[machine] = paths
+			}
+			for machine, paths := range theirs.Machines {
+				if _, ok := machines[machine]; ok {
+					continue
+				}
+				if basePaths, ok := old.Machines[machine]; ok && reflect.DeepEqual(basePaths, paths) {
+					// unmapped locally
+					continue
+				}
+				machines[machine] = paths
+			}
+			if len(machines) > 0 {
+				game.Machines = machines
+			}
+		}
+		merged.Games[name] = game
+	}
+	return merged
+}
+
+// Encode encodes Catalog into its JSON representation
+func (c Catalog) Encode() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// ParseCatalog decodes Catalog from its JSON representation
+func ParseCatalog(data []byte) (Catalog, error) {
+	catalog := NewCatalog()
+	err := json.Unmarshal(data, &catalog)
+	if catalog.Games == nil {
+		catalog.Games = map[string]CatalogGame{}
+	}
+	return catalog, err
+}
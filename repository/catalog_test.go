@@ -0,0 +1,88 @@
+package repository
+
+import "testing"
+
+func TestCatalogGame(t *testing.T) {
+	t.Run("keep save paths and patterns of config", func(t *testing.T) {
+		config := map[string]string{
+			"game_name": "game", "save_path": "<home>/saves", "save_path.memcard": "./memcard",
+			"include": "*.sav", "storage": "archive",
+		}
+		game, err := NewCatalogGame("The Game", config)
+		assertNotError(t, err)
+		values := game.Values()
+		if len(values) != 3 {
+			t.Errorf("Got %v expect 3 values", values)
+		}
+		assertEqual(t, values["save_path.memcard"], "./memcard")
+		assertEqual(t, values["include"], "*.sav")
+	})
+
+	t.Run("refuse invalid pattern", func(t *testing.T) {
+		_, err := NewCatalogGame("", map[string]string{"exclude": "/etc"})
+		assertError(t, err)
+	})
+}
+
+func TestMergeCatalog(t *testing.T) {
+	t.Run("merge games changed on either side", func(t *testing.T) {
+		base := NewCatalog()
+		base.Games["kept"] = CatalogGame{DisplayName: "Kept"}
+		base.Games["local"] = CatalogGame{DisplayName: "Old"}
+		base.Games["remote"] = CatalogGame{DisplayName: "Old"}
+		local := NewCatalog()
+		local.Games["kept"] = CatalogGame{DisplayName: "Kept"}
+		local.Games["local"] = CatalogGame{DisplayName: "Local"}
+		local.Games["remote"] = CatalogGame{DisplayName: "Old"}
+		local.Games["added"] = CatalogGame{DisplayName: "Added"}
+		remote := NewCatalog()
+		remote.Games["kept"] = CatalogGame{DisplayName: "Kept"}
+		remote.Games["local"] = CatalogGame{DisplayName: "Old"}
+		remote.Games["remote"] = CatalogGame{DisplayName: "Remote"}
+		merged := MergeCatalog(base, local, remote)
+		if len(merged.Games) != 4 {
+			t.Errorf("Got %v expect 4 games", merged.Games)
+		}
+		assertEqual(t, merged.Games["local"].DisplayName, "Local")
+		assertEqual(t, merged.Games["remote"].DisplayName, "Remote")
+		assertEqual(t, merged.Games["added"].DisplayName, "Added")
+	})
+
+	t.Run("keep machines mapped remotely when both changed", func(t *testing.T) {
+		base := NewCatalog()
+		base.Games["game"] = CatalogGame{Machines: map[string]map[string]string{
+			"old": {"default": "/old"},
+		}}
+		local := NewCatalog()
+		local.Games["game"] = CatalogGame{DisplayName: "Game", Machines: map[string]map[string]string{
+			"desktop": {"default": "/desktop"},
+		}}
+		remote := NewCatalog()
+		remote.Games["game"] = CatalogGame{Machines: map[string]map[string]string{
+			"old":  {"default": "/old"},
+			"deck": {"default": "/deck"},
+		}}
+		merged := MergeCatalog(base, local, remote).Games["game"]
+		assertEqual(t, merged.DisplayName, "Game")
+		assertEqual(t, merged.Machines["deck"]["default"], "/deck")
+		assertEqual(t, merged.Machines["desktop"]["default"], "/desktop")
+		if _, ok := merged.Machines["old"]; ok {
+			t.Error("Should keep machine unmapped locally")
+		}
+	})
+}
+
+func TestParseCatalog(t *testing.T) {
+	t.Run("parse catalog without games", func(t *testing.T) {
+		catalog, err := ParseCatalog([]byte(`{}`))
+		assertNotError(t, err)
+		if catalog.Games == nil {
+			t.Error("Games should be initialized")
+		}
+	})
+
+	t.Run("parse invalid catalog", func(t *testing.T) {
+		_, err := ParseCatalog([]byte(`{"games": [`))
+		assertError(t, err)
+	})
+}
@@ -57,6 +57,14 @@ func assertNotError(t *testing.T, err error) {
 	}
 }
 
+func assertRegularFile(t *testing.T, path string) {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("'%s' is not a regular file", path)
+	}
+}
+
 func assertRemoteSame(t *testing.T, repoURL string) {
 	cmd := exec.Command("git", "remote", "-v")
 	cmd.Dir = GameSaveRoot
@@ -98,6 +106,14 @@ func createBlankFile(t *testing.T, path string) {
 	}
 }
 
+func createSymlink(t *testing.T, target, path string) {
+	t.Helper()
+	err := os.Symlink(target, path)
+	if err != nil {
+		t.Errorf("[Helper-createSymlink] Error: %v", err)
+	}
+}
+
 func createDummyDirectory(t *testing.T, path string) {
 	t.Helper()
 	cmd := exec.Command("mkdir", "-p", path)
@@ -160,6 +176,15 @@ func getLocalConfig(t *testing.T, key string) string {
 	return ""
 }
 
+func getConfig(t *testing.T, rep *OSRepository, key string) string {
+	t.Helper()
+	value, _, err := rep.GetConfig(key)
+	if err != nil {
+		t.Errorf("[Helper-getConfig] error: %v", err)
+	}
+	return value
+}
+
 func gitAddRepoURL(t *testing.T, repoURL string) {
 	t.Helper()
 	cmd := exec.Command("git", "init")
@@ -192,6 +217,16 @@ func gitAddAndCommit(t *testing.T) {
 	}
 }
 
+// gitIn runs git command inside dir and fails test on error
+func gitIn(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("[Helper-gitIn] Error: %v, output: %s", err, string(output))
+	}
+}
+
 func gitCurrentBranchName(t *testing.T) string {
 	t.Helper()
 	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
@@ -228,8 +263,19 @@ func gitDeleteRemoteBranch(t *testing.T, branch string) {
 	cmd.Run() // branch may not exist
 }
 
+func initLocalRepo(t *testing.T) {
+	t.Helper()
+	cleanLocalRepo(t)
+	cmd := exec.Command("git", "init", GameSaveRoot)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("[Helper-initLocalRepo] Error: %v, output: %s", err, string(output))
+	}
+}
+
 func initLocalConfig(t *testing.T) {
 	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 	err := ioutil.WriteFile(LocalConfig, []byte("{}"), 0644)
 	if err != nil {
 		t.Errorf("[Helper-initLocalConfig] error: %v", err)
@@ -247,6 +293,7 @@ func removeDummyFile(t *testing.T, path string) {
 
 func removeLocalConfig(t *testing.T) {
 	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 	cmd := exec.Command("rm", LocalConfig)
 	cmd.Run() // LocalConfig may uninitialized
 }
@@ -0,0 +1,1172 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ConfigVersion is schema version of the global config written by this version
+	ConfigVersion = 1
+
+	// ScopeEffective reads config merged from every scope
+	ScopeEffective ConfigScope = ""
+	// ScopeGame is config of the selected game
+	ScopeGame ConfigScope = "game"
+	// ScopeGlobal is config used by every game which does not set it
+	ScopeGlobal ConfigScope = "global"
+	// ScopeLocal is config of the current directory overriding config of its game
+	ScopeLocal ConfigScope = "local"
+
+	// MachineEnv is environment variable holding MachineID instead of the host name
+	MachineEnv = "GAMESAVE_MACHINE"
+	// RootEnv is environment variable holding GameSaveRoot
+	RootEnv = "GAMESAVE_HOME"
+
+	defaultLocation = "default"
+	rootKey         = "root"
+	savePathKey     = "save_path"
+)
+
+var (
+	// ErrConfigKeyUnknown represents error if config key is not supported
+	ErrConfigKeyUnknown = errors.New("Config key is unknown")
+	// ErrGameNotExist represents error if game has no profile in the global config
+	ErrGameNotExist = errors.New("Game has not been added, use add first")
+	// ErrGameNotSelected represents error if config is changed before a game is selected
+	ErrGameNotSelected = errors.New("Game has not been selected, use add, use or --game first")
+	// ErrRootUnknown represents error if GameSaveRoot is not set and home directory is unknown
+	ErrRootUnknown = errors.New("Unable to find home directory, set gamesave root by --root or " + RootEnv)
+	// ErrSizeInvalid represents error if size is not a non-negative number of bytes
+	ErrSizeInvalid = errors.New("Size is invalid, use a number such as 500, 200MB or 1GiB, 0 disables it")
+
+	sizePattern = regexp.MustCompile(`^([0-9]{1,12}(?:\.[0-9]+)?) ?([KMG]?I?B?)$`)
+	sizeUnits   = map[string]int64{
+		"":    1,
+		"B":   1,
+		"K":   1 << 10,
+		"KB":  1 << 10,
+		"KIB": 1 << 10,
+		"M":   1 << 20,
+		"MB":  1 << 20,
+		"MIB": 1 << 20,
+		"G":   1 << 30,
+		"GB":  1 << 30,
+		"GIB": 1 << 30,
+	}
+
+	// configFields maps config keys other than save paths to GameConfig fields
+	configFields = map[string]configField{
+		"confirm_threshold": intField(func(c *GameConfig) **int { return &c.ConfirmThreshold }),
+		"exclude":           listField(func(c *GameConfig) *[]string { return &c.Exclude }),
+		"growth_warning":    intField(func(c *GameConfig) **int { return &c.GrowthWarning }),
+		"on_conflict":       hookField("on_conflict"),
+		"post_load":         hookField("post_load"),
+		"post_save":         hookField("post_save"),
+		"pre_load":          hookField("pre_load"),
+		"pre_save":          hookField("pre_save"),
+		"include":           listField(func(c *GameConfig) *[]string { return &c.Include }),
+		"key_file":          stringField(func(c *GameConfig) *string { return &c.KeyFile }, nil),
+		"max_files":         intField(func(c *GameConfig) **int { return &c.MaxFiles }),
+		"max_size": stringField(func(c *GameConfig) *string { return &c.MaxSize }, func(value string) error {
+			_, err := ParseSize(value)
+			return err
+		}),
+		"storage": stringField(func(c *GameConfig) *string { return &c.Storage }, func(value string) error {
+			_, err := ParseStorage(value)
+			return err
+		}),
+		"symlinks": stringField(func(c *GameConfig) *string { return &c.Symlinks }, func(value string) error {
+			_, err := ParseSymlinkPolicy(value)
+			return err
+		}),
+	}
+	// hookNames are config keys of hook commands
+	hookNames = map[string]bool{
+		"on_conflict": true,
+		"post_load":   true,
+		"post_save":   true,
+		"pre_load":    true,
+		"pre_save":    true,
+	}
+	// configMigrations upgrade config data of version i to version i+1,
+	// keys which can not be migrated are returned as warnings
+	configMigrations = []func(data []byte) ([]byte, []string, error){
+		migrateFlatConfig,
+	}
+)
+
+// ConfigScope is where config is read from or written to
+type ConfigScope string
+
+// Config is content of the global config file, it holds config of
+// every game keyed by game name and defaults used by every game.
+// Root is GameSaveRoot used if neither --root nor RootEnv is set
+type Config struct {
+	Version    int                    `json:"version"`
+	ActiveGame string                 `json:"active_game,omitempty"`
+	Root       string                 `json:"root,omitempty"`
+	Defaults   *GameConfig            `json:"defaults,omitempty"`
+	Games      map[string]*GameConfig `json:"games"`
+}
+
+// GameConfig is config of a game. SavePaths holds path template of
+// every save location keyed by its name, Machines holds save paths
+// used instead of them keyed by MachineID. Include and Exclude hold
+// patterns of TreeFilter, Hooks holds hook commands keyed by config
+// key of the hook, unset numbers are nil
+type GameConfig struct {
+	SavePaths        map[string]string            `json:"save_paths,omitempty"`
+	Machines         map[string]map[string]string `json:"machines,omitempty"`
+	Include          []string                     `json:"include,omitempty"`
+	Exclude          []string                     `json:"exclude,omitempty"`
+	Storage          string                       `json:"storage,omitempty"`
+	Symlinks         string                       `json:"symlinks,omitempty"`
+	KeyFile          string                       `json:"key_file,omitempty"`
+	MaxSize          string                       `json:"max_size,omitempty"`
+	MaxFiles         *int                         `json:"max_files,omitempty"`
+	GrowthWarning    *int                         `json:"growth_warning,omitempty"`
+	ConfirmThreshold *int                         `json:"confirm_threshold,omitempty"`
+	Hooks            map[string]string            `json:"hooks,omitempty"`
+}
+
+// ConfigValue is effective value of a config key, Origin tells the
+// scope and the file or environment variable it is read from
+type ConfigValue struct {
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// ConfigError represents error if value of config field is invalid
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("Invalid config %s: %v", e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configField gets and sets a GameConfig field by its config key,
+// empty value unsets the field. List and number tell how the value
+// is written to LocalConfig of formats having lists and numbers
+type configField struct {
+	get    func(c *GameConfig) string
+	set    func(c *GameConfig, value string) error
+	list   bool
+	number bool
+}
+
+func intField(field func(c *GameConfig) **int) configField {
+	return configField{
+		get: func(c *GameConfig) string {
+			if *field(c) == nil {
+				return ""
+			}
+			return strconv.Itoa(**field(c))
+		},
+		set: func(c *GameConfig, value string) error {
+			if value == "" {
+				*field(c) = nil
+				return nil
+			}
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 0 {
+				return errors.New("Should be a non-negative number")
+			}
+			*field(c) = &number
+			return nil
+		},
+		number: true,
+	}
+}
+
+// stringField gets and sets string value checked by check if it is not nil
+func stringField(field func(c *GameConfig) *string, check func(value string) error) configField {
+	return configField{
+		get: func(c *GameConfig) string {
+			return *field(c)
+		},
+		set: func(c *GameConfig, value string) error {
+			if value != "" && check != nil {
+				if err := check(value); err != nil {
+					return err
+				}
+			}
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// listField gets and sets list as comma separated value,
+// every item should be a valid pattern
+func listField(field func(c *GameConfig) *[]string) configField {
+	return configField{
+		get: func(c *GameConfig) string {
+			return strings.Join(*field(c), ",")
+		},
+		set: func(c *GameConfig, value string) error {
+			items := []string{}
+			for _, item := range splitList(value) {
+				if err := ValidatePattern(item); err != nil {
+					return err
+				}
+				items = append(items, item)
+			}
+			if len(items) == 0 {
+				items = nil
+			}
+			*field(c) = items
+			return nil
+		},
+		list: true,
+	}
+}
+
+// hookField gets and sets command of hook name
+func hookField(name string) configField {
+	return configField{
+		get: func(c *GameConfig) string {
+			return c.Hooks[name]
+		},
+		set: func(c *GameConfig, value string) error {
+			if value == "" {
+				delete(c.Hooks, name)
+				return nil
+			}
+			if c.Hooks == nil {
+				c.Hooks = map[string]string{}
+			}
+			c.Hooks[name] = value
+			return nil
+		},
+	}
+}
+
+// savePathField gets and sets path template of save location name,
+// the path is mapped to machine if it is not empty
+func savePathField(name, machine string) configField {
+	paths := func(c *GameConfig) map[string]string {
+		if machine == "" {
+			return c.SavePaths
+		}
+		return c.Machines[machine]
+	}
+	return configField{
+		get: func(c *GameConfig) string {
+			return paths(c)[name]
+		},
+		set: func(c *GameConfig, value string) error {
+			if value == "" {
+				delete(paths(c), name)
+				if machine != "" && len(c.Machines[machine]) == 0 {
+					delete(c.Machines, machine)
+				}
+				return nil
+			}
+			if machine != "" {
+				if c.Machines == nil {
+					c.Machines = map[string]map[string]string{}
+				}
+				if c.Machines[machine] == nil {
+					c.Machines[machine] = map[string]string{}
+				}
+			} else if c.SavePaths == nil {
+				c.SavePaths = map[string]string{}
+			}
+			paths(c)[name] = value
+			return nil
+		},
+	}
+}
+
+// lookupConfigField returns field of config key, "save_path" is path of
+// the default location and "save_path.<name>" is path of location name.
+// Save path key followed by "@<machine>" is the path mapped to machine
+func lookupConfigField(key string) (configField, bool) {
+	key, machine := SplitMachineKey(key)
+	if strings.Contains(key, "@") {
+		return configField{}, false
+	}
+	if key == savePathKey {
+		return savePathField(defaultLocation, machine), true
+	}
+	if strings.HasPrefix(key, savePathKey+".") && len(key) > len(savePathKey)+1 {
+		return savePathField(strings.TrimPrefix(key, savePathKey+"."), machine), true
+	}
+	if machine != "" {
+		return configField{}, false
+	}
+	field, ok := configFields[key]
+	return field, ok
+}
+
+// SplitMachineKey splits config key "<key>@<machine>" into
+// key and machine, machine is empty if key has no machine
+func SplitMachineKey(key string) (string, string) {
+	i := strings.LastIndex(key, "@")
+	if i < 0 || i == len(key)-1 {
+		return key, ""
+	}
+	return key[:i], key[i+1:]
+}
+
+// ParseSize parses size such as 500, 200MB or 1.5GiB into bytes
+func ParseSize(value string) (int64, error) {
+	match := sizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if match == nil {
+		return 0, ErrSizeInvalid
+	}
+	unit, ok := sizeUnits[match[2]]
+	size, err := strconv.ParseFloat(match[1], 64)
+	if !ok || err != nil {
+		return 0, ErrSizeInvalid
+	}
+	return int64(size * float64(unit)), nil
+}
+
+// IsConfigKey checks whether key is a supported config key
+func IsConfigKey(key string) bool {
+	_, ok := lookupConfigField(key)
+	return ok || key == rootKey
+}
+
+// isSavePathKey checks whether key is save path of a location,
+// either the default one or the one mapped to a machine
+func isSavePathKey(key string) bool {
+	key, _ = SplitMachineKey(key)
+	return key == savePathKey || strings.HasPrefix(key, savePathKey+".")
+}
+
+// Get returns value of config key, empty if it is not set
+func (c *GameConfig) Get(key string) string {
+	field, ok := lookupConfigField(key)
+	if !ok {
+		return ""
+	}
+	return field.get(c)
+}
+
+// Set changes value of config key, empty value unsets it
+func (c *GameConfig) Set(key, value string) error {
+	field, ok := lookupConfigField(key)
+	if !ok {
+		return &ConfigError{Field: key, Err: ErrConfigKeyUnknown}
+	}
+	if err := field.set(c, value); err != nil {
+		return &ConfigError{Field: key, Err: err}
+	}
+	return nil
+}
+
+// Values returns every config key which is set along with its value
+func (c *GameConfig) Values() map[string]string {
+	values := map[string]string{}
+	addSavePaths := func(paths map[string]string, suffix string) {
+		for name, template := range paths {
+			if name == defaultLocation {
+				values[savePathKey+suffix] = template
+			} else {
+				values[savePathKey+"."+name+suffix] = template
+			}
+		}
+	}
+	addSavePaths(c.SavePaths, "")
+	for machine, paths := range c.Machines {
+		addSavePaths(paths, "@"+machine)
+	}
+	for key, field := range configFields {
+		if value := field.get(c); value != "" {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// machineValues returns Values with save paths mapped to machine used
+// instead of the default ones, save paths of other machines are left out
+func (c *GameConfig) machineValues(machine string) map[string]string {
+	values := map[string]string{}
+	for key, value := range c.Values() {
+		if _, mapped := SplitMachineKey(key); mapped == "" {
+			values[key] = value
+		}
+	}
+	for name, template := range c.Machines[machine] {
+		if name == defaultLocation {
+			values[savePathKey] = template
+		} else {
+			values[savePathKey+"."+name] = template
+		}
+	}
+	return values
+}
+
+// validate returns ConfigError naming the first invalid field
+func (c *Config) validate() error {
+	if c.Defaults != nil {
+		if len(c.Defaults.SavePaths) > 0 || len(c.Defaults.Machines) > 0 {
+			return &ConfigError{Field: "defaults.save_paths", Err: errors.New("Save path should be set per game")}
+		}
+		if err := c.Defaults.validate("defaults"); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(c.Games))
+	for name := range c.Games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "" {
+			return &ConfigError{Field: "games", Err: errors.New("Game name should not be empty")}
+		}
+		if c.Games[name] == nil {
+			c.Games[name] = &GameConfig{}
+		}
+		if err := c.Games[name].validate("games." + name); err != nil {
+			return err
+		}
+	}
+	if c.ActiveGame != "" && c.Games[c.ActiveGame] == nil {
+		return &ConfigError{Field: "active_game", Err: ErrGameNotExist}
+	}
+	return nil
+}
+
+// validate returns ConfigError naming the first invalid field,
+// prefix is path of the config in the config file
+func (c *GameConfig) validate(prefix string) error {
+	for location, template := range c.SavePaths {
+		if location == "" || template == "" {
+			return &ConfigError{Field: prefix + ".save_paths", Err: errors.New("Location name and path should not be empty")}
+		}
+	}
+	for machine, paths := range c.Machines {
+		if machine == "" || strings.Contains(machine, "@") || len(paths) == 0 {
+			return &ConfigError{Field: prefix + ".machines", Err: errors.New("Machine name should not be empty and should map save paths")}
+		}
+		for location, template := range paths {
+			if location == "" || template == "" {
+				return &ConfigError{Field: prefix + ".machines." + machine, Err: errors.New("Location name and path should not be empty")}
+			}
+		}
+	}
+	for name := range c.Hooks {
+		if !hookNames[name] {
+			return &ConfigError{Field: prefix + ".hooks." + name, Err: errors.New("Hook is unknown, use pre_save, post_save, pre_load, post_load or on_conflict")}
+		}
+	}
+	// values are checked by setting them the same way as by Set
+	for key, field := range configFields {
+		if err := field.set(&GameConfig{}, field.get(c)); err != nil {
+			return &ConfigError{Field: prefix + "." + key, Err: err}
+		}
+	}
+	return nil
+}
+
+// parseConfig decodes data of the global config, migrating it from older
+// versions first. Unknown keys are ignored and returned as warnings
+func parseConfig(data []byte) (Config, []string, error) {
+	var config Config
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return config, nil, err
+	}
+	if head.Version < 0 || head.Version > ConfigVersion {
+		return config, nil, &ConfigError{
+			Field: "version",
+			Err:   fmt.Errorf("Version %d is not supported, upgrade gamesave", head.Version),
+		}
+	}
+	warnings := []string{}
+	for version := head.Version; version < ConfigVersion; version++ {
+		migrated, dropped, err := configMigrations[version](data)
+		if err != nil {
+			return config, nil, err
+		}
+		data = migrated
+		warnings = append(warnings, dropped...)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return config, nil, &ConfigError{
+				Field: typeErr.Field,
+				Err:   fmt.Errorf("Should be %s instead of %s", typeErr.Type, typeErr.Value),
+			}
+		}
+		return config, nil, err
+	}
+	if config.Games == nil {
+		config.Games = map[string]*GameConfig{}
+	}
+	unknown, err := unknownConfigFields(data)
+	if err != nil {
+		return config, nil, err
+	}
+	return config, append(warnings, unknown...), config.validate()
+}
+
+// migrateFlatConfig migrates config of version 0, which keeps config
+// of every game as flat key and value, into version 1
+func migrateFlatConfig(data []byte) ([]byte, []string, error) {
+	var flat struct {
+		ActiveGame string                       `json:"active_game"`
+		Games      map[string]map[string]string `json:"games"`
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(data, &flat); err != nil {
+		return nil, nil, err
+	}
+	config := Config{Version: 1, ActiveGame: flat.ActiveGame, Games: map[string]*GameConfig{}}
+	warnings := []string{}
+	for key := range raw {
+		if key != "active_game" && key != "games" && key != "version" {
+			warnings = append(warnings, key)
+		}
+	}
+	for name, values := range flat.Games {
+		game := &GameConfig{}
+		for key, value := range values {
+			err := game.Set(key, value)
+			if configErr, ok := err.(*ConfigError); ok {
+				if configErr.Err == ErrConfigKeyUnknown {
+					warnings = append(warnings, fmt.Sprintf("games.%s.%s", name, key))
+					continue
+				}
+				configErr.Field = fmt.Sprintf("games.%s.%s", name, key)
+				return nil, nil, configErr
+			}
+		}
+		config.Games[name] = game
+	}
+	byt, err := json.Marshal(config)
+	return byt, warnings, err
+}
+
+// unknownConfigFields returns dotted path of every key in data
+// which is not a field of Config or GameConfig
+func unknownConfigFields(data []byte) ([]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	unknown := []string{}
+	known := jsonFieldNames(reflect.TypeOf(Config{}))
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	var games map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(raw["games"], &games); err != nil && raw["games"] != nil {
+		return nil, err
+	}
+	var defaults map[string]json.RawMessage
+	if err := json.Unmarshal(raw["defaults"], &defaults); err != nil && raw["defaults"] != nil {
+		return nil, err
+	}
+	known = jsonFieldNames(reflect.TypeOf(GameConfig{}))
+	for key := range defaults {
+		if !known[key] {
+			unknown = append(unknown, "defaults."+key)
+		}
+	}
+	for name, game := range games {
+		for key := range game {
+			if !known[key] {
+				unknown = append(unknown, fmt.Sprintf("games.%s.%s", name, key))
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+func jsonFieldNames(structType reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < structType.NumField(); i++ {
+		names[strings.Split(structType.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	return names
+}
+
+// GlobalConfigPath returns path of the global config file inside
+// $XDG_CONFIG_HOME, or ~/.config if it is not set
+func GlobalConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gamesave", "config.json"), nil
+}
+
+// MachineID returns name of this machine selecting save paths mapped
+// to it, MachineEnv if it is set, otherwise the host name
+func (rep *OSRepository) MachineID() (string, error) {
+	if machine := os.Getenv(MachineEnv); machine != "" {
+		return machine, nil
+	}
+	return os.Hostname()
+}
+
+// InitRoot sets GameSaveRoot and BackupRoot by root if it is not empty,
+// then by RootEnv, then by root of the global config, then ~/.gamesave.
+// Root may be a path template and relative root is made absolute
+func (rep *OSRepository) InitRoot(root string) error {
+	if root == "" {
+		root = os.Getenv(RootEnv)
+	}
+	if root == "" {
+		config, err := rep.readGlobalConfig()
+		if err != nil {
+			return err
+		}
+		root = config.Root
+	}
+	if root == "" {
+		home, err := os.UserHomeDir()
+		if err != nil || home == "" {
+			return ErrRootUnknown
+		}
+		root = filepath.Join(home, ".gamesave")
+	}
+	expanded, err := rep.ExpandPath(root)
+	if err != nil {
+		return &ConfigError{Field: rootKey, Err: err}
+	}
+	expanded, err = filepath.Abs(expanded)
+	if err != nil {
+		return err
+	}
+	SetRoot(filepath.ToSlash(expanded))
+	return nil
+}
+
+// ListScopeConfig returns every config key set in scope along with its
+// value, ScopeEffective returns config of the selected game merged from
+// ScopeGlobal, environment variables, ScopeGame then ScopeLocal
+func (rep *OSRepository) ListScopeConfig(scope ConfigScope) (map[string]string, error) {
+	if scope == ScopeEffective {
+		configs, err := rep.ListConfigOrigins()
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]string{}
+		for key, config := range configs {
+			values[key] = config.Value
+		}
+		return values, nil
+	}
+	config, err := rep.readGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+	gameName, err := rep.currentGame(config)
+	if err != nil {
+		return nil, err
+	}
+	local, err := rep.localGameConfig(gameName)
+	if err != nil {
+		return nil, err
+	}
+	switch scope {
+	case ScopeGlobal:
+		values := map[string]string{}
+		if config.Defaults != nil {
+			values = config.Defaults.Values()
+		}
+		if config.Root != "" {
+			values[rootKey] = config.Root
+		}
+		return values, nil
+	case ScopeGame:
+		game, ok := config.Games[gameName]
+		if !ok {
+			return nil, ErrGameNotSelected
+		}
+		return game.Values(), nil
+	}
+	return local.Values(), nil
+}
+
+// ListConfigOrigins returns every effective config key along with its
+// value and where the value comes from
+func (rep *OSRepository) ListConfigOrigins() (map[string]ConfigValue, error) {
+	config, err := rep.readGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+	gameName, err := rep.currentGame(config)
+	if err != nil {
+		return nil, err
+	}
+	local, err := rep.localGameConfig(gameName)
+	if err != nil {
+		return nil, err
+	}
+	env, err := envGameConfig()
+	if err != nil {
+		return nil, err
+	}
+	machine, err := rep.MachineID()
+	if err != nil {
+		return nil, err
+	}
+	configPath, err := GlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	localPath, err := findLocalConfig()
+	if err != nil {
+		return nil, err
+	}
+	configs := map[string]ConfigValue{}
+	layers := []struct {
+		game   *GameConfig
+		origin string
+	}{
+		{config.Defaults, "global " + configPath},
+		{env, "env"},
+		{config.Games[gameName], "game " + gameName + " " + configPath},
+		{local, "local " + localPath},
+	}
+	for _, layer := range layers {
+		if layer.game == nil {
+			continue
+		}
+		values := layer.game.Values()
+		for key, value := range layer.game.machineValues(machine) {
+			origin := layer.origin
+			if layer.game == env {
+				origin += " " + configEnv(key)
+			} else if values[key] != value {
+				origin += " machine " + machine
+			}
+			configs[key] = ConfigValue{Value: value, Origin: origin}
+		}
+	}
+	if gameName != "" {
+		origin := "global " + configPath
+		if rep.game != "" {
+			origin = "flag --game"
+		} else if selected, _ := readLocalConfig(); selected["game_name"] != "" {
+			origin = "local " + localPath
+		}
+		configs["game_name"] = ConfigValue{Value: gameName, Origin: origin}
+	}
+	if config.Root != "" {
+		configs[rootKey] = ConfigValue{Value: config.Root, Origin: "global " + configPath}
+	}
+	return configs, nil
+}
+
+// SetScopeConfig sets config key in scope, empty value unsets it.
+// ScopeEffective sets it in ScopeGame. Save path can not be set in
+// ScopeGlobal and root can only be set in ScopeGlobal
+func (rep *OSRepository) SetScopeConfig(scope ConfigScope, key, value string) error {
+	if !IsConfigKey(key) {
+		return &ConfigError{Field: key, Err: ErrConfigKeyUnknown}
+	}
+	unlock, err := rep.lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := rep.readGlobalConfig()
+	if err != nil {
+		return err
+	}
+	if key == rootKey {
+		if scope != ScopeGlobal {
+			return &ConfigError{Field: key, Err: errors.New("Root should be set in global config")}
+		}
+		config.Root = value
+		return writeGlobalConfig(config)
+	}
+	switch scope {
+	case ScopeGlobal:
+		if isSavePathKey(key) {
+			return &ConfigError{Field: key, Err: errors.New("Save path should be set per game")}
+		}
+		if config.Defaults == nil {
+			config.Defaults = &GameConfig{}
+		}
+		if err = config.Defaults.Set(key, value); err != nil {
+			return err
+		}
+		return writeGlobalConfig(config)
+	case ScopeLocal:
+		if err = (&GameConfig{}).Set(key, value); err != nil {
+			return err
+		}
+		local, err := readLocalConfig()
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			delete(local, key)
+		} else {
+			local[key] = value
+		}
+		return writeLocalConfig(local)
+	}
+	gameName, err := rep.currentGame(config)
+	if err != nil {
+		return err
+	}
+	if gameName == "" {
+		return ErrGameNotSelected
+	}
+	game, ok := config.Games[gameName]
+	if !ok {
+		game = &GameConfig{}
+		config.Games[gameName] = game
+	}
+	if err = game.Set(key, value); err != nil {
+		return err
+	}
+	return writeGlobalConfig(config)
+}
+
+// ListGames returns sorted names of games added to the global config
+func (rep *OSRepository) ListGames() ([]string, error) {
+	config, err := rep.readGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(config.Games))
+	for name := range config.Games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SelectGame makes config of game name used by this process
+// regardless of LocalConfig and the active game, empty name removes
+// the selection. Previously selected name is returned
+func (rep *OSRepository) SelectGame(name string) string {
+	previous := rep.game
+	rep.game = name
+	return previous
+}
+
+// UseGame makes game name the active game,
+// it is used wherever LocalConfig does not select a game
+func (rep *OSRepository) UseGame(name string) error {
+	unlock, err := rep.lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	config, err := rep.readGlobalConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Games[name]; !ok {
+		return ErrGameNotExist
+	}
+	config.ActiveGame = name
+	return writeGlobalConfig(config)
+}
+
+// currentGame returns name of the selected game, either selected by
+// SelectGame, by LocalConfig or the active game in config
+func (rep *OSRepository) currentGame(config Config) (string, error) {
+	if rep.game != "" {
+		return rep.game, nil
+	}
+	local, err := readLocalConfig()
+	if err != nil {
+		return "", err
+	}
+	if local["game_name"] != "" {
+		return local["game_name"], nil
+	}
+	return config.ActiveGame, nil
+}
+
+// localGameConfig returns config of LocalConfig overriding config of
+// game name, it is empty if LocalConfig selects another game
+func (rep *OSRepository) localGameConfig(gameName string) (*GameConfig, error) {
+	game := &GameConfig{}
+	local, localPath, err := loadLocalConfig()
+	if err != nil {
+		return nil, err
+	}
+	if local["game_name"] != "" && local["game_name"] != gameName {
+		return game, nil
+	}
+	warned := rep.localWarned
+	for key, value := range local {
+		if key == "game_name" || key == "version" {
+			continue
+		}
+		err = game.Set(key, value)
+		if configErr, ok := err.(*ConfigError); ok && configErr.Err == ErrConfigKeyUnknown {
+			if !warned {
+				fmt.Printf("Warning: unknown config %s in %s is ignored\n", key, localPath)
+				rep.localWarned = true
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("Unable to read %s: %v", localPath, err)
+		}
+	}
+	return game, nil
+}
+
+// readGlobalConfig reads the global config, config of older version
+// and settings of LocalConfig written by older version are migrated
+// into the current version first. Migration is written under the config
+// lock after config is read again, so concurrent processes migrate it
+// only once. Unknown keys are warned once
+func (rep *OSRepository) readGlobalConfig() (Config, error) {
+	config, legacy, err := rep.loadGlobalConfig()
+	if err != nil || config.Version == ConfigVersion && legacy == nil {
+		return config, err
+	}
+	unlock, err := rep.lockConfig()
+	if err != nil {
+		return config, err
+	}
+	defer unlock()
+	config, legacy, err = rep.loadGlobalConfig()
+	if err != nil || config.Version == ConfigVersion && legacy == nil {
+		return config, err
+	}
+	config.Version = ConfigVersion
+	if legacy == nil {
+		return config, writeGlobalConfig(config)
+	}
+	return config, migrateLocalConfig(&config, legacy)
+}
+
+// loadGlobalConfig reads and parses the global config along with
+// LocalConfig written by older version, which is nil if there is none.
+// Config is of the current version if the global config does not exist
+func (rep *OSRepository) loadGlobalConfig() (Config, map[string]string, error) {
+	config := Config{Version: ConfigVersion, Games: map[string]*GameConfig{}}
+	configPath, err := GlobalConfigPath()
+	if err != nil {
+		return config, nil, err
+	}
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return config, nil, err
+	}
+	if err == nil {
+		var warnings []string
+		config, warnings, err = parseConfig(data)
+		if _, ok := err.(*ConfigError); ok {
+			return config, nil, fmt.Errorf("Unable to read %s: %v", configPath, err)
+		} else if err != nil {
+			return config, nil, &CorruptConfigError{Path: configPath, Err: err}
+		}
+		if !rep.warned {
+			for _, key := range warnings {
+				fmt.Printf("Warning: unknown config %s in %s is ignored\n", key, configPath)
+			}
+			rep.warned = true
+		}
+	}
+	legacy, err := legacyLocalConfig()
+	return config, legacy, err
+}
+
+// legacyLocalConfig returns LocalConfig written by older version, which
+// holds settings along with the game name but no version. LocalConfigYAML
+// and LocalConfigTOML are never written by older version
+func legacyLocalConfig() (map[string]string, error) {
+	localPath, err := findLocalConfig()
+	if err != nil || filepath.Base(localPath) != LocalConfig {
+		return nil, err
+	}
+	local, err := readLocalConfig()
+	if err != nil {
+		return nil, err
+	}
+	if local["game_name"] == "" || len(local) == 1 || local["version"] != "" {
+		return nil, nil
+	}
+	return local, nil
+}
+
+// migrateLocalConfig moves settings of LocalConfig written by older
+// version into the game profile it names and writes the global config,
+// only the game name is kept in LocalConfig. Settings of LocalConfig
+// override the profile. It should be called under the config lock
+func migrateLocalConfig(config *Config, local map[string]string) error {
+	gameName := local["game_name"]
+	game, ok := config.Games[gameName]
+	if !ok {
+		game = &GameConfig{}
+		config.Games[gameName] = game
+	}
+	for key, value := range local {
+		if key == "game_name" {
+			continue
+		}
+		if err := game.Set(key, value); err != nil {
+			if configErr, ok := err.(*ConfigError); !ok || configErr.Err != ErrConfigKeyUnknown {
+				return fmt.Errorf("Unable to migrate %s: %v", LocalConfig, err)
+			}
+			fmt.Printf("Warning: unknown config %s in %s is ignored\n", key, LocalConfig)
+		}
+	}
+	if err := writeGlobalConfig(*config); err != nil {
+		return err
+	}
+	configPath, _ := GlobalConfigPath()
+	fmt.Printf("Moved config of %s from %s into %s\n", gameName, LocalConfig, configPath)
+	return writeLocalConfig(map[string]string{"game_name": gameName})
+}
+
+// pointLocalConfig makes LocalConfig select game name if it exists
+func pointLocalConfig(gameName string) error {
+	localPath, err := findLocalConfig()
+	if err != nil || localPath == "" {
+		return err
+	}
+	local, err := readLocalConfig()
+	if err != nil {
+		return err
+	}
+	local["game_name"] = gameName
+	return writeLocalConfig(local)
+}
+
+// findLocalConfig returns path of LocalConfig nearest to the current
+// directory walking up its parents, returns empty path if none exists.
+// LocalConfigYAML and LocalConfigTOML are found as well
+func findLocalConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range localConfigNames {
+			localPath := filepath.Join(dir, name)
+			if _, err = os.Stat(localPath); err == nil {
+				return localPath, nil
+			} else if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// readLocalConfig returns content of the nearest LocalConfig,
+// returns empty config if LocalConfig is not exist
+func readLocalConfig() (map[string]string, error) {
+	config, _, err := loadLocalConfig()
+	return config, err
+}
+
+// loadLocalConfig reads the nearest LocalConfig along with its path,
+// path is empty if there is none
+func loadLocalConfig() (map[string]string, string, error) {
+	config := map[string]string{}
+	localPath, err := findLocalConfig()
+	if err != nil || localPath == "" {
+		return config, localPath, err
+	}
+	data, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return nil, localPath, err
+	}
+	if config, err = decodeLocalConfig(localPath, data); err != nil {
+		if _, ok := err.(*ConfigError); ok {
+			return nil, localPath, fmt.Errorf("Unable to read %s: %v", localPath, err)
+		}
+		return nil, localPath, &CorruptConfigError{Path: localPath, Err: err}
+	}
+	return config, localPath, nil
+}
+
+func writeGlobalConfig(config Config) error {
+	configPath, err := GlobalConfigPath()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+	byt, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(configPath, byt)
+}
+
+// writeLocalConfig writes the nearest LocalConfig keeping its format
+// and comments, LocalConfig of the current directory if none exists
+func writeLocalConfig(config map[string]string) error {
+	localPath, err := findLocalConfig()
+	if err != nil {
+		return err
+	}
+	var original []byte
+	if localPath == "" {
+		localPath = LocalConfig
+	} else if original, err = ioutil.ReadFile(localPath); err != nil {
+		return err
+	}
+	config["version"] = strconv.Itoa(ConfigVersion)
+	byt, err := encodeLocalConfig(localPath, original, config)
+	if err != nil {
+		return fmt.Errorf("Unable to write %s: %v", localPath, err)
+	}
+	return writeFileAtomic(localPath, byt)
+}
+
+// configEnv returns name of environment variable overriding config key
+// of the global config
+func configEnv(key string) string {
+	return "GAMESAVE_" + strings.ToUpper(key)
+}
+
+// envGameConfig returns config set by environment variables named by
+// configEnv, save paths can not be set by environment variables
+func envGameConfig() (*GameConfig, error) {
+	game := &GameConfig{}
+	for key := range configFields {
+		value := os.Getenv(configEnv(key))
+		if value == "" {
+			continue
+		}
+		if err := game.Set(key, value); err != nil {
+			return nil, &ConfigError{Field: configEnv(key), Err: errors.Unwrap(err)}
+		}
+	}
+	return game, nil
+}
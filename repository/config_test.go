@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("migrate flat config", func(t *testing.T) {
+		data := []byte(`{"active_game": "game", "games": {"game": {
+			"save_path": "./saves", "save_path.memcard": "./memcard",
+			"max_files": "20", "storage": "archive", "unknown": "value"}}}`)
+		config, warnings, err := parseConfig(data)
+		assertNotError(t, err)
+		if config.Version != ConfigVersion {
+			t.Errorf("Got version %d expect %d", config.Version, ConfigVersion)
+		}
+		game := config.Games["game"]
+		assertEqual(t, game.SavePaths["default"], "./saves")
+		assertEqual(t, game.SavePaths["memcard"], "./memcard")
+		assertEqual(t, game.Storage, "archive")
+		if game.MaxFiles == nil || *game.MaxFiles != 20 {
+			t.Errorf("Got %v max_files expect 20", game.MaxFiles)
+		}
+		if len(warnings) != 1 || warnings[0] != "games.game.unknown" {
+			t.Errorf("Got %v expect [games.game.unknown]", warnings)
+		}
+	})
+
+	t.Run("warn unknown keys", func(t *testing.T) {
+		data := []byte(`{"version": 1, "theme": "dark", "games": {"game": {"playtime": 3}}}`)
+		_, warnings, err := parseConfig(data)
+		assertNotError(t, err)
+		if len(warnings) != 2 || warnings[0] != "games.game.playtime" || warnings[1] != "theme" {
+			t.Errorf("Got %v expect [games.game.playtime theme]", warnings)
+		}
+	})
+
+	invalid := map[string]string{
+		`{"version": 1, "games": {"game": {"max_files": "20"}}}`:        "games.game.max_files",
+		`{"version": 1, "games": {"game": {"growth_warning": -1}}}`:     "games.game.growth_warning",
+		`{"version": 1, "games": {"game": {"symlinks": "copy"}}}`:       "games.game.symlinks",
+		`{"version": 1, "games": {"game": {"storage": "zip"}}}`:         "games.game.storage",
+		`{"version": 1, "games": {"game": {"max_size": "lots"}}}`:       "games.game.max_size",
+		`{"version": 1, "active_game": "other", "games": {}}`:           "active_game",
+		`{"games": {"game": {"confirm_threshold": "many"}}}`:            "games.game.confirm_threshold",
+		`{"version": 2, "games": {}}`:                                   "version",
+		`{"version": 1, "games": {"game": {"machines": {"deck": {}}}}}`: "games.game.machines",
+		`{"version": 1, "defaults": {"hooks": {"pre_play": "true"}}}`:   "defaults.hooks.pre_play",
+	}
+	for data, field := range invalid {
+		t.Run("name invalid field "+field, func(t *testing.T) {
+			_, _, err := parseConfig([]byte(data))
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Got %v expect ConfigError", err)
+			}
+			assertEqual(t, configErr.Field, field)
+		})
+	}
+}
+
+func TestGameConfig(t *testing.T) {
+	t.Run("set and list config keys", func(t *testing.T) {
+		game := &GameConfig{}
+		for key, value := range map[string]string{
+			"save_path": "./saves", "save_path.memcard": "./memcard",
+			"max_size": "200MB", "confirm_threshold": "0",
+		} {
+			err := game.Set(key, value)
+			assertNotError(t, err)
+		}
+		values := game.Values()
+		if len(values) != 4 {
+			t.Errorf("Got %v expect 4 values", values)
+		}
+		assertEqual(t, game.Get("confirm_threshold"), "0")
+		assertEqual(t, game.Get("growth_warning"), "")
+		game.Set("save_path.memcard", "")
+		if _, ok := game.SavePaths["memcard"]; ok {
+			t.Error("Should remove save location")
+		}
+		data, _ := json.Marshal(game)
+		assertEqual(t, string(data), `{"save_paths":{"default":"./saves"},"max_size":"200MB","confirm_threshold":0}`)
+	})
+
+	t.Run("set save path mapped to machine", func(t *testing.T) {
+		game := &GameConfig{}
+		err := game.Set("save_path.memcard@deck", "<home>/memcard")
+		assertNotError(t, err)
+		assertEqual(t, game.Machines["deck"]["memcard"], "<home>/memcard")
+		assertEqual(t, game.Values()["save_path.memcard@deck"], "<home>/memcard")
+		game.Set("save_path.memcard@deck", "")
+		if len(game.Machines) != 0 {
+			t.Errorf("Got %v expect no machine", game.Machines)
+		}
+		err = game.Set("storage@deck", "archive")
+		if !errors.Is(err, ErrConfigKeyUnknown) {
+			t.Errorf("Got %v expect %v", err, ErrConfigKeyUnknown)
+		}
+	})
+
+	t.Run("set hook commands", func(t *testing.T) {
+		game := &GameConfig{}
+		err := game.Set("pre_save", "notify-send saving")
+		assertNotError(t, err)
+		assertEqual(t, game.Values()["pre_save"], "notify-send saving")
+		data, _ := json.Marshal(game)
+		assertEqual(t, string(data), `{"hooks":{"pre_save":"notify-send saving"}}`)
+		game.Set("pre_save", "")
+		assertEqual(t, game.Get("pre_save"), "")
+	})
+
+	t.Run("refuse invalid value", func(t *testing.T) {
+		game := &GameConfig{}
+		err := game.Set("max_files", "-1")
+		if configErr, ok := err.(*ConfigError); !ok || configErr.Field != "max_files" {
+			t.Errorf("Got %v expect ConfigError of max_files", err)
+		}
+		err = game.Set("storage", "zip")
+		if configErr, ok := err.(*ConfigError); !ok || configErr.Field != "storage" || configErr.Err != ErrStorageInvalid {
+			t.Errorf("Got %v expect ConfigError of storage", err)
+		}
+		err = game.Set("playtime", "3")
+		if !errors.Is(err, ErrConfigKeyUnknown) {
+			t.Errorf("Got %v expect %v", err, ErrConfigKeyUnknown)
+		}
+	})
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"0":      0,
+		"500":    500,
+		"200MB":  200 << 20,
+		"1.5GiB": 3 << 29,
+		"64 k":   64 << 10,
+	}
+	for value, want := range cases {
+		got, err := ParseSize(value)
+		assertNotError(t, err)
+		if got != want {
+			t.Errorf("Got %d expect %d for %s", got, want, value)
+		}
+	}
+	for _, value := range []string{"", "-1", "1TB", "MB", "5I", "1e9"} {
+		if _, err := ParseSize(value); err != ErrSizeInvalid {
+			t.Errorf("Should refuse %s", value)
+		}
+	}
+}
+
+func TestScopeConfig(t *testing.T) {
+	t.Run("merge global, game and local config", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		rep.SetConfig("game_name", "game")
+		err := rep.SetScopeConfig(ScopeGlobal, "growth_warning", "5")
+		assertNotError(t, err)
+		rep.SetScopeConfig(ScopeGlobal, "max_files", "100")
+		rep.SetScopeConfig(ScopeGame, "max_files", "200")
+		rep.SetScopeConfig(ScopeGame, "save_path", "./saves")
+		err = rep.SetScopeConfig(ScopeLocal, "save_path", "./local")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, &rep, "growth_warning"), "5")
+		assertEqual(t, getConfig(t, &rep, "max_files"), "200")
+		assertEqual(t, getConfig(t, &rep, "save_path"), "./local")
+		game, err := rep.ListScopeConfig(ScopeGame)
+		assertNotError(t, err)
+		assertEqual(t, game["save_path"], "./saves")
+		assertEqual(t, getLocalConfig(t, "game_name"), "game")
+		rep.SetScopeConfig(ScopeLocal, "save_path", "")
+		assertEqual(t, getConfig(t, &rep, "save_path"), "./saves")
+	})
+
+	t.Run("ignore local config of another game", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		rep.SetConfig("game_name", "game1")
+		rep.SetScopeConfig(ScopeLocal, "storage", "archive")
+		rep.SetConfig("game_name", "game2")
+		addLocalConfig(t, "game_name", "game1")
+		rep.SelectGame("game2")
+		assertEqual(t, getConfig(t, &rep, "storage"), "")
+	})
+
+	t.Run("resolve save path mapped to this machine", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		t.Setenv(MachineEnv, "deck")
+		rep.SetConfig("game_name", "game")
+		rep.SetScopeConfig(ScopeGame, "save_path", "./saves")
+		rep.SetScopeConfig(ScopeGame, "save_path@deck", "<home>/deck")
+		rep.SetScopeConfig(ScopeGame, "save_path@vm", "/srv/saves")
+		config, err := rep.ListConfig()
+		assertNotError(t, err)
+		assertEqual(t, config["save_path"], "<home>/deck")
+		if len(config) != 2 {
+			t.Errorf("Got %v expect save_path and game_name only", config)
+		}
+		rep.SetScopeConfig(ScopeLocal, "save_path", "./local")
+		assertEqual(t, getConfig(t, &rep, "save_path"), "./local")
+	})
+
+	t.Run("refuse save path in global config", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		err := rep.SetScopeConfig(ScopeGlobal, "save_path.memcard", "./memcard")
+		assertError(t, err)
+		err = rep.SetScopeConfig(ScopeGlobal, "save_path@deck", "./saves")
+		assertError(t, err)
+		err = rep.SetScopeConfig(ScopeGlobal, "playtime", "3")
+		if !errors.Is(err, ErrConfigKeyUnknown) {
+			t.Errorf("Got %v expect %v", err, ErrConfigKeyUnknown)
+		}
+	})
+}
+
+func TestConfigDiscovery(t *testing.T) {
+	t.Run("find local config in parent directory", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		rep.SetConfig("game_name", "game")
+		rep.SetScopeConfig(ScopeLocal, "storage", "archive")
+		localPath, _ := filepath.Abs(LocalConfig)
+		os.MkdirAll("test_dir/saves", 0755)
+		wd, _ := os.Getwd()
+		os.Chdir("test_dir/saves")
+		t.Cleanup(func() {
+			os.Chdir(wd)
+			os.RemoveAll("test_dir")
+		})
+		assertEqual(t, getConfig(t, &rep, "game_name"), "game")
+		assertEqual(t, getConfig(t, &rep, "storage"), "archive")
+		err := rep.SetScopeConfig(ScopeLocal, "growth_warning", "3")
+		assertNotError(t, err)
+		if _, err = os.Stat(LocalConfig); !os.IsNotExist(err) {
+			t.Errorf("Local config should be written to %s", localPath)
+		}
+		configs, err := rep.ListConfigOrigins()
+		assertNotError(t, err)
+		assertEqual(t, configs["growth_warning"].Origin, "local "+localPath)
+		assertEqual(t, configs["game_name"].Origin, "local "+localPath)
+	})
+
+	t.Run("read and write local config by its format", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		data := "# shared with dotfiles\ngame_name: game\ninclude: [saves/**] # slots\n"
+		ioutil.WriteFile(LocalConfigYAML, []byte(data), 0644)
+		t.Cleanup(func() { os.Remove(LocalConfigYAML) })
+		assertEqual(t, getConfig(t, &rep, "include"), "saves/**")
+		err := rep.SetScopeConfig(ScopeLocal, "include", "saves/**,*.cfg")
+		assertNotError(t, err)
+		written, _ := ioutil.ReadFile(LocalConfigYAML)
+		want := "# shared with dotfiles\ngame_name: game\ninclude: [saves/**, '*.cfg'] # slots\nversion: 1\n"
+		assertEqual(t, string(written), want)
+		assertEqual(t, getConfig(t, &rep, "include"), "saves/**,*.cfg")
+	})
+
+	t.Run("name local config of its format in errors", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+		ioutil.WriteFile(LocalConfigTOML, []byte("game_name = \"game\"\ntheme = \"dark\"\n"), 0644)
+		t.Cleanup(func() { os.Remove(LocalConfigTOML) })
+		_, _, err := rep.GetConfig("storage")
+		assertNotError(t, err)
+		if !rep.localWarned {
+			t.Error("Should warn unknown key once")
+		}
+		ioutil.WriteFile(LocalConfigTOML, []byte("game_name = \"game\"\nmax_files = \"many\"\n"), 0644)
+		_, _, err = rep.GetConfig("storage")
+		if err == nil || !strings.Contains(err.Error(), LocalConfigTOML) {
+			t.Errorf("Got %v expect error naming %s", err, LocalConfigTOML)
+		}
+	})
+
+	t.Run("merge local config over global config and environment", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		rep.SetConfig("game_name", "game")
+		rep.SetScopeConfig(ScopeGlobal, "max_files", "100")
+		rep.SetScopeConfig(ScopeGlobal, "growth_warning", "5")
+		rep.SetScopeConfig(ScopeLocal, "max_files", "300")
+		t.Setenv("GAMESAVE_MAX_FILES", "200")
+		t.Setenv("GAMESAVE_GROWTH_WARNING", "7")
+		configs, err := rep.ListConfigOrigins()
+		assertNotError(t, err)
+		configPath, _ := GlobalConfigPath()
+		localPath, _ := filepath.Abs(LocalConfig)
+		assertEqual(t, configs["max_files"].Value, "300")
+		assertEqual(t, configs["max_files"].Origin, "local "+localPath)
+		assertEqual(t, configs["growth_warning"].Value, "7")
+		assertEqual(t, configs["growth_warning"].Origin, "env GAMESAVE_GROWTH_WARNING")
+		rep.SelectGame("game")
+		configs, _ = rep.ListConfigOrigins()
+		assertEqual(t, configs["game_name"].Origin, "flag --game")
+		t.Setenv("GAMESAVE_GROWTH_WARNING", "-1")
+		_, err = rep.ListConfigOrigins()
+		assertError(t, err)
+		t.Setenv("GAMESAVE_GROWTH_WARNING", "")
+		configs, _ = rep.ListConfigOrigins()
+		assertEqual(t, configs["growth_warning"].Origin, "global "+configPath)
+	})
+}
+
+func TestInitRoot(t *testing.T) {
+	defaultRoot := GameSaveRoot
+	t.Cleanup(func() { SetRoot(defaultRoot) })
+
+	t.Run("select root by flag, env then config", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		err := rep.SetScopeConfig(ScopeGlobal, "root", "/media/sd/gamesave")
+		assertNotError(t, err)
+		err = rep.InitRoot("")
+		assertNotError(t, err)
+		assertEqual(t, GameSaveRoot, "/media/sd/gamesave")
+		assertEqual(t, BackupRoot, "/media/sd/gamesave_backup")
+		t.Setenv(RootEnv, "/data/gamesave")
+		rep.InitRoot("")
+		assertEqual(t, GameSaveRoot, "/data/gamesave")
+		rep.InitRoot("/mnt/portable/")
+		assertEqual(t, GameSaveRoot, "/mnt/portable")
+	})
+
+	t.Run("default to home directory", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		t.Setenv(RootEnv, "")
+		t.Setenv("HOME", "/home/mock")
+		err := rep.InitRoot("")
+		assertNotError(t, err)
+		assertEqual(t, GameSaveRoot, "/home/mock/.gamesave")
+	})
+
+	t.Run("refuse root outside global config", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		rep.SetConfig("game_name", "game")
+		err := rep.SetScopeConfig(ScopeGame, "root", "/data/gamesave")
+		assertError(t, err)
+	})
+}
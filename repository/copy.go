@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SymlinkPolicy decides how symbolic links inside a save folder
+// are handled by CopyTree and ListFiles
+type SymlinkPolicy string
+
+// TreeFilter selects entries of a save folder handled by CopyTree,
+// EncryptTree, ListFiles and PackArchive. A file is selected if it
+// matches one of Include patterns, or there is none, and matches no
+// Exclude pattern. Pattern without "/" matches name of the file or of
+// any directory above it, pattern with "/" matches the path relative
+// to the save folder or any directory above it
+type TreeFilter struct {
+	Links   SymlinkPolicy
+	Include []string
+	Exclude []string
+}
+
+const (
+	// SymlinkFollow copies the file or directory a link points to
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkPreserve copies the link itself
+	SymlinkPreserve SymlinkPolicy = "preserve"
+	// SymlinkSkip ignores every link
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// ParseSymlinkPolicy converts value into SymlinkPolicy,
+// empty value means SymlinkPreserve
+func ParseSymlinkPolicy(value string) (SymlinkPolicy, error) {
+	switch SymlinkPolicy(value) {
+	case "":
+		return SymlinkPreserve, nil
+	case SymlinkFollow, SymlinkPreserve, SymlinkSkip:
+		return SymlinkPolicy(value), nil
+	}
+	return "", fmt.Errorf("Unknown symlinks policy '%s', use follow, preserve or skip", value)
+}
+
+// ValidatePattern returns error if pattern of TreeFilter is malformed
+func ValidatePattern(pattern string) error {
+	if pattern == "" || strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("Pattern '%s' should be relative to save folder", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("Pattern '%s' is malformed", pattern)
+	}
+	return nil
+}
+
+// Selects checks whether file rel, slash separated path relative
+// to the save folder, is selected by the filter
+func (f TreeFilter) Selects(rel string) bool {
+	if f.excludes(rel) {
+		return false
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f TreeFilter) excludes(rel string) bool {
+	for _, pattern := range f.Exclude {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern checks whether pattern matches rel or any directory above it
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	byName := !strings.Contains(pattern, "/")
+	for p := rel; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		target := p
+		if byName {
+			target = path.Base(p)
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// treeEntry is a file, directory or preserved link visited by walkTree.
+// Rel is slash separated path relative to the walked root, Source is
+// the real path to read from and Target is the real path a preserved
+// link points to
+type treeEntry struct {
+	Rel    string
+	Source string
+	Target string
+	Info   os.FileInfo
+}
+
+// CopyTree copies files of directory src selected by filter into dst
+// handling symbolic links by filter.Links policy. src itself is always
+// resolved. Links pointing outside src and, when followed, links creating
+// a loop are refused. Regular files keep their permission and modification time
+func (rep *OSRepository) CopyTree(src, dst string, filter TreeFilter) error {
+	return walkTree(src, filter, func(entry treeEntry) error {
+		target := filepath.Join(dst, filepath.FromSlash(entry.Rel))
+		switch {
+		case entry.Info.IsDir():
+			return os.MkdirAll(target, entry.Info.Mode().Perm()|0700)
+		case entry.Info.Mode()&os.ModeSymlink != 0:
+			link, err := filepath.Rel(filepath.Dir(entry.Source), entry.Target)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		default:
+			return copyFile(entry.Source, target, entry.Info)
+		}
+	})
+}
+
+// walkTree visits root and every entry below it selected by filter in
+// lexical order. Directories are visited before their content, excluded
+// directories and special files such as sockets and devices are not visited
+func walkTree(root string, filter TreeFilter, fn func(treeEntry) error) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(realRoot)
+	if err != nil {
+		return err
+	}
+	walker := treeWalker{root: realRoot, filter: filter, visit: fn}
+	entry := treeEntry{Rel: ".", Source: realRoot, Info: info}
+	if !info.IsDir() {
+		return fn(entry)
+	}
+	return walker.walkDir(entry, map[string]bool{})
+}
+
+type treeWalker struct {
+	root   string
+	filter TreeFilter
+	visit  func(treeEntry) error
+}
+
+func (w *treeWalker) walkDir(dir treeEntry, ancestors map[string]bool) error {
+	if ancestors[dir.Source] {
+		return fmt.Errorf("Symbolic link %s creates a loop", w.display(dir.Rel))
+	}
+	ancestors[dir.Source] = true
+	defer delete(ancestors, dir.Source)
+	err := w.visit(dir)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(dir.Source)
+	if err != nil {
+		return err
+	}
+	names, err := file.Readdirnames(-1)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := treeEntry{
+			Rel:    joinRel(dir.Rel, name),
+			Source: filepath.Join(dir.Source, name),
+		}
+		entry.Info, err = os.Lstat(entry.Source)
+		if err != nil {
+			return err
+		}
+		if w.filter.excludes(entry.Rel) {
+			continue
+		}
+		if entry.Info.Mode()&os.ModeSymlink != 0 {
+			err = w.walkLink(entry, ancestors)
+		} else if entry.Info.IsDir() {
+			err = w.walkDir(entry, ancestors)
+		} else if entry.Info.Mode().IsRegular() {
+			err = w.visitFile(entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *treeWalker) walkLink(link treeEntry, ancestors map[string]bool) error {
+	if w.filter.Links == SymlinkSkip {
+		return nil
+	}
+	target, err := filepath.EvalSymlinks(link.Source)
+	if err != nil {
+		return fmt.Errorf("Symbolic link %s is broken", w.display(link.Rel))
+	}
+	if !isInside(w.root, target) {
+		return fmt.Errorf("Symbolic link %s points outside save folder", w.display(link.Rel))
+	}
+	if w.filter.Links == SymlinkPreserve {
+		link.Target = target
+		return w.visitFile(link)
+	}
+	link.Source = target
+	link.Info, err = os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if link.Info.IsDir() {
+		return w.walkDir(link, ancestors)
+	}
+	return w.visitFile(link)
+}
+
+// visitFile visits file or preserved link if it is selected by the filter
+func (w *treeWalker) visitFile(entry treeEntry) error {
+	if !w.filter.Selects(entry.Rel) {
+		return nil
+	}
+	return w.visit(entry)
+}
+
+func (w *treeWalker) display(rel string) string {
+	return filepath.Join(w.root, filepath.FromSlash(rel))
+}
+
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	os.Remove(dst)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// isInside checks whether p is root or inside root
+func isInside(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func joinRel(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
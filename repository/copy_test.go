@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	t.Run("follow links inside save folder", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkFollow})
+		assertNotError(t, err)
+		assertRegularFile(t, filepath.Join(dst, "latest.save"))
+		assertRegularFile(t, filepath.Join(dst, "current", "slot1.save"))
+	})
+
+	t.Run("preserve links inside save folder", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkPreserve})
+		assertNotError(t, err)
+		link, err := os.Readlink(filepath.Join(dst, "latest.save"))
+		assertNotError(t, err)
+		assertEqual(t, link, filepath.Join("slots", "slot1.save"))
+		assertSameContent(t, filepath.Join(dst, "current", "slot1.save"), filepath.Join(src, "slots", "slot1.save"))
+	})
+
+	t.Run("skip links inside save folder", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkSkip})
+		assertNotError(t, err)
+		assertRegularFile(t, filepath.Join(dst, "slots", "slot1.save"))
+		if _, err := os.Lstat(filepath.Join(dst, "latest.save")); !os.IsNotExist(err) {
+			t.Error("Link should be skipped")
+		}
+	})
+
+	t.Run("resolve linked save folder", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		linkedSrc := filepath.Join(filepath.Dir(src), "linked")
+		createSymlink(t, src, linkedSrc)
+		err := rep.CopyTree(linkedSrc, dst, TreeFilter{Links: SymlinkPreserve})
+		assertNotError(t, err)
+		assertRegularFile(t, filepath.Join(dst, "slots", "slot1.save"))
+	})
+
+	t.Run("refuse link outside save folder", func(t *testing.T) {
+		for _, links := range []SymlinkPolicy{SymlinkFollow, SymlinkPreserve} {
+			rep := OSRepository{}
+			src, dst := createLinkedSave(t)
+			createDummyFile(t, filepath.Join(filepath.Dir(src), "outside.txt"))
+			createSymlink(t, filepath.Join(filepath.Dir(src), "outside.txt"), filepath.Join(src, "outside"))
+			err := rep.CopyTree(src, dst, TreeFilter{Links: links})
+			assertError(t, err)
+			os.RemoveAll(filepath.Dir(src))
+		}
+	})
+
+	t.Run("skip link outside save folder", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		createSymlink(t, "/", filepath.Join(src, "outside"))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkSkip})
+		assertNotError(t, err)
+	})
+
+	t.Run("refuse loop on follow", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		createSymlink(t, "..", filepath.Join(src, "slots", "parent"))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkFollow})
+		assertError(t, err)
+		err = rep.CopyTree(src, dst+"_preserve", TreeFilter{Links: SymlinkPreserve})
+		assertNotError(t, err)
+	})
+
+	t.Run("keep modification time", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkSkip})
+		assertNotError(t, err)
+		want, _ := os.Stat(filepath.Join(src, "slots", "slot1.save"))
+		got, _ := os.Stat(filepath.Join(dst, "slots", "slot1.save"))
+		if !got.ModTime().Equal(want.ModTime()) {
+			t.Errorf("Got mtime %v expect %v", got.ModTime(), want.ModTime())
+		}
+	})
+}
+
+func TestListFilesSymlinks(t *testing.T) {
+	cases := map[SymlinkPolicy]int{
+		SymlinkFollow:   5,
+		SymlinkPreserve: 2,
+		SymlinkSkip:     2,
+	}
+	for links, want := range cases {
+		t.Run("list files with "+string(links), func(t *testing.T) {
+			rep := OSRepository{}
+			src, _ := createLinkedSave(t)
+			defer os.RemoveAll(filepath.Dir(src))
+			entries, err := rep.ListFiles(src, TreeFilter{Links: links})
+			assertNotError(t, err)
+			if len(entries) != want {
+				t.Errorf("Got %d entries expect %d", len(entries), want)
+			}
+		})
+	}
+}
+
+func TestTreeFilter(t *testing.T) {
+	filter := TreeFilter{
+		Include: []string{"*.save", "profile/settings.ini"},
+		Exclude: []string{"cache", "slots/backup"},
+	}
+	cases := map[string]bool{
+		"slot1.save":                 true,
+		"slots/slot2.save":           true,
+		"profile/settings.ini":       true,
+		"profile/settings.ini/x.txt": true,
+		"profile/controls.ini":       false,
+		"cache/shader.save":          false,
+		"slots/backup/slot1.save":    false,
+		"deep/cache":                 false,
+	}
+	for rel, want := range cases {
+		t.Run("select "+rel, func(t *testing.T) {
+			if got := filter.Selects(rel); got != want {
+				t.Errorf("Got %v expect %v", got, want)
+			}
+		})
+	}
+
+	t.Run("copy selected files", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.CopyTree(src, dst, TreeFilter{Links: SymlinkSkip, Exclude: []string{"slot2.*"}})
+		assertNotError(t, err)
+		assertExist(t, filepath.Join(dst, "slots", "slot1.save"))
+		if rep.Exists(filepath.Join(dst, "slots", "slot2.save")) {
+			t.Error("Should not copy excluded file")
+		}
+	})
+
+	t.Run("validate patterns", func(t *testing.T) {
+		assertNotError(t, ValidatePattern("slots/*.save"))
+		assertError(t, ValidatePattern("/etc/*"))
+		assertError(t, ValidatePattern("slot[1"))
+	})
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	t.Run("parse default policy", func(t *testing.T) {
+		links, err := ParseSymlinkPolicy("")
+		assertNotError(t, err)
+		assertEqual(t, string(links), string(SymlinkPreserve))
+	})
+
+	t.Run("parse unknown policy", func(t *testing.T) {
+		_, err := ParseSymlinkPolicy("copy")
+		assertError(t, err)
+	})
+}
+
+// createLinkedSave creates save folder containing slots/slot1.save,
+// slots/slot2.save, link latest.save to slot1 and link current to slots
+func createLinkedSave(t *testing.T) (string, string) {
+	t.Helper()
+	base, err := ioutil.TempDir("", "gamesave_copy")
+	if err != nil {
+		t.Fatalf("[Helper-createLinkedSave] Error: %v", err)
+	}
+	src := filepath.Join(base, "save")
+	createDummyDirectory(t, filepath.Join(src, "slots"))
+	createDummyFile(t, filepath.Join(src, "slots", "slot1.save"))
+	createDummyFile(t, filepath.Join(src, "slots", "slot2.save"))
+	createSymlink(t, filepath.Join("slots", "slot1.save"), filepath.Join(src, "latest.save"))
+	createSymlink(t, filepath.Join(src, "slots"), filepath.Join(src, "current"))
+	return src, filepath.Join(base, "copy")
+}
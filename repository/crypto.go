@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// KeyFile is path of the encryption key parameters inside GameSaveRoot
+	KeyFile string = ".gamesave-key.json"
+	// KDFKeyFile derives encryption key from content of a key file
+	KDFKeyFile string = "hmac-sha256"
+	// KDFPassphrase derives encryption key from a passphrase
+	KDFPassphrase string = "pbkdf2-sha256"
+
+	encryptedMagic       = "GSENC1"
+	keyLength            = 32
+	maxNameLength        = 255
+	minKeyFileLength     = 16
+	passphraseIterations = 600000
+)
+
+var (
+	// ErrDecrypt represents error if data is not encrypted by the key
+	ErrDecrypt = errors.New("Unable to decrypt data, it is corrupted or encrypted by another key")
+	// ErrKeyFileInvalid represents error if key file is too short to derive a key
+	ErrKeyFileInvalid = errors.New("Key file should contain at least 16 bytes")
+	// ErrKeyInvalid represents error if passphrase or key file does not match the key parameters
+	ErrKeyInvalid = errors.New("Passphrase or key file is wrong")
+	// ErrNameTooLong represents error if encrypted file name exceeds the filesystem limit
+	ErrNameTooLong = fmt.Errorf("File name is too long to encrypt, it should be at most %d bytes", maxPlainNameLength())
+)
+
+// KeyParams describes how the encryption key of a game is derived.
+// It holds no secret and is committed along with the encrypted save
+type KeyParams struct {
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations,omitempty"`
+	Names      bool   `json:"names"`
+	Check      string `json:"check"`
+}
+
+// NewKeyParams instantiate KeyParams with random salt,
+// kdf is either KDFPassphrase or KDFKeyFile
+func NewKeyParams(kdf string, names bool) (KeyParams, error) {
+	params := KeyParams{KDF: kdf, Names: names, Salt: make([]byte, 16)}
+	if kdf == KDFPassphrase {
+		params.Iterations = passphraseIterations
+	}
+	_, err := rand.Read(params.Salt)
+	return params, err
+}
+
+// ParseKeyParams decodes KeyParams from its JSON representation
+func ParseKeyParams(data []byte) (KeyParams, error) {
+	var params KeyParams
+	err := json.Unmarshal(data, &params)
+	return params, err
+}
+
+// Encode encodes KeyParams into its JSON representation
+func (p KeyParams) Encode() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// Init derives the key from secret, records its check value
+// and returns Cipher using the key
+func (p *KeyParams) Init(secret []byte) (*Cipher, error) {
+	key, err := p.deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	p.Check = hex.EncodeToString(hmacSum(key, []byte("gamesave check")))
+	return newCipher(key, p.Names)
+}
+
+// Unlock derives the key from secret and returns Cipher using it,
+// returns ErrKeyInvalid if secret is not the one used by Init
+func (p KeyParams) Unlock(secret []byte) (*Cipher, error) {
+	key, err := p.deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	check := hex.EncodeToString(hmacSum(key, []byte("gamesave check")))
+	if !hmac.Equal([]byte(check), []byte(p.Check)) {
+		return nil, ErrKeyInvalid
+	}
+	return newCipher(key, p.Names)
+}
+
+// EncryptTree encrypts files of directory src selected by filter into
+// dst like CopyTree. Names below src are encrypted too
+// if cipher.Names is set. Encrypted files keep permission and
+// modification time of the plain ones
+func (rep *OSRepository) EncryptTree(src, dst string, filter TreeFilter, cipher *Cipher) error {
+	return walkTree(src, filter, func(entry treeEntry) error {
+		sealed, err := cipher.SealPath(entry.Rel)
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Rel, err)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(sealed))
+		switch {
+		case entry.Info.IsDir():
+			return os.MkdirAll(target, entry.Info.Mode().Perm()|0700)
+		case entry.Info.Mode()&os.ModeSymlink != 0:
+			link, err := filepath.Rel(filepath.Dir(entry.Source), entry.Target)
+			if err == nil {
+				link, err = cipher.SealPath(filepath.ToSlash(link))
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", entry.Rel, err)
+			}
+			os.Remove(target)
+			return os.Symlink(filepath.FromSlash(link), target)
+		}
+		data, err := ioutil.ReadFile(entry.Source)
+		if err != nil {
+			return err
+		}
+		return writeFile(target, cipher.Seal(data), entry.Info)
+	})
+}
+
+// DecryptTree decrypts file or directory src encrypted by EncryptTree into dst
+func (rep *OSRepository) DecryptTree(src, dst string, cipher *Cipher) error {
+	return walkTree(src, TreeFilter{Links: SymlinkPreserve}, func(entry treeEntry) error {
+		rel, err := cipher.OpenPath(entry.Rel)
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Rel, err)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		switch {
+		case entry.Info.IsDir():
+			return os.MkdirAll(target, entry.Info.Mode().Perm()|0700)
+		case entry.Info.Mode()&os.ModeSymlink != 0:
+			link, err := filepath.Rel(filepath.Dir(entry.Source), entry.Target)
+			if err == nil {
+				link, err = cipher.OpenPath(filepath.ToSlash(link))
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", rel, err)
+			}
+			os.Remove(target)
+			return os.Symlink(filepath.FromSlash(link), target)
+		}
+		data, err := ioutil.ReadFile(entry.Source)
+		if err != nil {
+			return err
+		}
+		data, err = cipher.Open(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", rel, err)
+		}
+		return writeFile(target, data, entry.Info)
+	})
+}
+
+func (p KeyParams) deriveKey(secret []byte) ([]byte, error) {
+	switch p.KDF {
+	case KDFPassphrase:
+		return pbkdf2.Key(secret, p.Salt, p.Iterations, keyLength, sha256.New), nil
+	case KDFKeyFile:
+		if len(secret) < minKeyFileLength {
+			return nil, ErrKeyFileInvalid
+		}
+		return hmacSum(p.Salt, secret), nil
+	}
+	return nil, errors.New("Unknown key derivation " + p.KDF)
+}
+
+// Cipher encrypts save data with AES-256-GCM before it enters
+// GameSaveRoot. Nonce is derived from the plaintext, so the same
+// data always gives the same ciphertext and unchanged save is not
+// committed again. Names tells whether file names are encrypted too
+type Cipher struct {
+	Names bool
+	aead  cipher.AEAD
+	nonce []byte
+}
+
+func newCipher(key []byte, names bool) (*Cipher, error) {
+	block, err := aes.NewCipher(hmacSum(key, []byte("gamesave encryption")))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{
+		Names: names,
+		aead:  aead,
+		nonce: hmacSum(key, []byte("gamesave nonce")),
+	}, nil
+}
+
+// Seal encrypts data
+func (c *Cipher) Seal(data []byte) []byte {
+	return append([]byte(encryptedMagic), c.seal(data)...)
+}
+
+// Open decrypts data encrypted by Seal
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return nil, ErrDecrypt
+	}
+	return c.open(data[len(encryptedMagic):])
+}
+
+// SealName encrypts file name into a name safe for any filesystem,
+// the name is kept if Names is false. Returns ErrNameTooLong if
+// the encrypted name exceeds the usual limit of 255 bytes
+func (c *Cipher) SealName(name string) (string, error) {
+	if !c.Names {
+		return name, nil
+	}
+	sealed := base64.RawURLEncoding.EncodeToString(c.seal([]byte(name)))
+	if len(sealed) > maxNameLength {
+		return "", ErrNameTooLong
+	}
+	return sealed, nil
+}
+
+// OpenName decrypts file name encrypted by SealName
+func (c *Cipher) OpenName(name string) (string, error) {
+	if !c.Names {
+		return name, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(name)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	plain, err := c.open(data)
+	if err != nil || strings.ContainsAny(string(plain), "/\\") {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+// SealPath encrypts every name of slash separated relative path,
+// ".." is kept so relative links stay valid
+func (c *Cipher) SealPath(p string) (string, error) {
+	return c.mapPath(p, c.SealName)
+}
+
+// OpenPath decrypts relative path encrypted by SealPath
+func (c *Cipher) OpenPath(p string) (string, error) {
+	return c.mapPath(p, c.OpenName)
+}
+
+func (c *Cipher) mapPath(p string, fn func(string) (string, error)) (string, error) {
+	names := strings.Split(p, "/")
+	for i, name := range names {
+		if name == ".." || name == "." || name == "" {
+			continue
+		}
+		mapped, err := fn(name)
+		if err != nil {
+			return "", err
+		}
+		names[i] = mapped
+	}
+	return strings.Join(names, "/"), nil
+}
+
+// maxPlainNameLength returns the longest file name whose encrypted
+// name, holding nonce and tag of AES-GCM, fits in maxNameLength
+func maxPlainNameLength() int {
+	return maxNameLength*6/8 - 12 - 16
+}
+
+func (c *Cipher) seal(data []byte) []byte {
+	size := c.aead.NonceSize()
+	nonce := hmacSum(c.nonce, data)[:size:size]
+	return c.aead.Seal(nonce, nonce, data, nil)
+}
+
+func (c *Cipher) open(data []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrDecrypt
+	}
+	plain, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func writeFile(dst string, data []byte, info os.FileInfo) error {
+	os.Remove(dst)
+	err := ioutil.WriteFile(dst, data, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testKeyFileContent = []byte("0123456789abcdef0123456789abcdef")
+
+func TestKeyParams(t *testing.T) {
+	t.Run("unlock by the same passphrase", func(t *testing.T) {
+		params, err := NewKeyParams(KDFPassphrase, false)
+		assertNotError(t, err)
+		_, err = params.Init([]byte("secret"))
+		assertNotError(t, err)
+		data, err := params.Encode()
+		assertNotError(t, err)
+		parsed, err := ParseKeyParams(data)
+		assertNotError(t, err)
+		_, err = parsed.Unlock([]byte("secret"))
+		assertNotError(t, err)
+		_, err = parsed.Unlock([]byte("wrong"))
+		if err != ErrKeyInvalid {
+			t.Errorf("Got %v expect %v", err, ErrKeyInvalid)
+		}
+	})
+
+	t.Run("refuse short key file", func(t *testing.T) {
+		params, _ := NewKeyParams(KDFKeyFile, false)
+		_, err := params.Init([]byte("short"))
+		if err != ErrKeyFileInvalid {
+			t.Errorf("Got %v expect %v", err, ErrKeyFileInvalid)
+		}
+	})
+}
+
+func TestCipher(t *testing.T) {
+	t.Run("seal the same data identically", func(t *testing.T) {
+		cipher := createTestCipher(t, false)
+		first := cipher.Seal([]byte("save data"))
+		second := cipher.Seal([]byte("save data"))
+		if !bytes.Equal(first, second) {
+			t.Error("Should produce identical ciphertext")
+		}
+		plain, err := cipher.Open(first)
+		assertNotError(t, err)
+		assertEqual(t, string(plain), "save data")
+	})
+
+	t.Run("open tampered data", func(t *testing.T) {
+		cipher := createTestCipher(t, false)
+		sealed := cipher.Seal([]byte("save data"))
+		sealed[len(sealed)-1] ^= 1
+		_, err := cipher.Open(sealed)
+		if err != ErrDecrypt {
+			t.Errorf("Got %v expect %v", err, ErrDecrypt)
+		}
+	})
+
+	t.Run("seal path keeping parent reference", func(t *testing.T) {
+		cipher := createTestCipher(t, true)
+		sealed, err := cipher.SealPath("../slots/slot1.save")
+		assertNotError(t, err)
+		if filepath.Dir(filepath.Dir(sealed)) != ".." {
+			t.Errorf("Should keep '..', got %s", sealed)
+		}
+		opened, err := cipher.OpenPath(sealed)
+		assertNotError(t, err)
+		assertEqual(t, opened, "../slots/slot1.save")
+	})
+
+	t.Run("refuse name too long to encrypt", func(t *testing.T) {
+		cipher := createTestCipher(t, true)
+		longest := strings.Repeat("a", maxPlainNameLength())
+		sealed, err := cipher.SealName(longest)
+		assertNotError(t, err)
+		if len(sealed) > maxNameLength {
+			t.Errorf("Got name of %d bytes expect at most %d", len(sealed), maxNameLength)
+		}
+		_, err = cipher.SealPath("slots/" + longest + "a")
+		if err != ErrNameTooLong {
+			t.Errorf("Got %v expect %v", err, ErrNameTooLong)
+		}
+		plain := createTestCipher(t, false)
+		_, err = plain.SealName(longest + "a")
+		assertNotError(t, err)
+	})
+}
+
+func TestEncryptTree(t *testing.T) {
+	t.Run("encrypt and decrypt names and content", func(t *testing.T) {
+		rep := OSRepository{}
+		cipher := createTestCipher(t, true)
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		err := rep.EncryptTree(src, dst, TreeFilter{Links: SymlinkPreserve}, cipher)
+		assertNotError(t, err)
+		if rep.Exists(filepath.Join(dst, "slots")) {
+			t.Error("Should encrypt file names")
+		}
+		sealed, _ := cipher.SealPath("slots/slot1.save")
+		data, _ := ioutil.ReadFile(filepath.Join(dst, sealed))
+		original, _ := ioutil.ReadFile(filepath.Join(src, "slots", "slot1.save"))
+		if bytes.Equal(data, original) {
+			t.Error("Should encrypt file content")
+		}
+		plain := filepath.Join(filepath.Dir(src), "plain")
+		err = rep.DecryptTree(dst, plain, cipher)
+		assertNotError(t, err)
+		assertSameContent(t, filepath.Join(plain, "slots", "slot1.save"), filepath.Join(src, "slots", "slot1.save"))
+		link, err := os.Readlink(filepath.Join(plain, "latest.save"))
+		assertNotError(t, err)
+		assertEqual(t, link, filepath.Join("slots", "slot1.save"))
+	})
+
+	t.Run("refuse name too long to encrypt", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		long := strings.Repeat("a", 200) + ".save"
+		ioutil.WriteFile(filepath.Join(src, long), []byte("save data"), 0644)
+		err := rep.EncryptTree(src, dst, TreeFilter{Links: SymlinkSkip}, createTestCipher(t, true))
+		if err == nil || !strings.Contains(err.Error(), long) {
+			t.Errorf("Got %v expect error naming %s", err, long)
+		}
+	})
+
+	t.Run("decrypt by another key", func(t *testing.T) {
+		rep := OSRepository{}
+		src, dst := createLinkedSave(t)
+		defer os.RemoveAll(filepath.Dir(src))
+		rep.EncryptTree(src, dst, TreeFilter{Links: SymlinkSkip}, createTestCipher(t, false))
+		err := rep.DecryptTree(dst, filepath.Join(filepath.Dir(src), "plain"), createTestCipher(t, false))
+		assertError(t, err)
+	})
+}
+
+func TestCreateKeyFile(t *testing.T) {
+	t.Run("create key file once", func(t *testing.T) {
+		rep := OSRepository{}
+		dir, _ := ioutil.TempDir("", "gamesave_key")
+		defer os.RemoveAll(dir)
+		keyPath := filepath.Join(dir, "game.key")
+		err := rep.CreateKeyFile(keyPath)
+		assertNotError(t, err)
+		info, _ := os.Stat(keyPath)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Got mode %v expect 0600", info.Mode().Perm())
+		}
+		err = rep.CreateKeyFile(keyPath)
+		assertError(t, err)
+	})
+}
+
+// createTestCipher returns Cipher derived from a fresh key file salt
+func createTestCipher(t *testing.T, names bool) *Cipher {
+	t.Helper()
+	params, err := NewKeyParams(KDFKeyFile, names)
+	if err != nil {
+		t.Fatalf("[Helper-createTestCipher] Error: %v", err)
+	}
+	cipher, err := params.Init(testKeyFileContent)
+	if err != nil {
+		t.Fatalf("[Helper-createTestCipher] Error: %v", err)
+	}
+	return cipher
+}
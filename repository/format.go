@@ -0,0 +1,456 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrConfigFormat represents error if LocalConfig is not a table of config keys
+	ErrConfigFormat = errors.New("Config should be a table of config keys")
+
+	// localConfigNames are names of LocalConfig in every supported
+	// format, the first one found in a directory is used
+	localConfigNames = []string{LocalConfig, LocalConfigYAML, LocalConfigTOML}
+)
+
+// decodeLocalConfig returns config of LocalConfig data in the format
+// chosen by extension of name, lists are joined by comma
+func decodeLocalConfig(name string, data []byte) (map[string]string, error) {
+	config := map[string]string{}
+	switch filepath.Ext(name) {
+	case ".yaml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			return config, nil
+		}
+		table := doc.Content[0]
+		if table.Kind != yaml.MappingNode {
+			return nil, ErrConfigFormat
+		}
+		for i := 0; i+1 < len(table.Content); i += 2 {
+			value, err := yamlValue(table.Content[i+1])
+			if err != nil {
+				return nil, &ConfigError{Field: table.Content[i].Value, Err: err}
+			}
+			config[table.Content[i].Value] = value
+		}
+	case ".toml":
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range tree.Keys() {
+			value, err := tomlValue(tree.Get(key))
+			if err != nil {
+				return nil, &ConfigError{Field: key, Err: err}
+			}
+			config[key] = value
+		}
+	default:
+		var table map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&table); err != nil {
+			return nil, err
+		}
+		for key, item := range table {
+			value, err := jsonValue(item)
+			if err != nil {
+				return nil, &ConfigError{Field: key, Err: err}
+			}
+			config[key] = value
+		}
+	}
+	return config, nil
+}
+
+// encodeLocalConfig returns data of config in the format chosen by
+// extension of name. Comments and order of keys in original data are
+// kept by YAML and TOML, new keys are appended in order
+func encodeLocalConfig(name string, original []byte, config map[string]string) ([]byte, error) {
+	switch filepath.Ext(name) {
+	case ".yaml":
+		return encodeYAML(original, config)
+	case ".toml":
+		return encodeTOML(original, config)
+	}
+	return encodeJSON(original, config)
+}
+
+// encodeJSON writes every value as string, except values which
+// original data holds as list or number
+func encodeJSON(original []byte, config map[string]string) ([]byte, error) {
+	var table map[string]interface{}
+	if len(bytes.TrimSpace(original)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(original))
+		decoder.UseNumber()
+		if err := decoder.Decode(&table); err != nil {
+			return nil, err
+		}
+	}
+	values := map[string]interface{}{}
+	for key, value := range config {
+		values[key] = value
+		field, ok := lookupConfigField(key)
+		switch table[key].(type) {
+		case []interface{}:
+			if ok && field.list {
+				values[key] = splitList(value)
+			}
+		case json.Number:
+			if _, err := strconv.Atoi(value); err == nil && (key == "version" || ok && field.number) {
+				values[key] = json.Number(value)
+			}
+		}
+	}
+	return json.MarshalIndent(values, "", "  ")
+}
+
+func encodeYAML(original []byte, config map[string]string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(original, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	table := doc.Content[0]
+	if table.Kind != yaml.MappingNode {
+		return nil, ErrConfigFormat
+	}
+	written := map[string]bool{}
+	content := []*yaml.Node{}
+	for i := 0; i+1 < len(table.Content); i += 2 {
+		key, value := table.Content[i], table.Content[i+1]
+		if _, ok := config[key.Value]; !ok || written[key.Value] {
+			continue
+		}
+		node := yamlNode(key.Value, config[key.Value])
+		if node.Kind == value.Kind {
+			node.Style = value.Style
+		}
+		if node.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode {
+			keepItemComments(node, value)
+		}
+		node.HeadComment, node.LineComment, node.FootComment = value.HeadComment, value.LineComment, value.FootComment
+		content = append(content, key, node)
+		written[key.Value] = true
+	}
+	for _, key := range sortedKeys(config) {
+		if !written[key] {
+			content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, yamlNode(key, config[key]))
+		}
+	}
+	table.Content = content
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), encoder.Close()
+}
+
+// encodeTOML rewrites lines of keys in original data, lines of removed
+// keys are dropped and new keys are appended
+func encodeTOML(original []byte, config map[string]string) ([]byte, error) {
+	tree, err := toml.LoadBytes(original)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(original), "\n")
+	starts := map[int]string{}
+	for _, key := range tree.Keys() {
+		starts[tree.GetPosition(key).Line-1] = key
+	}
+	written := map[string]bool{}
+	result := []string{}
+	for i := 0; i < len(lines); i++ {
+		key, ok := starts[i]
+		if !ok {
+			result = append(result, lines[i])
+			continue
+		}
+		end, comment := tomlValueEnd(lines, i)
+		if _, keep := config[key]; keep && !written[key] {
+			field, _ := lookupConfigField(key)
+			if field.list && end > i {
+				result = append(result, tomlMultilineList(key, config[key], lines[i:end+1], comment)...)
+			} else {
+				line := key + " = " + tomlLiteral(key, config[key])
+				if comment != "" {
+					line += " " + comment
+				}
+				result = append(result, line)
+			}
+			written[key] = true
+		}
+		i = end
+	}
+	for len(result) > 0 && strings.TrimSpace(result[len(result)-1]) == "" {
+		result = result[:len(result)-1]
+	}
+	for _, key := range sortedKeys(config) {
+		if !written[key] {
+			result = append(result, key+" = "+tomlLiteral(key, config[key]))
+		}
+	}
+	return []byte(strings.Join(result, "\n") + "\n"), nil
+}
+
+// tomlValueEnd returns index of the last line of value whose key is on
+// line start along with comment following the value
+func tomlValueEnd(lines []string, start int) (int, string) {
+	depth, quote := 0, byte(0)
+	line := lines[start]
+	i := strings.Index(line, "=") + 1
+	for n := start; n < len(lines); n, i = n+1, 0 {
+		line = lines[n]
+		for ; i < len(line); i++ {
+			switch c := line[i]; {
+			case quote != 0:
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			case c == '#':
+				if depth == 0 {
+					return n, strings.TrimSpace(line[i:])
+				}
+				i = len(line)
+			}
+		}
+		if depth <= 0 {
+			return n, ""
+		}
+	}
+	return len(lines) - 1, ""
+}
+
+// tomlMultilineList returns lines of list key written one item per
+// line like original lines of its value, items kept from original
+// lines keep their comments and comment follows the closing bracket
+func tomlMultilineList(key, value string, original []string, comment string) []string {
+	indent, comments := "  ", map[string]string{}
+	for _, line := range original[1:] {
+		literal, itemComment := tomlItem(line)
+		if literal == "" {
+			continue
+		}
+		if trimmed := strings.TrimLeft(line, " \t"); len(trimmed) < len(line) {
+			indent = line[:len(line)-len(trimmed)]
+		}
+		if tree, err := toml.Load("item = " + literal); err == nil {
+			if item, ok := tree.Get("item").(string); ok && itemComment != "" {
+				comments[item] = itemComment
+			}
+		}
+	}
+	lines := []string{key + " = ["}
+	for _, item := range splitList(value) {
+		line := indent + tomlString(item) + ","
+		if comments[item] != "" {
+			line += " " + comments[item]
+		}
+		lines = append(lines, line)
+	}
+	closing := "]"
+	if comment != "" {
+		closing += " " + comment
+	}
+	return append(lines, closing)
+}
+
+// tomlItem returns the first string literal on line of a list along
+// with comment following it
+func tomlItem(line string) (string, string) {
+	literal := ""
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '#':
+			return literal, strings.TrimSpace(line[i:])
+		case (c == '"' || c == '\'') && literal == "":
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if c == '"' && line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return "", ""
+			}
+			literal = line[i : end+1]
+			i = end
+		case c == '"' || c == '\'':
+			// another item on the same line, comment can not be told apart
+			return literal, ""
+		}
+	}
+	return literal, ""
+}
+
+// tomlLiteral returns value of config key written in TOML
+func tomlLiteral(key, value string) string {
+	field, ok := lookupConfigField(key)
+	if key == "version" || ok && field.number {
+		if _, err := strconv.Atoi(value); err == nil {
+			return value
+		}
+	}
+	if ok && field.list {
+		items := []string{}
+		for _, item := range splitList(value) {
+			items = append(items, tomlString(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return tomlString(value)
+}
+
+func tomlString(value string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&builder, "\\u%04X", r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+func tomlValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return "", errors.New("Should be a list of strings")
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("Should be a string, number or list of strings")
+}
+
+func jsonValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return value.String(), nil
+		}
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return "", errors.New("Should be a list of strings")
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("Should be a string, number or list of strings")
+}
+
+// yamlNode returns value of config key as YAML node
+func yamlNode(key, value string) *yaml.Node {
+	if field, ok := lookupConfigField(key); ok && field.list {
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range splitList(value) {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+		}
+		return node
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// keepItemComments copies style and comments of every item of original
+// list to the item of node having the same value
+func keepItemComments(node, original *yaml.Node) {
+	items := map[string]*yaml.Node{}
+	for _, item := range original.Content {
+		items[item.Value] = item
+	}
+	for _, item := range node.Content {
+		if old, ok := items[item.Value]; ok {
+			item.Style = old.Style
+			item.HeadComment, item.LineComment, item.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		}
+	}
+}
+
+func yamlValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := []string{}
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", errors.New("Should be a list of strings")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("Should be a string, number or list of strings")
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sortedKeys(config map[string]string) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
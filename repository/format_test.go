@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocalConfigFormat(t *testing.T) {
+	t.Run("keep comments of YAML", func(t *testing.T) {
+		original := "# selected game\ngame_name: game # name of profile\nexclude:\n  - \"*.log\" # logs\n  - cache/**\nstorage: archive\n"
+		config, err := decodeLocalConfig(LocalConfigYAML, []byte(original))
+		assertNotError(t, err)
+		assertEqual(t, config["exclude"], "*.log,cache/**")
+		delete(config, "storage")
+		config["exclude"] = "*.log,cache/**,*.tmp"
+		config["max_files"] = "3"
+		data, err := encodeLocalConfig(LocalConfigYAML, []byte(original), config)
+		assertNotError(t, err)
+		want := "# selected game\ngame_name: game # name of profile\nexclude:\n  - \"*.log\" # logs\n  - cache/**\n  - '*.tmp'\nmax_files: 3\n"
+		assertEqual(t, string(data), want)
+	})
+
+	t.Run("keep comments of TOML", func(t *testing.T) {
+		original := "# selected game\ngame_name = \"game\" # name of profile\nexclude = [\n  \"*.log\", # logs\n  \"cache/**\",\n]\nstorage = \"archive\"\n"
+		config, err := decodeLocalConfig(LocalConfigTOML, []byte(original))
+		assertNotError(t, err)
+		assertEqual(t, config["exclude"], "*.log,cache/**")
+		delete(config, "storage")
+		config["exclude"] = "*.log,*.tmp"
+		config["max_files"] = "3"
+		data, err := encodeLocalConfig(LocalConfigTOML, []byte(original), config)
+		assertNotError(t, err)
+		want := "# selected game\ngame_name = \"game\" # name of profile\nexclude = [\n  \"*.log\", # logs\n  \"*.tmp\",\n]\nmax_files = 3\n"
+		assertEqual(t, string(data), want)
+	})
+
+	t.Run("read lists and numbers of JSON", func(t *testing.T) {
+		original := `{"game_name": "game", "exclude": ["*.log", "cache/**"], "max_files": 3, "storage": "archive"}`
+		config, err := decodeLocalConfig(LocalConfig, []byte(original))
+		assertNotError(t, err)
+		assertEqual(t, config["exclude"], "*.log,cache/**")
+		assertEqual(t, config["max_files"], "3")
+		config["exclude"] = "*.tmp"
+		config["include"] = "saves/**"
+		data, err := encodeLocalConfig(LocalConfig, []byte(original), config)
+		assertNotError(t, err)
+		written, err := decodeLocalConfig(LocalConfig, data)
+		assertNotError(t, err)
+		for key, value := range config {
+			assertEqual(t, written[key], value)
+		}
+		if !strings.Contains(string(data), `"exclude": [`) || !strings.Contains(string(data), `"max_files": 3`) {
+			t.Errorf("Should keep list and number of JSON, got %s", data)
+		}
+		_, err = decodeLocalConfig(LocalConfig, []byte(`{"exclude": [{"path": "*.log"}]}`))
+		assertError(t, err)
+	})
+
+	t.Run("refuse nested tables", func(t *testing.T) {
+		_, err := decodeLocalConfig(LocalConfigTOML, []byte("[notes]\ntext = \"game\"\n"))
+		assertError(t, err)
+		_, err = decodeLocalConfig(LocalConfigYAML, []byte("- game\n"))
+		assertError(t, err)
+	})
+}
@@ -1,25 +1,48 @@
 package repository
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
-	"os/user"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
+	// ErrBranchNotExist represents error if branch has no commit yet
+	ErrBranchNotExist = errors.New("Branch has no commit yet")
+	// ErrFileNotExist represents error if file has not been committed on branch
+	ErrFileNotExist = errors.New("File is not exist on branch")
+	// ErrRemoteBranchNotExist represents error if branch has not been pushed to remote
+	ErrRemoteBranchNotExist = errors.New("Branch is not exist on remote")
+	// ErrRemoteNotFetched represents error if remote branch has commits not fetched yet
+	ErrRemoteNotFetched = errors.New("Remote branch has commits not fetched yet")
+
+	// BackupRoot is path to local-only backups of game's save data,
+	// it is never committed nor pushed to remote
+	BackupRoot string
 	// GameSaveRoot is path to gamesave local Git repository
 	GameSaveRoot string
 )
 
+// init uses ~/.gamesave as GameSaveRoot, roots are left empty
+// if home directory is unknown until InitRoot or SetRoot is called
 func init() {
-	usr, err := user.Current()
-	if err != nil {
-		panic(err)
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		SetRoot(path.Join(home, ".gamesave"))
 	}
-	GameSaveRoot = path.Join(usr.HomeDir, ".gamesave")
+}
+
+// SetRoot sets GameSaveRoot to root and BackupRoot next to it,
+// so every root keeps its own backups
+func SetRoot(root string) {
+	GameSaveRoot = path.Clean(root)
+	BackupRoot = GameSaveRoot + "_backup"
 }
 
 // IGitRepository is interface for interaction with files
@@ -27,18 +50,36 @@ func init() {
 type IGitRepository interface {
 	Checkout(branch string) error
 	Commit(message string) error
+	CommitFile(branch, file string, data []byte, message string) error
+	CompareRemote(branch string) (ahead, behind int, err error)
 	Clone(repoURL string) error
 	FetchBranch(branch string) error
+	FetchRemote(branch string) (string, error)
 	GetCurrentBranch() (string, error)
 	GetRepoURL() (string, error)
+	HasChanges() (bool, error)
+	LastCommit(branch string) (CommitInfo, error)
+	ListTree(branch string) ([]string, error)
+	MergeBase(rev, other string) (string, error)
+	PeekRemote(branch string) (rev string, ahead, behind int, err error)
 	Pull(branch string) error
 	Push(branch string) error
+	PushBranch(branch string) error
+	SetBranch(branch, rev string) error
 	SetRepoURL(repoURL string) error
+	ShowFile(branch, file string) ([]byte, error)
 }
 
 // GitRepository is the implementation of IGitRepository
 type GitRepository struct{}
 
+// CommitInfo describes a commit of a branch
+type CommitInfo struct {
+	Hash    string
+	Time    time.Time
+	Message string
+}
+
 // Checkout change branch of Git repository
 func (g *GitRepository) Checkout(branch string) error {
 	cmd := exec.Command("git", "checkout", "-B", branch)
@@ -72,6 +113,48 @@ func (g *GitRepository) Commit(message string) error {
 	return err
 }
 
+// CommitFile commits data as file on branch without checking it out,
+// so the working tree and the current branch are left untouched.
+// The branch is created if it does not exist
+func (g *GitRepository) CommitFile(branch, file string, data []byte, message string) error {
+	index, err := ioutil.TempFile("", "gamesave-index")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	parent, err := runGit(env, nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	if err == nil {
+		if _, err = runGit(env, nil, "read-tree", parent); err != nil {
+			return err
+		}
+	}
+	blob, err := runGit(env, data, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	_, err = runGit(env, nil, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+file)
+	if err != nil {
+		return err
+	}
+	tree, err := runGit(env, nil, "write-tree")
+	if err != nil {
+		return err
+	}
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := runGit(env, nil, args...)
+	if err != nil {
+		return err
+	}
+	_, err = runGit(env, nil, "update-ref", "refs/heads/"+branch, commit)
+	return err
+}
+
 // Clone download repository from remote on repoURL
 func (g *GitRepository) Clone(repoURL string) error {
 	cmd := exec.Command("git", "clone", repoURL, GameSaveRoot)
@@ -84,6 +167,73 @@ func (g *GitRepository) Clone(repoURL string) error {
 	return err
 }
 
+// CompareRemote fetches branch from remote without updating local
+// branches, then counts commits of the local branch missing on remote
+// and commits of remote missing on the local branch. Every remote
+// commit is counted as behind if the local branch is not exist
+func (g *GitRepository) CompareRemote(branch string) (ahead, behind int, err error) {
+	if _, err = runGit(nil, nil, "fetch", "--quiet", "origin", "refs/heads/"+branch); err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			return 0, 0, ErrRemoteBranchNotExist
+		}
+		return 0, 0, err
+	}
+	return countCommits(branch, "FETCH_HEAD")
+}
+
+// PeekRemote compares branch with remote like CompareRemote without
+// fetching, so the repository is left unchanged. Commit of remote
+// branch is returned as rev, ErrRemoteNotFetched is returned if
+// the commit has not been fetched yet
+func (g *GitRepository) PeekRemote(branch string) (rev string, ahead, behind int, err error) {
+	output, err := runGit(nil, nil, "ls-remote", "--exit-code", "origin", "refs/heads/"+branch)
+	if err != nil {
+		// ls-remote exits with 2 if remote has no matching ref
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+			return "", 0, 0, ErrRemoteBranchNotExist
+		}
+		return "", 0, 0, err
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", 0, 0, fmt.Errorf("Unexpected output of git ls-remote: %s", output)
+	}
+	rev = fields[0]
+	if _, err = runGit(nil, nil, "cat-file", "-e", rev+"^{commit}"); err != nil {
+		return "", 0, 0, ErrRemoteNotFetched
+	}
+	ahead, behind, err = countCommits(branch, rev)
+	return rev, ahead, behind, err
+}
+
+// countCommits counts commits of the local branch missing on rev and
+// commits of rev missing on the local branch. Every commit of rev is
+// counted as behind if the local branch is not exist
+func countCommits(branch, rev string) (ahead, behind int, err error) {
+	local := "refs/heads/" + branch
+	if _, err = runGit(nil, nil, "rev-parse", "--verify", "--quiet", local); err != nil {
+		count, err := runGit(nil, nil, "rev-list", "--count", rev)
+		if err != nil {
+			return 0, 0, err
+		}
+		behind, err = strconv.Atoi(count)
+		return 0, behind, err
+	}
+	counts, err := runGit(nil, nil, "rev-list", "--left-right", "--count", local+"..."+rev)
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("Unexpected output of git rev-list: %s", counts)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	behind, err = strconv.Atoi(fields[1])
+	return ahead, behind, err
+}
+
 // FetchBranch fetch specific branch from remote
 func (g *GitRepository) FetchBranch(branch string) error {
 	cmd := exec.Command(
@@ -100,6 +250,18 @@ func (g *GitRepository) FetchBranch(branch string) error {
 	return err
 }
 
+// FetchRemote fetches branch from remote without updating local
+// branches and returns hash of the fetched commit
+func (g *GitRepository) FetchRemote(branch string) (string, error) {
+	if _, err := runGit(nil, nil, "fetch", "--quiet", "origin", "refs/heads/"+branch); err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			return "", ErrRemoteBranchNotExist
+		}
+		return "", err
+	}
+	return runGit(nil, nil, "rev-parse", "FETCH_HEAD")
+}
+
 // GetCurrentBranch get current active branch
 func (g *GitRepository) GetCurrentBranch() (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
@@ -122,6 +284,78 @@ func (g *GitRepository) GetRepoURL() (string, error) {
 	return strings.TrimSpace(string(output)), err
 }
 
+// HasChanges checks whether working tree has uncommitted changes
+func (g *GitRepository) HasChanges() (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = GameSaveRoot
+	output, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) != "", nil
+}
+
+// LastCommit returns the latest commit of local branch,
+// ErrBranchNotExist is returned if branch has no commit yet
+func (g *GitRepository) LastCommit(branch string) (CommitInfo, error) {
+	output, err := runGit(nil, nil, "log", "-1", "--format=%H%n%ct%n%B", "refs/heads/"+branch, "--")
+	if err != nil {
+		// quiet rev-parse fails without message only if the branch is missing
+		_, verifyErr := runGit(nil, nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+		if _, missing := verifyErr.(*exec.ExitError); missing {
+			return CommitInfo{}, ErrBranchNotExist
+		}
+		return CommitInfo{}, err
+	}
+	lines := strings.SplitN(output, "\n", 3)
+	if len(lines) < 2 {
+		return CommitInfo{}, fmt.Errorf("Unexpected output of git log: %s", output)
+	}
+	seconds, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+	info := CommitInfo{Hash: lines[0], Time: time.Unix(seconds, 0)}
+	if len(lines) == 3 {
+		info.Message = lines[2]
+	}
+	return info, nil
+}
+
+// ListTree lists path of every file committed on branch,
+// symbolic links are not listed like ListFiles
+func (g *GitRepository) ListTree(branch string) ([]string, error) {
+	cmd := exec.Command("git", "ls-tree", "-r", "-z", branch)
+	cmd.Dir = GameSaveRoot
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range strings.Split(string(output), "\x00") {
+		fields := strings.SplitN(entry, "\t", 2)
+		if len(fields) == 2 && !strings.HasPrefix(fields[0], "120000 ") {
+			files = append(files, fields[1])
+		}
+	}
+	return files, nil
+}
+
+// MergeBase returns hash of the best common ancestor of rev and
+// other, empty if they have no common history
+func (g *GitRepository) MergeBase(rev, other string) (string, error) {
+	cmd := exec.Command("git", "merge-base", rev, other)
+	cmd.Dir = GameSaveRoot
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && len(exitErr.Stderr) == 0 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // Pull download repository from remote on specific branch
 func (g *GitRepository) Pull(branch string) error {
 	err := g.Checkout(branch)
@@ -156,6 +390,21 @@ func (g *GitRepository) Push(branch string) error {
 	return err
 }
 
+// PushBranch uploads branch to remote without checking it out,
+// so the working tree and the current branch are left untouched
+func (g *GitRepository) PushBranch(branch string) error {
+	ref := "refs/heads/" + branch
+	_, err := runGit(nil, nil, "push", "--quiet", "origin", ref+":"+ref)
+	return err
+}
+
+// SetBranch points branch to commit rev without checking it out,
+// the branch is created if it does not exist
+func (g *GitRepository) SetBranch(branch, rev string) error {
+	_, err := runGit(nil, nil, "update-ref", "refs/heads/"+branch, rev)
+	return err
+}
+
 // SetRepoURL set URL of Git repository
 func (g *GitRepository) SetRepoURL(repoURL string) error {
 	cmd := exec.Command("git", "remote", "set-url", "origin", repoURL)
@@ -168,3 +417,38 @@ func (g *GitRepository) SetRepoURL(repoURL string) error {
 	}
 	return err
 }
+
+// ShowFile reads content of file committed on branch,
+// ErrFileNotExist is returned if branch or file does not exist
+func (g *GitRepository) ShowFile(branch, file string) ([]byte, error) {
+	object := fmt.Sprintf("%s:%s", branch, file)
+	cmd := exec.Command("git", "show", object)
+	cmd.Dir = GameSaveRoot
+	output, err := cmd.Output()
+	if err != nil {
+		if _, verifyErr := runGit(nil, nil, "rev-parse", "--verify", "--quiet", object); verifyErr != nil {
+			return nil, ErrFileNotExist
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// runGit runs git command inside GameSaveRoot with env added to the
+// environment and stdin as input, returns its trimmed output
+func runGit(env []string, stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = GameSaveRoot
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", errors.New(string(exitErr.Stderr))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
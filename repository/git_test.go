@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"os"
 	"os/exec"
 	"path"
 	"strings"
@@ -95,6 +96,111 @@ func TestCommit(t *testing.T) {
 	})
 }
 
+func TestCommitFile(t *testing.T) {
+	t.Run("commit file on another branch", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		branch := gitCurrentBranchName(t)
+		err := gitRepo.CommitFile("catalog", "catalog.json", []byte("first"), "first")
+		assertNotError(t, err)
+		err = gitRepo.CommitFile("catalog", "catalog.json", []byte("second"), "second")
+		assertNotError(t, err)
+		content, err := gitRepo.ShowFile("catalog", "catalog.json")
+		assertNotError(t, err)
+		assertEqual(t, string(content), "second")
+		content, err = gitRepo.ShowFile("catalog~1", "catalog.json")
+		assertNotError(t, err)
+		assertEqual(t, string(content), "first")
+		assertEqual(t, gitCurrentBranchName(t), branch)
+		changed, _ := gitRepo.HasChanges()
+		if changed {
+			t.Error("Should not change working tree")
+		}
+	})
+
+	t.Run("commit file without repository", func(t *testing.T) {
+		deleteLocalRepo(t)
+		gitRepo := GitRepository{}
+		err := gitRepo.CommitFile("catalog", "catalog.json", []byte("data"), "data")
+		assertError(t, err)
+	})
+}
+
+func TestCompareRemote(t *testing.T) {
+	t.Run("compare local branch with remote", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		branch := gitCurrentBranchName(t)
+		remote := path.Join(t.TempDir(), "remote.git")
+		gitIn(t, GameSaveRoot, "init", "--bare", remote)
+		gitIn(t, GameSaveRoot, "remote", "add", "origin", remote)
+		gitIn(t, GameSaveRoot, "push", "--quiet", "origin", branch)
+		ahead, behind, err := gitRepo.CompareRemote(branch)
+		assertNotError(t, err)
+		if ahead != 0 || behind != 0 {
+			t.Errorf("Got ahead %d behind %d expect up to date", ahead, behind)
+		}
+		other := path.Join(t.TempDir(), "other")
+		gitIn(t, GameSaveRoot, "clone", "--quiet", "--branch", branch, remote, other)
+		gitIn(t, other, "commit", "--quiet", "--allow-empty", "-m", "other machine")
+		gitIn(t, other, "push", "--quiet", "origin", branch)
+		gitIn(t, GameSaveRoot, "commit", "--quiet", "--allow-empty", "-m", "this machine")
+		ahead, behind, err = gitRepo.CompareRemote(branch)
+		assertNotError(t, err)
+		if ahead != 1 || behind != 1 {
+			t.Errorf("Got ahead %d behind %d expect diverged by one", ahead, behind)
+		}
+		commit, err := gitRepo.LastCommit(branch)
+		assertNotError(t, err)
+		assertEqual(t, commit.Message, "this machine")
+		_, err = gitRepo.LastCommit("never_pushed")
+		if err != ErrBranchNotExist {
+			t.Errorf("Got %v expect %v", err, ErrBranchNotExist)
+		}
+		_, _, err = gitRepo.CompareRemote("never_pushed")
+		if err != ErrRemoteBranchNotExist {
+			t.Errorf("Got %v expect %v", err, ErrRemoteBranchNotExist)
+		}
+	})
+}
+
+func TestPushBranch(t *testing.T) {
+	t.Run("push and fetch branch without checking it out", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		branch := gitCurrentBranchName(t)
+		remote := path.Join(t.TempDir(), "remote.git")
+		gitIn(t, GameSaveRoot, "init", "--bare", remote)
+		gitIn(t, GameSaveRoot, "remote", "add", "origin", remote)
+		_, err := gitRepo.FetchRemote("catalog")
+		if err != ErrRemoteBranchNotExist {
+			t.Errorf("Got %v expect %v", err, ErrRemoteBranchNotExist)
+		}
+		gitRepo.CommitFile("catalog", "catalog.json", []byte("first"), "first")
+		err = gitRepo.PushBranch("catalog")
+		assertNotError(t, err)
+		assertEqual(t, gitCurrentBranchName(t), branch)
+		first, err := gitRepo.FetchRemote("catalog")
+		assertNotError(t, err)
+		local, _ := gitRepo.LastCommit("catalog")
+		assertEqual(t, first, local.Hash)
+		gitRepo.CommitFile("catalog", "catalog.json", []byte("second"), "second")
+		base, err := gitRepo.MergeBase("catalog", first)
+		assertNotError(t, err)
+		assertEqual(t, base, first)
+		err = gitRepo.SetBranch("catalog", first)
+		assertNotError(t, err)
+		content, _ := gitRepo.ShowFile("catalog", "catalog.json")
+		assertEqual(t, string(content), "first")
+	})
+}
+
 func TestClone(t *testing.T) {
 	t.Run("clone on normal condition", func(t *testing.T) {
 		gitRepo := GitRepository{}
@@ -184,6 +290,60 @@ func TestGetRepoURL(t *testing.T) {
 	})
 }
 
+func TestHasChanges(t *testing.T) {
+	t.Run("check clean working tree", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		changed, err := gitRepo.HasChanges()
+		assertNotError(t, err)
+		if changed {
+			t.Error("Should have no changes")
+		}
+	})
+
+	t.Run("check modified working tree", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		changed, err := gitRepo.HasChanges()
+		assertNotError(t, err)
+		if !changed {
+			t.Error("Should have changes")
+		}
+	})
+
+	t.Run("check repo not set", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		cleanLocalRepo(t)
+		_, err := gitRepo.HasChanges()
+		assertError(t, err)
+	})
+}
+
+func TestListTree(t *testing.T) {
+	t.Run("list committed files", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyDirectory(t, path.Join(GameSaveRoot, "game"))
+		createDummyFile(t, path.Join(GameSaveRoot, "game", "slot 1.save"))
+		createDummyFile(t, path.Join(GameSaveRoot, "top.save"))
+		createSymlink(t, "top.save", path.Join(GameSaveRoot, "latest.save"))
+		gitAddAndCommit(t)
+		files, err := gitRepo.ListTree("HEAD")
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(files, ","), "game/slot 1.save,top.save")
+	})
+
+	t.Run("list inexists branch", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		_, err := gitRepo.ListTree("wrong_branch")
+		assertError(t, err)
+	})
+}
+
 func TestPull(t *testing.T) {
 	t.Run("pull on normal condition", func(t *testing.T) {
 		gitRepo := GitRepository{}
@@ -261,6 +421,33 @@ func TestPush(t *testing.T) {
 	})
 }
 
+func TestShowFile(t *testing.T) {
+	t.Run("show committed file", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		content, err := gitRepo.ShowFile("HEAD", "new_game.save")
+		assertNotError(t, err)
+		assertEqual(t, string(content), "this is dummy file\n")
+	})
+
+	t.Run("show inexists file", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		_, err := gitRepo.ShowFile("HEAD", "wrong.save")
+		if err != ErrFileNotExist {
+			t.Errorf("Got %v expect %v", err, ErrFileNotExist)
+		}
+		_, err = gitRepo.ShowFile("no_branch", "new_game.save")
+		if err != ErrFileNotExist {
+			t.Errorf("Got %v expect %v", err, ErrFileNotExist)
+		}
+	})
+}
+
 func TestSetRepoURL(t *testing.T) {
 	t.Run("set repo url on normal condition", func(t *testing.T) {
 		gitRepo := GitRepository{}
@@ -277,3 +464,40 @@ func TestSetRepoURL(t *testing.T) {
 		assertError(t, err) // .git inexsist
 	})
 }
+
+func TestPeekRemote(t *testing.T) {
+	t.Run("compare with remote without fetching", func(t *testing.T) {
+		gitRepo := GitRepository{}
+		initLocalRepo(t)
+		createDummyFile(t, path.Join(GameSaveRoot, "new_game.save"))
+		gitAddAndCommit(t)
+		branch := gitCurrentBranchName(t)
+		remote := path.Join(t.TempDir(), "remote.git")
+		gitIn(t, GameSaveRoot, "init", "--bare", remote)
+		gitIn(t, GameSaveRoot, "remote", "add", "origin", remote)
+		_, _, _, err := gitRepo.PeekRemote(branch)
+		if err != ErrRemoteBranchNotExist {
+			t.Errorf("Got %v expect %v", err, ErrRemoteBranchNotExist)
+		}
+		gitIn(t, GameSaveRoot, "push", "--quiet", "origin", branch)
+		pushed, _ := gitRepo.LastCommit(branch)
+		gitIn(t, GameSaveRoot, "commit", "--quiet", "--allow-empty", "-m", "this machine")
+		rev, ahead, behind, err := gitRepo.PeekRemote(branch)
+		assertNotError(t, err)
+		assertEqual(t, rev, pushed.Hash)
+		if ahead != 1 || behind != 0 {
+			t.Errorf("Got ahead %d behind %d expect ahead by one", ahead, behind)
+		}
+		other := path.Join(t.TempDir(), "other")
+		gitIn(t, GameSaveRoot, "clone", "--quiet", "--branch", branch, remote, other)
+		gitIn(t, other, "commit", "--quiet", "--allow-empty", "-m", "other machine")
+		gitIn(t, other, "push", "--quiet", "origin", branch)
+		_, _, _, err = gitRepo.PeekRemote(branch)
+		if err != ErrRemoteNotFetched {
+			t.Errorf("Got %v expect %v", err, ErrRemoteNotFetched)
+		}
+		if _, err = os.Stat(path.Join(GameSaveRoot, ".git", "FETCH_HEAD")); !os.IsNotExist(err) {
+			t.Error("Should not fetch remote branch")
+		}
+	})
+}
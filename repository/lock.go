@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// ErrConfigLocked represents error if config is locked by another process for too long
+	ErrConfigLocked = errors.New("Config is locked by another gamesave process, try again later")
+
+	configLockTimeout = 10 * time.Second
+	configLockRetry   = 50 * time.Millisecond
+)
+
+// CorruptConfigError represents error if config file on Path can not be parsed
+type CorruptConfigError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptConfigError) Error() string {
+	return fmt.Sprintf("Config file %s is corrupt, fix or remove it: %v", e.Path, e.Err)
+}
+
+func (e *CorruptConfigError) Unwrap() error {
+	return e.Err
+}
+
+// lockConfig takes advisory lock of the global config and LocalConfig
+// shared by every gamesave process until unlock is called. Config
+// should be read after the lock is taken so no update is lost. The
+// lock is reentrant within the repository
+func (rep *OSRepository) lockConfig() (unlock func(), err error) {
+	unlock = func() {
+		if rep.locks--; rep.locks == 0 {
+			rep.lock.Close()
+			rep.lock = nil
+		}
+	}
+	if rep.locks > 0 {
+		rep.locks++
+		return unlock, nil
+	}
+	configPath, err := GlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(configPath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for deadline := time.Now().Add(configLockTimeout); ; time.Sleep(configLockRetry) {
+		locked, err := tryLockFile(file)
+		if err != nil || !locked && time.Now().After(deadline) {
+			file.Close()
+			if err == nil {
+				err = ErrConfigLocked
+			}
+			return nil, err
+		}
+		if locked {
+			break
+		}
+	}
+	rep.lock, rep.locks = file, 1
+	return unlock, nil
+}
+
+// writeFileAtomic writes data into a temporary file beside path then
+// renames it to path, so path is never left partially written. Mode
+// of the existing file is kept, new file is readable by everyone
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
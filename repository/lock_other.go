@@ -0,0 +1,18 @@
+//go:build !windows
+
+package repository
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes exclusive flock of file without waiting,
+// returns false if another process holds it
+func tryLockFile(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
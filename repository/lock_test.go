@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockConfig(t *testing.T) {
+	t.Run("keep every concurrent update", func(t *testing.T) {
+		removeLocalConfig(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rep := OSRepository{}
+				if err := rep.SetConfig("game_name", fmt.Sprintf("game%d", i)); err != nil {
+					t.Errorf("Shouldn't show error. Error: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		rep := OSRepository{}
+		names, err := rep.ListGames()
+		assertNotError(t, err)
+		if len(names) != 8 {
+			t.Errorf("Got %v expect 8 games", names)
+		}
+		configPath, _ := GlobalConfigPath()
+		files, _ := ioutil.ReadDir(filepath.Dir(configPath))
+		for _, file := range files {
+			if strings.Contains(file.Name(), ".tmp") {
+				t.Errorf("Temporary file %s should be renamed", file.Name())
+			}
+		}
+	})
+
+	t.Run("migrate legacy local config once", func(t *testing.T) {
+		removeLocalConfig(t)
+		ioutil.WriteFile(LocalConfig, []byte(`{"game_name": "game", "storage": "archive"}`), 0644)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rep := OSRepository{}
+				configs, err := rep.ListScopeConfig(ScopeEffective)
+				if err != nil {
+					t.Errorf("Shouldn't show error. Error: %v", err)
+				} else if configs["storage"] != "archive" {
+					t.Errorf("Got storage %q expect archive", configs["storage"])
+				}
+			}()
+		}
+		wg.Wait()
+		rep := OSRepository{}
+		local, err := readLocalConfig()
+		assertNotError(t, err)
+		if local["game_name"] != "game" || local["storage"] != "" {
+			t.Errorf("Got %v expect game_name without storage", local)
+		}
+		config, err := rep.readGlobalConfig()
+		assertNotError(t, err)
+		if game := config.Games["game"]; game == nil || game.Storage != "archive" {
+			t.Errorf("Got %v expect storage archive in game", game)
+		}
+	})
+
+	t.Run("keep mode of replaced file", func(t *testing.T) {
+		removeLocalConfig(t)
+		rep := OSRepository{}
+		assertNotError(t, rep.SetScopeConfig(ScopeGlobal, "max_files", "3"))
+		configPath, _ := GlobalConfigPath()
+		os.Chmod(configPath, 0600)
+		assertNotError(t, rep.SetScopeConfig(ScopeGlobal, "max_files", "4"))
+		info, err := os.Stat(configPath)
+		assertNotError(t, err)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Got mode %v expect %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+	})
+
+	t.Run("fail if lock is held too long", func(t *testing.T) {
+		removeLocalConfig(t)
+		defaultTimeout := configLockTimeout
+		configLockTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { configLockTimeout = defaultTimeout })
+		holder := OSRepository{}
+		unlock, err := holder.lockConfig()
+		assertNotError(t, err)
+		nested, err := holder.lockConfig()
+		assertNotError(t, err)
+		nested()
+		rep := OSRepository{}
+		err = rep.SetScopeConfig(ScopeGlobal, "max_files", "3")
+		if !errors.Is(err, ErrConfigLocked) {
+			t.Errorf("Got %v expect %v", err, ErrConfigLocked)
+		}
+		unlock()
+		err = rep.SetScopeConfig(ScopeGlobal, "max_files", "3")
+		assertNotError(t, err)
+	})
+
+	t.Run("report corrupt config", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		configPath, _ := GlobalConfigPath()
+		os.MkdirAll(filepath.Dir(configPath), 0755)
+		ioutil.WriteFile(configPath, []byte(`{"version": 1, "games": {`), 0644)
+		_, err := rep.ListScopeConfig(ScopeEffective)
+		var corrupt *CorruptConfigError
+		if !errors.As(err, &corrupt) || corrupt.Path != configPath {
+			t.Errorf("Got %v expect corrupt %s", err, configPath)
+		}
+		os.Remove(configPath)
+		ioutil.WriteFile(LocalConfig, []byte{}, 0644)
+		_, err = rep.ListScopeConfig(ScopeLocal)
+		if !errors.As(err, &corrupt) {
+			t.Errorf("Got %v expect corrupt %s", err, LocalConfig)
+		}
+	})
+}
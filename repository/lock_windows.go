@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	errorLockViolation      syscall.Errno = 33
+	lockfileExclusiveLock                 = 2
+	lockfileFailImmediately               = 1
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// tryLockFile takes exclusive lock of the first byte of file without
+// waiting, returns false if another process holds it
+func tryLockFile(file *os.File) (bool, error) {
+	var overlapped syscall.Overlapped
+	ok, _, err := procLockFileEx.Call(
+		file.Fd(), lockfileExclusiveLock|lockfileFailImmediately,
+		0, 1, 0, uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if ok != 0 {
+		return true, nil
+	}
+	if err == errorLockViolation {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// ManifestFile is path of the checksum manifest inside GameSaveRoot
+	ManifestFile string = ".gamesave-manifest.json"
+)
+
+// Manifest records checksum of every file in a save snapshot,
+// keyed by slash separated path relative to GameSaveRoot
+type Manifest struct {
+	Files map[string]ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is the checksum, size and modification time of a file
+type ManifestEntry struct {
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// NewManifest instantiate empty Manifest
+func NewManifest() Manifest {
+	return Manifest{Files: map[string]ManifestEntry{}}
+}
+
+// Encode encodes Manifest into its JSON representation
+func (m Manifest) Encode() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// ParseManifest decodes Manifest from its JSON representation
+func ParseManifest(data []byte) (Manifest, error) {
+	manifest := NewManifest()
+	err := json.Unmarshal(data, &manifest)
+	if manifest.Files == nil {
+		manifest.Files = map[string]ManifestEntry{}
+	}
+	return manifest, err
+}
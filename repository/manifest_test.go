@@ -0,0 +1,25 @@
+package repository
+
+import "testing"
+
+func TestParseManifest(t *testing.T) {
+	t.Run("parse valid manifest", func(t *testing.T) {
+		data := []byte(`{"files": {"game/slot1": {"sha256": "abc", "size": 3}}}`)
+		manifest, err := ParseManifest(data)
+		assertNotError(t, err)
+		assertEqual(t, manifest.Files["game/slot1"].SHA256, "abc")
+	})
+
+	t.Run("parse manifest without files", func(t *testing.T) {
+		manifest, err := ParseManifest([]byte(`{}`))
+		assertNotError(t, err)
+		if manifest.Files == nil {
+			t.Error("Files should be initialized")
+		}
+	})
+
+	t.Run("parse invalid manifest", func(t *testing.T) {
+		_, err := ParseManifest([]byte(`{"files": [`))
+		assertError(t, err)
+	})
+}
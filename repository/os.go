@@ -1,29 +1,103 @@
 package repository
 
 import (
-	"encoding/json"
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
-	// LocalConfig is path to gamesave local Git repository
+	// LocalConfig is path to config selecting game of the current directory
 	LocalConfig string = ".gamesave.json"
+	// LocalConfigTOML is LocalConfig written in TOML
+	LocalConfigTOML string = ".gamesave.toml"
+	// LocalConfigYAML is LocalConfig written in YAML
+	LocalConfigYAML string = ".gamesave.yaml"
 )
 
+// FileEntry describes a regular file found by ListFiles
+type FileEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
 // IOSRepository is interface for interaction with local files
 // include configuration files
 type IOSRepository interface {
+	AbsPath(path string) (string, error)
+	Confirm(prompt string) (bool, error)
 	Copy(src, dst string) error
-	GetConfig(key string) string
+	CopyTree(src, dst string, filter TreeFilter) error
+	CreateKeyFile(path string) error
+	DecryptTree(src, dst string, cipher *Cipher) error
+	EncryptTree(src, dst string, filter TreeFilter, cipher *Cipher) error
+	Exists(path string) bool
+	ExpandPath(template string) (string, error)
+	GetConfig(key string) (string, bool, error)
+	GetEnv(key string) string
+	HashFile(path string) (string, error)
+	InitRoot(root string) error
+	ListDir(path string) ([]string, error)
+	ListConfig() (map[string]string, error)
+	ListConfigOrigins() (map[string]ConfigValue, error)
+	ListFiles(root string, filter TreeFilter) ([]FileEntry, error)
+	ListGames() ([]string, error)
+	ListScopeConfig(scope ConfigScope) (map[string]string, error)
+	MachineID() (string, error)
+	MakeDir(path string) error
+	PackArchive(src, dst string, filter TreeFilter) error
+	ReadFile(path string) ([]byte, error)
+	ReadManifest(path string) (Manifest, error)
+	ReadPassphrase(prompt, env string) (string, error)
+	Remove(path string) error
+	Rename(src, dst string) error
+	ResolvePath(path string) (string, error)
+	RunCommand(command string, env []string) error
+	SelectGame(name string) string
 	SetConfig(key, value string) error
+	SetScopeConfig(scope ConfigScope, key, value string) error
+	UnpackArchive(src, dst string) error
+	UseGame(name string) error
+	WriteFile(path string, data []byte) error
+	WriteManifest(path string, manifest Manifest) error
+}
+
+// OSRepository is the implementation of IOSRepository,
+// config is read from the global config of the selected game
+type OSRepository struct {
+	game        string
+	warned      bool
+	localWarned bool
+	lock        *os.File
+	locks       int
 }
 
-// OSRepository is the implementation of IOSRepository
-type OSRepository struct{}
+// Confirm shows prompt on terminal and returns true if it is answered yes
+func (rep *OSRepository) Confirm(prompt string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("Unable to ask for confirmation, use --yes instead: %v", err)
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "%s [y/N] ", prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return false, err
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
 
 // Copy force copies file or directory from src to dst
 func (rep *OSRepository) Copy(src, dst string) error {
@@ -37,50 +111,219 @@ func (rep *OSRepository) Copy(src, dst string) error {
 	return err
 }
 
-// GetConfig get config by the key from LocalConfig
-// returns empty string if key not exist
-func (rep *OSRepository) GetConfig(key string) string {
-	var config map[string]string
-	data, err := ioutil.ReadFile(LocalConfig)
+// CreateKeyFile writes random key readable only by the owner into path,
+// existing file is never overwritten
+func (rep *OSRepository) CreateKeyFile(path string) error {
+	key := make([]byte, keyLength)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte(hex.EncodeToString(key)))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Exists checks whether file or directory on path is exist
+func (rep *OSRepository) Exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// GetConfig get config by the key of the selected game merged
+// from every scope, found is false if key is not set. Error is
+// returned if config can not be read
+func (rep *OSRepository) GetConfig(key string) (value string, found bool, err error) {
+	config, err := rep.ListScopeConfig(ScopeEffective)
+	if err != nil {
+		return "", false, err
+	}
+	value, found = config[key]
+	return value, found, nil
+}
+
+// GetEnv returns value of environment variable key,
+// returns empty string if it is not set
+func (rep *OSRepository) GetEnv(key string) string {
+	return os.Getenv(key)
+}
+
+// HashFile returns hex encoded SHA-256 checksum of file on path
+func (rep *OSRepository) HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ListDir returns sorted names of entries inside directory path
+func (rep *OSRepository) ListDir(path string) ([]string, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names, nil
+}
+
+// ListConfig returns every config of the selected game merged
+// from every scope, returns empty config if nothing is set
+func (rep *OSRepository) ListConfig() (map[string]string, error) {
+	return rep.ListScopeConfig(ScopeEffective)
+}
+
+// ListFiles returns every regular file under root sorted by path,
+// the path of each entry is relative to root and slash separated.
+// Files are selected by filter like CopyTree,
+// preserved links are not listed
+func (rep *OSRepository) ListFiles(root string, filter TreeFilter) ([]FileEntry, error) {
+	entries := []FileEntry{}
+	err := walkTree(root, filter, func(entry treeEntry) error {
+		if !entry.Info.Mode().IsRegular() {
+			return nil
+		}
+		entries = append(entries, FileEntry{
+			Path:    entry.Rel,
+			Size:    entry.Info.Size(),
+			ModTime: entry.Info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// MakeDir creates directory on path along with its parents
+func (rep *OSRepository) MakeDir(path string) error {
+	return os.MkdirAll(path, 0755)
+}
+
+// ReadFile returns content of file on path
+func (rep *OSRepository) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+// ReadManifest reads Manifest from file on path
+func (rep *OSRepository) ReadManifest(path string) (Manifest, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		fmt.Printf("Error on get config: %v", err)
-		return ""
+		return NewManifest(), err
+	}
+	return ParseManifest(data)
+}
+
+// ReadPassphrase returns value of environment variable env if it is set,
+// otherwise shows prompt and reads passphrase from terminal without echo
+func (rep *OSRepository) ReadPassphrase(prompt, env string) (string, error) {
+	if value, ok := os.LookupEnv(env); ok {
+		return value, nil
 	}
-	err = json.Unmarshal(data, &config)
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
-		fmt.Printf("Error on get config: %v", err)
-		return ""
+		return "", fmt.Errorf("Unable to read passphrase, set %s instead: %v", env, err)
 	}
-	if val, ok := config[key]; ok {
-		return val
+	defer tty.Close()
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = tty
+		return cmd.Run()
 	}
-	return ""
+	fmt.Fprint(tty, prompt)
+	if err := stty("-echo"); err != nil {
+		return "", err
+	}
+	defer fmt.Fprintln(tty)
+	defer stty("echo")
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Remove deletes file or directory on path recursively,
+// does nothing if path is not exist
+func (rep *OSRepository) Remove(path string) error {
+	return os.RemoveAll(path)
+}
+
+// Rename moves file or directory from src to dst,
+// both should be on the same filesystem
+func (rep *OSRepository) Rename(src, dst string) error {
+	return os.Rename(src, dst)
+}
+
+// RunCommand runs command line by the shell of this system with env
+// added to the environment, the command shares input and output of
+// this process
+func (rep *OSRepository) RunCommand(command string, env []string) error {
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
 
-// SetConfig set config by the key from LocalConfig
-// overwrite value of existing key
+// SetConfig set config by the key of the selected game
+// overwrite value of existing key. Setting "game_name" adds the game
+// if it is not exist and makes it the active game, LocalConfig is
+// pointed to it too if it exists
 func (rep *OSRepository) SetConfig(key, value string) error {
-	var config map[string]string
-	err := createIfNotExist()
+	if key != "game_name" {
+		return rep.SetScopeConfig(ScopeGame, key, value)
+	}
+	if value == "" {
+		return ErrGameNotSelected
+	}
+	unlock, err := rep.lockConfig()
 	if err != nil {
 		return err
 	}
-	data, err := ioutil.ReadFile(LocalConfig)
+	defer unlock()
+	config, err := rep.readGlobalConfig()
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(data, &config)
-	if err != nil {
+	if _, ok := config.Games[value]; !ok {
+		config.Games[value] = &GameConfig{}
+	}
+	config.ActiveGame = value
+	if err = writeGlobalConfig(config); err != nil {
 		return err
 	}
-	config[key] = value
-	byt, err := json.MarshalIndent(config, "", "  ")
-	return ioutil.WriteFile(LocalConfig, byt, 0644)
+	return pointLocalConfig(value)
 }
 
-func createIfNotExist() error {
-	if _, err := os.Stat(LocalConfig); os.IsNotExist(err) {
-		return ioutil.WriteFile(LocalConfig, []byte("{}"), 0644)
+// WriteFile writes data into file on path
+func (rep *OSRepository) WriteFile(path string, data []byte) error {
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// WriteManifest writes Manifest into file on path
+func (rep *OSRepository) WriteManifest(path string, manifest Manifest) error {
+	byt, err := manifest.Encode()
+	if err != nil {
+		return err
 	}
-	return nil
+	return ioutil.WriteFile(path, byt, 0644)
 }
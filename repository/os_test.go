@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"errors"
+	"io/ioutil"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -56,21 +59,40 @@ func TestGetConfig(t *testing.T) {
 		rep := OSRepository{}
 		initLocalConfig(t)
 		addLocalConfig(t, "game_name", "game")
-		gameName := rep.GetConfig("game_name")
+		gameName, found, err := rep.GetConfig("game_name")
+		assertNotError(t, err)
 		assertEqual(t, gameName, "game")
+		if !found {
+			t.Errorf("Config game_name should be found")
+		}
 	})
 
 	t.Run("Get undefined config", func(t *testing.T) {
 		rep := OSRepository{}
 		initLocalConfig(t)
-		gameName := rep.GetConfig("game_name")
+		gameName, found, err := rep.GetConfig("game_name")
+		assertNotError(t, err)
 		assertEqual(t, gameName, "")
+		if found {
+			t.Errorf("Config game_name should not be found")
+		}
+	})
+
+	t.Run("Get config from corrupt LocalConfig", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		ioutil.WriteFile(LocalConfig, []byte(`{"game_name": "ga`), 0644)
+		_, found, err := rep.GetConfig("game_name")
+		var corrupt *CorruptConfigError
+		if !errors.As(err, &corrupt) || found {
+			t.Errorf("Got %v expect corrupt %s", err, LocalConfig)
+		}
 	})
 
 	t.Run("Get config with undefined LocalConfig", func(t *testing.T) {
 		rep := OSRepository{}
 		removeLocalConfig(t)
-		gameName := rep.GetConfig("game_name")
+		gameName := getConfig(t, &rep, "game_name")
 		assertEqual(t, gameName, "")
 	})
 }
@@ -100,8 +122,248 @@ func TestSetConfig(t *testing.T) {
 		removeLocalConfig(t)
 		err := rep.SetConfig("game_name", "game")
 		assertNotError(t, err)
-		assertExist(t, LocalConfig)
-		val := getLocalConfig(t, "game_name")
-		assertEqual(t, val, "game")
+		if rep.Exists(LocalConfig) {
+			t.Error("Should not create LocalConfig")
+		}
+		assertEqual(t, getConfig(t, &rep, "game_name"), "game")
+	})
+
+	t.Run("Set config of the active game", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		rep.SetConfig("game_name", "game1")
+		rep.SetConfig("save_path", "./saves1")
+		rep.SetConfig("game_name", "game2")
+		rep.SetConfig("save_path", "./saves2")
+		assertEqual(t, getConfig(t, &rep, "save_path"), "./saves2")
+		err := rep.UseGame("game1")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, &rep, "save_path"), "./saves1")
+	})
+
+	t.Run("Set config without game", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		err := rep.SetConfig("save_path", "./saves")
+		if err != ErrGameNotSelected {
+			t.Errorf("Got %v expect %v", err, ErrGameNotSelected)
+		}
+	})
+}
+
+func TestSelectGame(t *testing.T) {
+	t.Run("select game over LocalConfig", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		addLocalConfig(t, "game_name", "game1")
+		rep.SetConfig("game_name", "game2")
+		rep.SetConfig("save_path", "./saves2")
+		rep.SelectGame("game1")
+		assertEqual(t, getConfig(t, &rep, "game_name"), "game1")
+		assertEqual(t, getConfig(t, &rep, "save_path"), "")
+		assertEqual(t, getLocalConfig(t, "game_name"), "game2")
+	})
+
+	t.Run("use game not added", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		err := rep.UseGame("game")
+		if err != ErrGameNotExist {
+			t.Errorf("Got %v expect %v", err, ErrGameNotExist)
+		}
+	})
+}
+
+func TestExists(t *testing.T) {
+	t.Run("check existing path", func(t *testing.T) {
+		rep := OSRepository{}
+		createDummyFile(t, "test_exists.txt")
+		defer removeDummyFile(t, "test_exists.txt")
+		if !rep.Exists("test_exists.txt") {
+			t.Error("Should be exist")
+		}
+	})
+
+	t.Run("check undefined path", func(t *testing.T) {
+		rep := OSRepository{}
+		if rep.Exists("test_undefined.txt") {
+			t.Error("Should be not exist")
+		}
+	})
+}
+
+func TestHashFile(t *testing.T) {
+	t.Run("hash existing file", func(t *testing.T) {
+		rep := OSRepository{}
+		createDummyFile(t, "test_hash.txt")
+		defer removeDummyFile(t, "test_hash.txt")
+		sum, err := rep.HashFile("test_hash.txt")
+		assertNotError(t, err)
+		assertEqual(t, sum, "7b657f4e861d9cd525bc48297d2316f5ac29351a59a7afd8b00d50d1e5d54bdc")
+	})
+
+	t.Run("hash undefined file", func(t *testing.T) {
+		rep := OSRepository{}
+		_, err := rep.HashFile("test_undefined.txt")
+		assertError(t, err)
+	})
+}
+
+func TestListDir(t *testing.T) {
+	t.Run("list directory entries", func(t *testing.T) {
+		rep := OSRepository{}
+		srcDir := "test_list_dir"
+		createDummyDirectory(t, path.Join(srcDir, "b"))
+		createDummyFile(t, path.Join(srcDir, "a.txt"))
+		defer rep.Remove(srcDir)
+		names, err := rep.ListDir(srcDir)
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(names, ","), "a.txt,b")
+	})
+
+	t.Run("list undefined directory", func(t *testing.T) {
+		rep := OSRepository{}
+		_, err := rep.ListDir("test_undefined_dir")
+		assertError(t, err)
+	})
+}
+
+func TestListConfig(t *testing.T) {
+	t.Run("list config migrated from LocalConfig", func(t *testing.T) {
+		rep := OSRepository{}
+		initLocalConfig(t)
+		addLocalConfig(t, "game_name", "game")
+		addLocalConfig(t, "save_path", "./saves")
+		addLocalConfig(t, "save_path.memcard", "./memcard")
+		config, err := rep.ListConfig()
+		assertNotError(t, err)
+		assertEqual(t, config["game_name"], "game")
+		assertEqual(t, config["save_path.memcard"], "./memcard")
+		assertEqual(t, getLocalConfig(t, "save_path"), "")
+		games, err := rep.ListGames()
+		assertNotError(t, err)
+		if len(games) != 1 || games[0] != "game" {
+			t.Errorf("Got %v expect [game]", games)
+		}
+	})
+
+	t.Run("list config with undefined LocalConfig", func(t *testing.T) {
+		rep := OSRepository{}
+		removeLocalConfig(t)
+		config, err := rep.ListConfig()
+		assertNotError(t, err)
+		if len(config) != 0 {
+			t.Error("Should be empty")
+		}
+	})
+}
+
+func TestListFiles(t *testing.T) {
+	t.Run("list files recursively", func(t *testing.T) {
+		rep := OSRepository{}
+		srcDir := "test_list_files"
+		createDummyDirectory(t, path.Join(srcDir, "nested"))
+		createDummyFile(t, path.Join(srcDir, "a.txt"))
+		createDummyFile(t, path.Join(srcDir, "nested", "b.txt"))
+		defer rep.Remove(srcDir)
+		entries, err := rep.ListFiles(srcDir, TreeFilter{Links: SymlinkPreserve})
+		assertNotError(t, err)
+		if len(entries) != 2 {
+			t.Fatalf("Got %d entries expect 2", len(entries))
+		}
+		assertEqual(t, entries[0].Path, "a.txt")
+		assertEqual(t, entries[1].Path, "nested/b.txt")
+		if entries[1].Size != int64(len("this is dummy file\n")) {
+			t.Errorf("Wrong size %d", entries[1].Size)
+		}
+	})
+
+	t.Run("list undefined directory", func(t *testing.T) {
+		rep := OSRepository{}
+		_, err := rep.ListFiles("test_undefined_dir", TreeFilter{Links: SymlinkPreserve})
+		assertError(t, err)
+	})
+}
+
+func TestMakeDir(t *testing.T) {
+	t.Run("make nested directory", func(t *testing.T) {
+		rep := OSRepository{}
+		dir := path.Join("test_make_dir", "nested")
+		defer rep.Remove("test_make_dir")
+		err := rep.MakeDir(dir)
+		assertNotError(t, err)
+		assertExist(t, dir)
+	})
+}
+
+func TestReadWriteManifest(t *testing.T) {
+	t.Run("write then read manifest", func(t *testing.T) {
+		rep := OSRepository{}
+		manifest := NewManifest()
+		manifest.Files["game/slot1"] = ManifestEntry{SHA256: "abc", Size: 3}
+		defer removeDummyFile(t, "test_manifest.json")
+		err := rep.WriteManifest("test_manifest.json", manifest)
+		assertNotError(t, err)
+		got, err := rep.ReadManifest("test_manifest.json")
+		assertNotError(t, err)
+		assertEqual(t, got.Files["game/slot1"].SHA256, "abc")
+	})
+
+	t.Run("read undefined manifest", func(t *testing.T) {
+		rep := OSRepository{}
+		_, err := rep.ReadManifest("test_undefined.json")
+		assertError(t, err)
+	})
+}
+
+func TestRename(t *testing.T) {
+	t.Run("rename directory", func(t *testing.T) {
+		rep := OSRepository{}
+		createDummyDirectory(t, "test_rename_src")
+		createDummyFile(t, path.Join("test_rename_src", "a.txt"))
+		defer rep.Remove("test_rename_dst")
+		err := rep.Rename("test_rename_src", "test_rename_dst")
+		assertNotError(t, err)
+		assertExist(t, path.Join("test_rename_dst", "a.txt"))
+	})
+
+	t.Run("rename undefined path", func(t *testing.T) {
+		rep := OSRepository{}
+		err := rep.Rename("test_undefined_dir", "test_rename_dst")
+		assertError(t, err)
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Run("run command with environment", func(t *testing.T) {
+		rep := OSRepository{}
+		err := rep.RunCommand(`test "$GAMESAVE_GAME" = game1`, []string{"GAMESAVE_GAME=game1"})
+		assertNotError(t, err)
+	})
+
+	t.Run("show error if command fails", func(t *testing.T) {
+		rep := OSRepository{}
+		err := rep.RunCommand("exit 3", nil)
+		assertError(t, err)
+	})
+}
+
+func TestRemove(t *testing.T) {
+	t.Run("remove directory recursively", func(t *testing.T) {
+		rep := OSRepository{}
+		srcDir := "test_remove_dir"
+		createDummyDirectory(t, srcDir)
+		createDummyFile(t, path.Join(srcDir, "test_remove.txt"))
+		err := rep.Remove(srcDir)
+		assertNotError(t, err)
+		if rep.Exists(srcDir) {
+			t.Error("Should be removed")
+		}
+	})
+
+	t.Run("remove undefined path", func(t *testing.T) {
+		rep := OSRepository{}
+		err := rep.Remove("test_undefined_dir")
+		assertNotError(t, err)
 	})
 }
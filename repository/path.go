@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var templatePattern = regexp.MustCompile(`<[^<>]*>`)
+
+// ExpandPath expands path template into a path on this machine.
+// Template may start with "~" and may contain placeholders
+// <home>, <xdgData>, <xdgConfig>, <winePrefix> and environment
+// variables written as $NAME or ${NAME}
+func (rep *OSRepository) ExpandPath(template string) (string, error) {
+	return expandPath(template, os.LookupEnv)
+}
+
+// AbsPath returns p joined to the working directory if it is relative
+func (rep *OSRepository) AbsPath(p string) (string, error) {
+	return filepath.Abs(p)
+}
+
+// ResolvePath returns absolute path of p with symbolic links resolved,
+// if p is not exist links are resolved up to its deepest existing parent
+func (rep *OSRepository) ResolvePath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return filepath.Join(abs, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(abs), rest)
+		abs = parent
+	}
+}
+
+func expandPath(template string, lookupEnv func(string) (string, bool)) (string, error) {
+	home, ok := lookupEnv("HOME")
+	if !ok || home == "" {
+		var err error
+		home, err = os.UserHomeDir()
+		usesHome := template == "~" || strings.HasPrefix(template, "~/") || templatePattern.MatchString(template)
+		if err != nil && usesHome {
+			return "", err
+		}
+	}
+	placeholders := map[string]string{
+		"<home>":       home,
+		"<xdgData>":    envOrDefault(lookupEnv, "XDG_DATA_HOME", filepath.Join(home, ".local", "share")),
+		"<xdgConfig>":  envOrDefault(lookupEnv, "XDG_CONFIG_HOME", filepath.Join(home, ".config")),
+		"<winePrefix>": envOrDefault(lookupEnv, "WINEPREFIX", filepath.Join(home, ".wine")),
+	}
+	var err error
+	expanded := templatePattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := placeholders[placeholder]
+		if !ok && err == nil {
+			err = fmt.Errorf("Unknown placeholder %s in path %s", placeholder, template)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	expanded = os.Expand(expanded, func(name string) string {
+		value, ok := lookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("Undefined variable $%s in path %s", name, template)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") {
+		expanded = home + expanded[1:]
+	}
+	return expanded, nil
+}
+
+func envOrDefault(lookupEnv func(string) (string, bool), name, value string) string {
+	if env, ok := lookupEnv(name); ok && env != "" {
+		return env
+	}
+	return value
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	env := map[string]string{
+		"HOME":          "/home/player",
+		"XDG_DATA_HOME": "/data",
+		"GAME_DIR":      "/games/rpg",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	cases := map[string]string{
+		"./game.save":                   "./game.save",
+		"~":                             "/home/player",
+		"~/saves":                       "/home/player/saves",
+		"<home>/saves":                  "/home/player/saves",
+		"<xdgData>/Game":                "/data/Game",
+		"<xdgConfig>/Game":              "/home/player/.config/Game",
+		"<winePrefix>/drive_c/Game":     "/home/player/.wine/drive_c/Game",
+		"$HOME/saves":                   "/home/player/saves",
+		"${GAME_DIR}/saves":             "/games/rpg/saves",
+		"<home>/$GAME_DIR/<home>/~name": "/home/player//games/rpg//home/player/~name",
+	}
+	for template, want := range cases {
+		t.Run("expand "+template, func(t *testing.T) {
+			got, err := expandPath(template, lookupEnv)
+			assertNotError(t, err)
+			assertEqual(t, got, want)
+		})
+	}
+
+	t.Run("expand unknown placeholder", func(t *testing.T) {
+		_, err := expandPath("<steam>/saves", lookupEnv)
+		assertError(t, err)
+	})
+
+	t.Run("expand undefined variable", func(t *testing.T) {
+		_, err := expandPath("$UNDEFINED/saves", lookupEnv)
+		assertError(t, err)
+	})
+}
+
+func TestResolvePath(t *testing.T) {
+	t.Run("resolve link to system directory", func(t *testing.T) {
+		rep := OSRepository{}
+		dir, _ := ioutil.TempDir("", "gamesave_path")
+		defer os.RemoveAll(dir)
+		link := filepath.Join(dir, "saves")
+		os.Symlink("/etc", link)
+		got, err := rep.ResolvePath(link)
+		assertNotError(t, err)
+		assertEqual(t, got, "/etc")
+		got, err = rep.ResolvePath(filepath.Join(link, "missing", "game"))
+		assertNotError(t, err)
+		assertEqual(t, got, "/etc/missing/game")
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package repository
+
+import "os/exec"
+
+// shellCommand runs command line by sh
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
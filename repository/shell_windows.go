@@ -0,0 +1,8 @@
+package repository
+
+import "os/exec"
+
+// shellCommand runs command line by cmd
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+// ListCatalog returns catalog of games saved in Git repository
+func (s *Service) ListCatalog() (repository.Catalog, error) {
+	return s.readCatalog()
+}
+
+// SetDisplayName records display name of the current game
+// along with its save paths and patterns into the catalog,
+// then syncs the catalog with remote
+func (s *Service) SetDisplayName(displayName string) error {
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
+	}
+	err = s.updateCatalog(gameName, displayName)
+	if err != nil {
+		return err
+	}
+	return s.syncCatalog()
+}
+
+// SetupCatalog adds every cataloged game which has not been added on
+// this machine along with its save paths and patterns, confirmation
+// is asked first unless assumeYes is set. The catalog is synced with
+// remote first. Save paths are kept as path templates and are not
+// required to exist yet. Names of the added games are returned
+func (s *Service) SetupCatalog(assumeYes bool) ([]string, error) {
+	err := s.syncCatalog()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := s.readCatalog()
+	if err != nil {
+		return nil, err
+	}
+	games, err := s.OSRepository.ListGames()
+	if err != nil {
+		return nil, err
+	}
+	added := map[string]bool{}
+	for _, name := range games {
+		added[name] = true
+	}
+	names := []string{}
+	for name := range catalog.Games {
+		if !added[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return names, nil
+	}
+	if !assumeYes {
+		confirmed, err := s.OSRepository.Confirm(fmt.Sprintf(
+			"Set up %d cataloged games (%s)?", len(names), strings.Join(names, ", "),
+		))
+		if err != nil {
+			return nil, err
+		}
+		if !confirmed {
+			return []string{}, nil
+		}
+	}
+	previous := s.OSRepository.SelectGame("")
+	defer s.OSRepository.SelectGame(previous)
+	for _, name := range names {
+		s.OSRepository.SelectGame(name)
+		values := catalog.Games[name].Values()
+		if len(values) == 0 {
+			// unsetting a key still creates profile of the game
+			values[savePathKey] = ""
+		}
+		for key, value := range values {
+			err = s.OSRepository.SetScopeConfig(repository.ScopeGame, key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return names, nil
+}
+
+// readCatalog reads catalog committed on CatalogBranch,
+// empty catalog is returned if it has not been committed
+func (s *Service) readCatalog() (repository.Catalog, error) {
+	return s.showCatalog(repository.CatalogBranch)
+}
+
+// showCatalog reads catalog committed on rev,
+// empty catalog is returned if rev has no catalog
+func (s *Service) showCatalog(rev string) (repository.Catalog, error) {
+	data, err := s.GitRepository.ShowFile(rev, repository.CatalogFile)
+	if err == repository.ErrFileNotExist {
+		return repository.NewCatalog(), nil
+	}
+	if err != nil {
+		return repository.Catalog{}, err
+	}
+	catalog, err := repository.ParseCatalog(data)
+	if err != nil {
+		return repository.Catalog{}, fmt.Errorf("Catalog on %s is corrupt: %v", rev, err)
+	}
+	return catalog, nil
+}
+
+// syncCatalog fetches CatalogBranch from remote and brings the local
+// branch up to date with it. Local changes are pushed, merging them
+// with changes of other machines first if both changed the catalog
+func (s *Service) syncCatalog() error {
+	_, err := s.GitRepository.ShowFile(repository.CatalogBranch, repository.CatalogFile)
+	if err != nil && err != repository.ErrFileNotExist {
+		return err
+	}
+	committed := err == nil
+	remoteRev, err := s.GitRepository.FetchRemote(repository.CatalogBranch)
+	if err == repository.ErrRemoteBranchNotExist {
+		if !committed {
+			return nil
+		}
+		return s.GitRepository.PushBranch(repository.CatalogBranch)
+	}
+	if err != nil {
+		return err
+	}
+	if !committed {
+		return s.GitRepository.SetBranch(repository.CatalogBranch, remoteRev)
+	}
+	local, err := s.GitRepository.LastCommit(repository.CatalogBranch)
+	if err != nil || local.Hash == remoteRev {
+		return err
+	}
+	baseRev, err := s.GitRepository.MergeBase(repository.CatalogBranch, remoteRev)
+	if err != nil {
+		return err
+	}
+	switch baseRev {
+	case remoteRev:
+		return s.GitRepository.PushBranch(repository.CatalogBranch)
+	case local.Hash:
+		return s.GitRepository.SetBranch(repository.CatalogBranch, remoteRev)
+	}
+	return s.mergeCatalog(baseRev, remoteRev)
+}
+
+// mergeCatalog commits catalog of CatalogBranch merged with catalog of
+// remoteRev on top of remoteRev and pushes it
+func (s *Service) mergeCatalog(baseRev, remoteRev string) error {
+	base := repository.NewCatalog()
+	if baseRev != "" {
+		var err error
+		if base, err = s.showCatalog(baseRev); err != nil {
+			return err
+		}
+	}
+	local, err := s.readCatalog()
+	if err != nil {
+		return err
+	}
+	remote, err := s.showCatalog(remoteRev)
+	if err != nil {
+		return err
+	}
+	merged := repository.MergeCatalog(base, local, remote)
+	err = s.GitRepository.SetBranch(repository.CatalogBranch, remoteRev)
+	if err != nil || reflect.DeepEqual(merged, remote) {
+		return err
+	}
+	data, err := merged.Encode()
+	if err != nil {
+		return err
+	}
+	err = s.GitRepository.CommitFile(
+		repository.CatalogBranch,
+		repository.CatalogFile,
+		data,
+		"Merge catalog",
+	)
+	if err != nil {
+		return err
+	}
+	return s.GitRepository.PushBranch(repository.CatalogBranch)
+}
+
+// updateCatalog records save paths and patterns of game name into the
+// catalog and commits it if they changed, it is pushed by syncCatalog.
+// Empty display name keeps the cataloged one, save paths mapped to
+// other machines are kept unless config of the game maps them
+func (s *Service) updateCatalog(gameName, displayName string) error {
+	catalog, err := s.readCatalog()
+	if err != nil {
+		return err
+	}
+	config, err := s.OSRepository.ListScopeConfig(repository.ScopeGame)
+	if err != nil {
+		return err
+	}
+	cataloged, ok := catalog.Games[gameName]
+	if displayName == "" {
+		displayName = cataloged.DisplayName
+	}
+	game, err := repository.NewCatalogGame(displayName, config)
+	if err != nil {
+		return err
+	}
+	current, err := s.OSRepository.MachineID()
+	if err != nil {
+		return err
+	}
+	for machine, paths := range cataloged.Machines {
+		if _, ok := game.Machines[machine]; !ok && machine != current {
+			if game.Machines == nil {
+				game.Machines = map[string]map[string]string{}
+			}
+			game.Machines[machine] = paths
+		}
+	}
+	if ok && reflect.DeepEqual(game, cataloged) {
+		return nil
+	}
+	catalog.Games[gameName] = game
+	data, err := catalog.Encode()
+	if err != nil {
+		return err
+	}
+	return s.GitRepository.CommitFile(
+		repository.CatalogBranch,
+		repository.CatalogFile,
+		data,
+		"Catalog "+gameName,
+	)
+}
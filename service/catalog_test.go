@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestCatalog(t *testing.T) {
+	t.Run("record game into catalog on save", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		setSavePath(service, "", "<home>/game.save")
+		service.AddConfig("include", "*.sav")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("/home/mock/game.save/slot1.sav", "data")
+		err := service.SetDisplayName("The Game")
+		assertNotError(t, err)
+		err = service.SaveGame()
+		assertNotError(t, err)
+		catalog, err := service.ListCatalog()
+		assertNotError(t, err)
+		game := catalog.Games["game"]
+		assertEqual(t, game.DisplayName, "The Game")
+		assertEqual(t, game.SavePaths["default"], "<home>/game.save")
+		if len(game.Include) != 1 || game.Include[0] != "*.sav" {
+			t.Errorf("Got %v include expect [*.sav]", game.Include)
+		}
+	})
+
+	t.Run("push catalog merged with another machine on save", func(t *testing.T) {
+		service := initGameService(t, 0)
+		commitCatalog(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.remoteCatalog = gitRepo.catalog
+		gitRepo.catalogBase = gitRepo.catalog
+		remote := repository.NewCatalog()
+		remote.Games["game"] = repository.CatalogGame{SavePaths: map[string]string{"default": "<home>/game.save"}}
+		remote.Games["game3"] = repository.CatalogGame{DisplayName: "Game 3"}
+		gitRepo.remoteCatalog, _ = remote.Encode()
+		setSavePath(service, "", "<home>/saves")
+		service.OSRepository.(*OsRepositoryMock).writeFile("/home/mock/saves/slot1", "data")
+		err := service.SaveGame()
+		assertNotError(t, err)
+		pushed, err := repository.ParseCatalog(gitRepo.remoteCatalog)
+		assertNotError(t, err)
+		assertEqual(t, pushed.Games["game"].SavePaths["default"], "<home>/saves")
+		assertEqual(t, pushed.Games["game3"].DisplayName, "Game 3")
+		if _, ok := pushed.Games["game2"]; ok {
+			t.Error("Should keep game2 removed on remote")
+		}
+		assertEqual(t, string(gitRepo.catalog), string(gitRepo.remoteCatalog))
+	})
+
+	t.Run("save while remote is unreachable", func(t *testing.T) {
+		service := initGameService(t, 0)
+		commitCatalog(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.remoteErr = errors.New("offline")
+		setSavePath(service, "", "<home>/saves")
+		service.OSRepository.(*OsRepositoryMock).writeFile("/home/mock/saves/slot1", "data")
+		err := service.SaveGame()
+		assertNotError(t, err)
+		if gitRepo.remoteCatalog != nil {
+			t.Error("Should not push catalog")
+		}
+	})
+
+	t.Run("report corrupt catalog", func(t *testing.T) {
+		service := initGameService(t, 0)
+		commitCatalog(t, service)
+		service.GitRepository.(*GitRepositoryMock).catalog = []byte("{")
+		_, err := service.ListCatalog()
+		assertError(t, err)
+		_, err = service.SetupCatalog(true)
+		assertError(t, err)
+	})
+
+	t.Run("refuse display name without game", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.SetDisplayName("The Game")
+		if err != ErrGameNameEmpty {
+			t.Errorf("Got %v expect %v", err, ErrGameNameEmpty)
+		}
+	})
+}
+
+func TestSetupCatalog(t *testing.T) {
+	t.Run("set up cataloged games after confirmation", func(t *testing.T) {
+		service := initGameService(t, 0)
+		commitCatalog(t, service)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		names, err := service.SetupCatalog(false)
+		assertNotError(t, err)
+		if len(names) != 0 || osRepo.confirmed != 1 {
+			t.Errorf("Got %v after %d confirmations expect nothing set up", names, osRepo.confirmed)
+		}
+		osRepo.confirm = true
+		names, err = service.SetupCatalog(false)
+		assertNotError(t, err)
+		if len(names) != 1 || names[0] != "game2" {
+			t.Errorf("Got %v expect [game2]", names)
+		}
+		assertEqual(t, getConfig(t, osRepo, "save_path"), "<home>/game2.save")
+		assertEqual(t, getConfig(t, osRepo, "game_name"), "game")
+	})
+
+	t.Run("set up games fetched from remote", func(t *testing.T) {
+		service := initGameService(t, 0)
+		commitCatalog(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.remoteCatalog = gitRepo.catalog
+		gitRepo.catalog = nil
+		names, err := service.SetupCatalog(true)
+		assertNotError(t, err)
+		if len(names) != 1 || names[0] != "game2" {
+			t.Errorf("Got %v expect [game2]", names)
+		}
+		assertEqual(t, string(gitRepo.catalog), string(gitRepo.remoteCatalog))
+	})
+
+	t.Run("skip confirmation and added games", func(t *testing.T) {
+		service := initGameService(t, 0)
+		commitCatalog(t, service)
+		names, err := service.SetupCatalog(true)
+		assertNotError(t, err)
+		if len(names) != 1 || names[0] != "game2" {
+			t.Errorf("Got %v expect [game2]", names)
+		}
+		names, _ = service.SetupCatalog(true)
+		if len(names) != 0 {
+			t.Errorf("Got %v expect nothing set up", names)
+		}
+	})
+}
+
+// commitCatalog commits catalog holding the added game and game2
+func commitCatalog(t *testing.T, service *Service) {
+	t.Helper()
+	catalog := repository.NewCatalog()
+	catalog.Games["game"] = repository.CatalogGame{SavePaths: map[string]string{"default": "<home>/game.save"}}
+	catalog.Games["game2"] = repository.CatalogGame{SavePaths: map[string]string{"default": "<home>/game2.save"}}
+	data, err := catalog.Encode()
+	if err != nil {
+		t.Fatalf("[Helper-commitCatalog] Error: %v", err)
+	}
+	service.GitRepository.(*GitRepositoryMock).catalog = data
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+var (
+	// ErrConfigNotSet represents error if config key has no value in the scope
+	ErrConfigNotSet = errors.New("Config key has not been set")
+)
+
+// ConfigAccessError represents error if config file on Path can not be
+// read or written for permission
+type ConfigAccessError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigAccessError) Error() string {
+	return fmt.Sprintf("Permission denied to access config file %s, check its owner and mode", e.Path)
+}
+
+func (e *ConfigAccessError) Unwrap() error {
+	return e.Err
+}
+
+// GetConfig returns value of config key in scope,
+// ErrConfigNotSet is returned if it has not been set
+func (s *Service) GetConfig(scope repository.ConfigScope, key string) (string, error) {
+	if key != "game_name" && !repository.IsConfigKey(key) {
+		return "", &repository.ConfigError{Field: key, Err: repository.ErrConfigKeyUnknown}
+	}
+	config, err := s.OSRepository.ListScopeConfig(scope)
+	if err != nil {
+		return "", configReadError(err)
+	}
+	value, ok := config[key]
+	if !ok {
+		return "", ErrConfigNotSet
+	}
+	return value, nil
+}
+
+// ListConfig returns every config key set in scope along with its value
+func (s *Service) ListConfig(scope repository.ConfigScope) (map[string]string, error) {
+	config, err := s.OSRepository.ListScopeConfig(scope)
+	return config, configReadError(err)
+}
+
+// ListConfigOrigins returns every effective config key along with its
+// value and where the value comes from
+func (s *Service) ListConfigOrigins() (map[string]repository.ConfigValue, error) {
+	configs, err := s.OSRepository.ListConfigOrigins()
+	return configs, configReadError(err)
+}
+
+// gameName returns name of the selected game, ErrGameNameEmpty is
+// returned only if it is not set
+func (s *Service) gameName() (string, error) {
+	gameName, found, err := s.OSRepository.GetConfig("game_name")
+	if err != nil {
+		return "", configReadError(err)
+	}
+	if !found || gameName == "" {
+		return "", ErrGameNameEmpty
+	}
+	return gameName, nil
+}
+
+// configValue returns effective value of config key,
+// empty if it is not set
+func (s *Service) configValue(key string) (string, error) {
+	value, _, err := s.OSRepository.GetConfig(key)
+	return value, configReadError(err)
+}
+
+// configReadError returns ConfigAccessError if config can not be
+// accessed for permission, corrupt config is reported by
+// repository.CorruptConfigError and other errors are kept
+func configReadError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) && os.IsPermission(pathErr.Err) {
+		return &ConfigAccessError{Path: pathErr.Path, Err: err}
+	}
+	return err
+}
+
+// SetConfig stores value of config key in scope, the value is validated
+// by OSRepository and empty value unsets the key. Save path is checked
+// and made absolute the same way as by SetSavePath
+func (s *Service) SetConfig(scope repository.ConfigScope, key, value string) error {
+	base, _ := repository.SplitMachineKey(key)
+	if value != "" && (base == savePathKey || strings.HasPrefix(base, savePathKey+".")) {
+		var err error
+		if value, err = s.validateSavePathConfig(key, value); err != nil {
+			return err
+		}
+	}
+	return s.OSRepository.SetScopeConfig(scope, key, value)
+}
+
+// validateSavePathConfig validates location name and save path of
+// config key and returns save path to be stored. Save path mapped to
+// another machine is only checked on that machine, so it can not be
+// relative
+func (s *Service) validateSavePathConfig(key, value string) (string, error) {
+	key, machine := repository.SplitMachineKey(key)
+	name := strings.TrimPrefix(strings.TrimPrefix(key, savePathKey), ".")
+	if name != "" && !isValidLocationName(name) {
+		return "", ErrLocationNameInvalid
+	}
+	if machine != "" {
+		current, err := s.OSRepository.MachineID()
+		if err != nil {
+			return "", err
+		}
+		if machine != current {
+			if expanded, err := s.OSRepository.ExpandPath(value); err == nil && !filepath.IsAbs(expanded) {
+				return "", &SavePathError{value, "it is a relative path of another machine"}
+			}
+			return value, nil
+		}
+	}
+	value, err := s.absoluteTemplate(value)
+	if err != nil {
+		return "", err
+	}
+	return value, s.validateSavePath(value)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("set, get and unset config in scope", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.SetConfig(repository.ScopeGlobal, "max_files", "3")
+		assertNotError(t, err)
+		value, err := service.GetConfig(repository.ScopeGlobal, "max_files")
+		assertNotError(t, err)
+		assertEqual(t, value, "3")
+		_, err = service.GetConfig(repository.ScopeGame, "max_files")
+		if err != ErrConfigNotSet {
+			t.Errorf("Got %v expect %v", err, ErrConfigNotSet)
+		}
+		service.SetConfig(repository.ScopeGlobal, "max_files", "")
+		config, err := service.ListConfig(repository.ScopeGlobal)
+		assertNotError(t, err)
+		if len(config) != 0 {
+			t.Errorf("Got %v expect empty config", config)
+		}
+	})
+
+	t.Run("refuse invalid value", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		invalid := map[string]string{
+			"max_files": "-1", "include": "/etc/*", "symlinks": "copy", "storage": "zip", "max_size": "big",
+		}
+		for key, value := range invalid {
+			err := service.SetConfig(repository.ScopeGame, key, value)
+			var configErr *repository.ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != key {
+				t.Errorf("Got %v expect ConfigError of %s", err, key)
+			}
+		}
+	})
+
+	t.Run("tell missing, corrupt and unreadable config apart", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.SaveGame()
+		if err != ErrGameNameEmpty {
+			t.Errorf("Got %v expect %v", err, ErrGameNameEmpty)
+		}
+		corrupt := &repository.CorruptConfigError{Path: ".gamesave.json", Err: errors.New("unexpected EOF")}
+		service.OSRepository.(*OsRepositoryMock).configErr = corrupt
+		err = service.SaveGame()
+		if err != corrupt {
+			t.Errorf("Got %v expect %v", err, corrupt)
+		}
+		denied := &os.PathError{Op: "open", Path: "config.json", Err: os.ErrPermission}
+		service.OSRepository.(*OsRepositoryMock).configErr = denied
+		_, err = service.GetConfig(repository.ScopeEffective, "max_files")
+		var accessErr *ConfigAccessError
+		if !errors.As(err, &accessErr) || accessErr.Path != "config.json" || !errors.Is(err, os.ErrPermission) {
+			t.Errorf("Got %v expect ConfigAccessError of config.json", err)
+		}
+	})
+
+	t.Run("refuse unknown key", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		_, err := service.GetConfig(repository.ScopeEffective, "playtime")
+		if !errors.Is(err, repository.ErrConfigKeyUnknown) {
+			t.Errorf("Got %v expect %v", err, repository.ErrConfigKeyUnknown)
+		}
+	})
+
+	t.Run("guard save path", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.OSRepository.MakeDir("/etc")
+		err := service.SetConfig(repository.ScopeLocal, "save_path.memcard", "/etc")
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+		service.OSRepository.MakeDir("/work/game.save")
+		err = service.SetConfig(repository.ScopeLocal, "save_path.memcard", "./game.save")
+		assertNotError(t, err)
+		scoped, _ := service.OSRepository.ListScopeConfig(repository.ScopeLocal)
+		assertEqual(t, scoped["save_path.memcard"], "/work/game.save")
+	})
+}
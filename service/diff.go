@@ -0,0 +1,366 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// DiffAdded means file is in save folder but not in the snapshot
+	DiffAdded = "added"
+	// DiffRemoved means file is in the snapshot but not in save folder
+	DiffRemoved = "removed"
+	// DiffModified means file content differs from the snapshot
+	DiffModified = "modified"
+
+	// diffContext is number of unchanged lines around changed lines
+	diffContext = 3
+	// maxLineEdits is number of changed lines a content diff gives up at
+	maxLineEdits = 1000
+)
+
+var (
+	// ErrRevisionNotExist represents error if revision is not found in repository
+	ErrRevisionNotExist = errors.New("Revision is not exist in game save repository")
+)
+
+// textSaveExts are extensions of save files shown as content diff
+var textSaveExts = map[string]bool{
+	".cfg":  true,
+	".ini":  true,
+	".json": true,
+	".txt":  true,
+	".xml":  true,
+}
+
+// FileDiff describes a file differing between snapshot and save folder.
+// Patch is unified diff of text file content from snapshot to save folder
+type FileDiff struct {
+	Path     string
+	Change   string
+	OldSize  int64
+	NewSize  int64
+	Patch    string
+	savePath string
+}
+
+// SizeDelta formats size change from snapshot to save folder
+func (d FileDiff) SizeDelta() string {
+	delta := d.NewSize - d.OldSize
+	if delta < 0 {
+		return "-" + formatSize(-delta)
+	}
+	return "+" + formatSize(delta)
+}
+
+// Diff compares save folders of the configured game against its
+// snapshot at git revision rev, the latest snapshot if rev is empty.
+// Revision starting with ~ or ^ is relative to the latest snapshot
+func (s *Service) Diff(rev string) ([]FileDiff, error) {
+	gameName, err := s.gameName()
+	if err != nil {
+		return nil, err
+	}
+	if rev == "" || strings.HasPrefix(rev, "~") || strings.HasPrefix(rev, "^") {
+		rev = gameName + rev
+	}
+	tree, err := s.GitRepository.ListTree(rev)
+	if err != nil {
+		return nil, ErrRevisionNotExist
+	}
+	manifest, cipher, err := s.snapshotManifest(rev, tree)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := s.saveLocations()
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := s.compareSave(manifest, locations)
+	if err != nil {
+		return nil, err
+	}
+	stored := snapshotIndex(tree, cipher)
+	for i, diff := range diffs {
+		if diff.Change == DiffModified && textSaveExts[strings.ToLower(path.Ext(diff.Path))] {
+			diffs[i].Patch, err = s.contentDiff(rev, stored, diff.Path, diff.savePath, cipher)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// compareSave lists files of locations differing from manifest,
+// files of manifest outside locations are left out
+func (s *Service) compareSave(manifest repository.Manifest, locations []SaveLocation) ([]FileDiff, error) {
+	snapshot := map[string]repository.ManifestEntry{}
+	live := map[string]repository.ManifestEntry{}
+	savePaths := map[string]string{}
+	for _, location := range locations {
+		for key, entry := range manifest.Files {
+			if strings.HasPrefix(key, location.RepoDir+"/") {
+				snapshot[key] = entry
+				savePaths[key] = path.Join(location.Path, strings.TrimPrefix(key, location.RepoDir+"/"))
+			}
+		}
+		if !s.OSRepository.Exists(location.Path) {
+			continue
+		}
+		entries, err := s.OSRepository.ListFiles(location.Path, location.Filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			key := path.Join(location.RepoDir, entry.Path)
+			savePaths[key] = path.Join(location.Path, entry.Path)
+			live[key] = repository.ManifestEntry{Size: entry.Size}
+		}
+	}
+	keys := sortedEntryKeys(snapshot)
+	for key := range live {
+		if _, ok := snapshot[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	diffs := []FileDiff{}
+	for _, key := range keys {
+		old, inSnapshot := snapshot[key]
+		current, inSave := live[key]
+		diff := FileDiff{Path: key, OldSize: old.Size, NewSize: current.Size, savePath: savePaths[key]}
+		switch {
+		case !inSnapshot:
+			diff.Change = DiffAdded
+		case !inSave:
+			diff.Change = DiffRemoved
+		default:
+			if current.Size == old.Size {
+				sum, err := s.OSRepository.HashFile(diff.savePath)
+				if err != nil {
+					return nil, err
+				}
+				if sum == old.SHA256 {
+					continue
+				}
+			}
+			diff.Change = DiffModified
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// contentDiff returns unified diff of file key from snapshot at rev to
+// file savePath, empty if either file is not text or they differ too much
+func (s *Service) contentDiff(rev string, stored map[string]string, key, savePath string, cipher *repository.Cipher) (string, error) {
+	var before []byte
+	var err error
+	root := strings.SplitN(key, "/", 2)[0]
+	if archive, ok := stored[root+repository.ArchiveExt]; ok {
+		before, err = s.archiveFile(rev, archive, strings.TrimPrefix(key, root+"/"), cipher)
+	} else {
+		before, err = s.GitRepository.ShowFile(rev, stored[key])
+		if err == nil && cipher != nil {
+			before, err = cipher.Open(before)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	after, err := s.OSRepository.ReadFile(savePath)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(before, 0) >= 0 || bytes.IndexByte(after, 0) >= 0 {
+		return "", nil
+	}
+	return unifiedDiff(splitLines(string(before)), splitLines(string(after))), nil
+}
+
+// archiveFile reads file name inside archive committed on rev,
+// the archive is decrypted by cipher if it is not nil
+func (s *Service) archiveFile(rev, archive, name string, cipher *repository.Cipher) ([]byte, error) {
+	data, err := s.GitRepository.ShowFile(rev, archive)
+	if err != nil {
+		return nil, err
+	}
+	if cipher != nil {
+		data, err = cipher.Open(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repository.ArchiveFile(bytes.NewReader(data), name)
+}
+
+// snapshotIndex maps path of committed files, with file names decrypted
+// by cipher if it is not nil, to their path in the tree. Archives are
+// kept under their own path
+func snapshotIndex(tree []string, cipher *repository.Cipher) map[string]string {
+	index := map[string]string{}
+	for _, file := range tree {
+		key := file
+		root := strings.SplitN(file, "/", 2)[0]
+		if cipher != nil && root != file {
+			if opened, err := cipher.OpenPath(strings.TrimPrefix(file, root)); err == nil {
+				key = root + opened
+			}
+		}
+		index[key] = file
+	}
+	return index
+}
+
+// splitLines splits text into lines without their line break
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// lineEdit is a line kept (' '), removed ('-') or added ('+') by a diff
+type lineEdit struct {
+	op   byte
+	line string
+}
+
+// lineEdits returns the shortest edit script turning a into b found by
+// Myers algorithm, nil if more than maxLineEdits lines are changed
+func lineEdits(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	offset := maxLineEdits + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+	for d := 0; d <= maxLineEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			x := v[offset+k-1] + 1
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackEdits(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrackEdits walks trace of lineEdits back from the end of a and b,
+// trace[d] holds furthest x of every diagonal -d..d before step d
+func backtrackEdits(a, b []string, trace [][]int) []lineEdit {
+	edits := []lineEdit{}
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, lineEdit{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, lineEdit{'+', b[y]})
+		} else {
+			x--
+			edits = append(edits, lineEdit{'-', a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		edits = append(edits, lineEdit{' ', a[x]})
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// unifiedDiff formats changes from a to b as hunks of unified diff
+// with diffContext unchanged lines around them
+func unifiedDiff(a, b []string) string {
+	edits := lineEdits(a, b)
+	// line number in a and b before every edit
+	oldLines := make([]int, len(edits)+1)
+	newLines := make([]int, len(edits)+1)
+	for i, edit := range edits {
+		oldLines[i+1], newLines[i+1] = oldLines[i], newLines[i]
+		if edit.op != '+' {
+			oldLines[i+1]++
+		}
+		if edit.op != '-' {
+			newLines[i+1]++
+		}
+	}
+	var out strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		end += diffContext
+		if end > len(edits) {
+			end = len(edits)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldLines[start], oldLines[end]-oldLines[start]),
+			hunkRange(newLines[start], newLines[end]-newLines[start]))
+		for _, edit := range edits[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", edit.op, edit.line)
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats start line and line count of a hunk side
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
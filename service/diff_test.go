@@ -0,0 +1,117 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("list added, removed and modified files", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		delete(osRepo.files, path.Join("game.save", "slot1"))
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		osRepo.writeFile(path.Join("game.save", "slot3"), "new")
+		diffs, err := service.Diff("")
+		assertNotError(t, err)
+		if len(diffs) != 3 {
+			t.Fatalf("Got %+v expect 3 files", diffs)
+		}
+		changes := []string{diffs[0].Change, diffs[1].Change, diffs[2].Change}
+		assertEqual(t, strings.Join(changes, ","), "removed,modified,added")
+		assertEqual(t, diffs[1].SizeDelta(), "+2 B")
+		assertEqual(t, diffs[2].SizeDelta(), "+3 B")
+	})
+
+	t.Run("show content diff of text save", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		snapshot := "[video]\nwidth=1280\nheight=720\n"
+		addSnapshotFile(t, service, path.Join("game.save", "options.ini"), snapshot)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile(path.Join("game.save", "options.ini"), "[video]\nwidth=1920\nheight=720\n")
+		diffs, err := service.Diff("")
+		assertNotError(t, err)
+		if len(diffs) != 1 {
+			t.Fatalf("Got %+v expect 1 file", diffs)
+		}
+		assertEqual(t, diffs[0].Patch, "@@ -1,3 +1,3 @@\n [video]\n-width=1280\n+width=1920\n height=720\n")
+	})
+
+	t.Run("show content diff of archived text save", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.files["game.save/slot1"] = []byte("a\nb\n")
+		gitRepo.files["game.save"+repository.ArchiveExt] = packTestArchive(t, gitRepo.files)
+		delete(gitRepo.files, "game.save/slot1")
+		delete(gitRepo.files, "game.save/slot2")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile(path.Join("game.save", "slot1"), "a\nc\n")
+		delete(osRepo.files, path.Join("game.save", "slot2"))
+		textSaveExts[""] = true
+		defer delete(textSaveExts, "")
+		diffs, err := service.Diff("~1")
+		assertNotError(t, err)
+		if len(diffs) != 2 {
+			t.Fatalf("Got %+v expect 2 files", diffs)
+		}
+		assertEqual(t, diffs[0].Patch, "@@ -1,2 +1,2 @@\n a\n-b\n+c\n")
+	})
+
+	t.Run("compare snapshot without manifest", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		delete(gitRepo.files, repository.ManifestFile)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		diffs, err := service.Diff("")
+		assertNotError(t, err)
+		if len(diffs) != 1 || diffs[0].Change != DiffModified || diffs[0].Path != "game.save/slot2" {
+			t.Errorf("Got %+v expect modified game.save/slot2", diffs)
+		}
+	})
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Run("split distant changes into hunks", func(t *testing.T) {
+		before := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12", " ")
+		after := strings.Split("0 1 2 3 4 5 6 7 8 9 10 12", " ")
+		want := "@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -8,5 +9,4 @@\n 8\n 9\n 10\n-11\n 12\n"
+		assertEqual(t, unifiedDiff(before, after), want)
+	})
+
+	t.Run("give up on too many changes", func(t *testing.T) {
+		before := make([]string, maxLineEdits+1)
+		after := make([]string, maxLineEdits+1)
+		for i := range before {
+			before[i], after[i] = "a", "b"
+		}
+		assertEqual(t, unifiedDiff(before, after), "")
+	})
+}
+
+// addSnapshotFile commits file with content and records it in manifest
+func addSnapshotFile(t *testing.T, service *Service, file, content string) {
+	t.Helper()
+	gitRepo := service.GitRepository.(*GitRepositoryMock)
+	manifest, err := repository.ParseManifest(gitRepo.files[repository.ManifestFile])
+	if err != nil {
+		t.Fatalf("[Helper-addSnapshotFile] Error: %v", err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	manifest.Files[file] = repository.ManifestEntry{
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(content)),
+	}
+	gitRepo.files[file] = []byte(content)
+	gitRepo.files[repository.ManifestFile], _ = json.Marshal(manifest)
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	keyFileKey       = "key_file"
+	newPassphraseEnv = "GAMESAVE_NEW_PASSPHRASE"
+	passphraseEnv    = "GAMESAVE_PASSPHRASE"
+	workDirName      = ".gamesave-work"
+)
+
+var (
+	// ErrKeyExists represents error if game save is already encrypted
+	ErrKeyExists = errors.New("Game save is already encrypted, use key rotate to change the key")
+	// ErrKeyFileEmpty represents error if key file of encrypted game save has not been set
+	ErrKeyFileEmpty = errors.New("Key file has not been set")
+	// ErrKeyNotExist represents error if game save is not encrypted
+	ErrKeyNotExist = errors.New("Game save is not encrypted")
+	// ErrPassphraseEmpty represents error if passphrase is empty
+	ErrPassphraseEmpty = errors.New("Passphrase should not be empty")
+	// ErrPassphraseMismatch represents error if passphrase confirmation differs
+	ErrPassphraseMismatch = errors.New("Passphrases do not match")
+	// ErrRecoverTargetExists represents error if recovered save would overwrite existing files
+	ErrRecoverTargetExists = errors.New("Recovery target already exists")
+)
+
+// InitKey encrypts game save stored in git repository by key derived
+// from keyFile, which is generated if it is not exist, or from a new
+// passphrase if keyFile is empty. File names are encrypted too if names
+// is set. Snapshot committed before is re-encrypted, but git history
+// still holds its plain copies
+func (s *Service) InitKey(keyFile string, names bool) error {
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
+	}
+	if s.OSRepository.Exists(path.Join(repository.GameSaveRoot, repository.KeyFile)) {
+		return ErrKeyExists
+	}
+	return s.rekey(nil, keyFile, passphraseEnv, names, fmt.Sprintf("Encrypt %s", gameName))
+}
+
+// RotateKey re-encrypts game save stored in git repository by a new key
+// derived from keyFile or from a new passphrase if keyFile is empty
+func (s *Service) RotateKey(keyFile string) error {
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
+	}
+	old, err := s.snapshotCipher()
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return ErrKeyNotExist
+	}
+	return s.rekey(old, keyFile, newPassphraseEnv, old.Names, fmt.Sprintf("Rotate key of %s", gameName))
+}
+
+// DecryptTo writes plain copy of game save stored in git repository into
+// dir, one directory per save location, without touching save folders
+// nor backups. Files not matching the manifest are reported but kept
+func (s *Service) DecryptTo(dir string) error {
+	if _, err := s.gameName(); err != nil {
+		return err
+	}
+	cipher, err := s.snapshotCipher()
+	if err != nil {
+		return err
+	}
+	manifest, err := s.readManifest(cipher)
+	if err != nil {
+		return err
+	}
+	locations, err := s.snapshotLocations(manifest)
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return ErrSnapshotNotExist
+	}
+	for _, location := range locations {
+		if s.OSRepository.Exists(path.Join(dir, location.RepoDir)) {
+			return ErrRecoverTargetExists
+		}
+	}
+	err = s.OSRepository.MakeDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, location := range locations {
+		target := path.Join(dir, location.RepoDir)
+		err = s.extractSnapshot(location, target, cipher)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			continue
+		}
+		problems, err := s.checkManifest(*manifest, location.RepoDir, target, location.Filter)
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			fmt.Printf("Warning: %s: %s\n", problem.Path, problem.Problem)
+		}
+	}
+	return nil
+}
+
+// rekey replaces snapshot encrypted by old, or plain if old is nil,
+// with snapshot encrypted by a new key and commits it with message
+func (s *Service) rekey(old *repository.Cipher, keyFile, env string, names bool, message string) error {
+	kdf, secret, err := s.newSecret(keyFile, env)
+	if err != nil {
+		return err
+	}
+	params, err := repository.NewKeyParams(kdf, names)
+	if err != nil {
+		return err
+	}
+	cipher, err := params.Init(secret)
+	if err != nil {
+		return err
+	}
+	previous, err := s.readManifest(old)
+	if err != nil {
+		return err
+	}
+	locations, err := s.snapshotLocations(previous)
+	if err != nil {
+		return err
+	}
+	work := path.Join(repository.BackupRoot, workDirName, "snapshot")
+	err = s.OSRepository.Remove(work)
+	if err != nil {
+		return err
+	}
+	defer s.OSRepository.Remove(work)
+	for i := range locations {
+		locations[i].Path = path.Join(work, locations[i].RepoDir)
+		err = s.extractSnapshot(locations[i], locations[i].Path, old)
+		if err != nil {
+			return err
+		}
+	}
+	manifest := repository.NewManifest()
+	for _, location := range locations {
+		err = s.storeSave(location, manifest, cipher)
+		if err != nil {
+			return err
+		}
+	}
+	keepModTimes(manifest, previous)
+	data, err := params.Encode()
+	if err != nil {
+		return err
+	}
+	err = s.OSRepository.WriteFile(path.Join(repository.GameSaveRoot, repository.KeyFile), data)
+	if err != nil {
+		return err
+	}
+	err = s.writeManifest(manifest, cipher)
+	if err != nil {
+		return err
+	}
+	err = s.OSRepository.SetConfig(keyFileKey, keyFile)
+	if err != nil {
+		return err
+	}
+	return s.GitRepository.Commit(message)
+}
+
+// snapshotLocations returns every save location stored in GameSaveRoot
+// as directory or archive regardless of configuration, skipping files
+// of git and gamesave. Only locations listed in manifest are returned
+// if there is one
+func (s *Service) snapshotLocations(manifest *repository.Manifest) ([]SaveLocation, error) {
+	names, err := s.OSRepository.ListDir(repository.GameSaveRoot)
+	if err != nil {
+		return nil, err
+	}
+	roots := map[string]bool{}
+	if manifest != nil {
+		for key := range manifest.Files {
+			roots[strings.SplitN(key, "/", 2)[0]] = true
+		}
+	}
+	locations := []SaveLocation{}
+	for _, name := range names {
+		location := SaveLocation{
+			Name:    name,
+			RepoDir: name,
+			Storage: repository.StorageFiles,
+			Filter:  repository.TreeFilter{Links: repository.SymlinkPreserve},
+		}
+		if strings.HasSuffix(name, repository.ArchiveExt) {
+			location.Name = strings.TrimSuffix(name, repository.ArchiveExt)
+			location.RepoDir = location.Name
+			location.Storage = repository.StorageArchive
+		}
+		if isReservedRepoDir(location.RepoDir) || (manifest != nil && !roots[location.RepoDir]) {
+			continue
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+// snapshotCipher returns Cipher of the checked out snapshot,
+// returns nil if the snapshot is not encrypted
+func (s *Service) snapshotCipher() (*repository.Cipher, error) {
+	keyPath := path.Join(repository.GameSaveRoot, repository.KeyFile)
+	if !s.OSRepository.Exists(keyPath) {
+		return nil, nil
+	}
+	data, err := s.OSRepository.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.unlock(data)
+}
+
+// unlock parses key parameters from data and derives the key
+// using configured key file or passphrase
+func (s *Service) unlock(data []byte) (*repository.Cipher, error) {
+	params, err := repository.ParseKeyParams(data)
+	if err != nil {
+		return nil, err
+	}
+	keyFile, err := s.configValue(keyFileKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := s.readSecret(params.KDF, keyFile, "Passphrase: ", passphraseEnv)
+	if err != nil {
+		return nil, err
+	}
+	return params.Unlock(secret)
+}
+
+// newSecret returns key derivation and secret of a new key. Key file
+// is generated if it is not exist, passphrase is asked twice
+func (s *Service) newSecret(keyFile, env string) (string, []byte, error) {
+	if keyFile != "" {
+		expanded, err := s.OSRepository.ExpandPath(keyFile)
+		if err != nil {
+			return "", nil, err
+		}
+		if !s.OSRepository.Exists(expanded) {
+			err = s.OSRepository.CreateKeyFile(expanded)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		secret, err := s.readSecret(repository.KDFKeyFile, keyFile, "", "")
+		return repository.KDFKeyFile, secret, err
+	}
+	secret, err := s.readSecret(repository.KDFPassphrase, "", "New passphrase: ", env)
+	if err != nil {
+		return "", nil, err
+	}
+	confirm, err := s.readSecret(repository.KDFPassphrase, "", "Confirm passphrase: ", env)
+	if err != nil {
+		return "", nil, err
+	}
+	if !bytes.Equal(secret, confirm) {
+		return "", nil, ErrPassphraseMismatch
+	}
+	return repository.KDFPassphrase, secret, nil
+}
+
+// readSecret reads content of keyFile if kdf is KDFKeyFile,
+// otherwise reads passphrase from env or terminal
+func (s *Service) readSecret(kdf, keyFile, prompt, env string) ([]byte, error) {
+	if kdf == repository.KDFKeyFile {
+		if keyFile == "" {
+			return nil, ErrKeyFileEmpty
+		}
+		expanded, err := s.OSRepository.ExpandPath(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return s.OSRepository.ReadFile(expanded)
+	}
+	passphrase, err := s.OSRepository.ReadPassphrase(prompt, env)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseEmpty
+	}
+	return []byte(passphrase), nil
+}
+
+// packEncrypted packs location into plain archive outside GameSaveRoot
+// and stores its encrypted copy as the snapshot
+func (s *Service) packEncrypted(location SaveLocation, cipher *repository.Cipher) error {
+	work := path.Join(repository.BackupRoot, workDirName)
+	err := s.OSRepository.MakeDir(work)
+	if err != nil {
+		return err
+	}
+	plain := path.Join(work, location.RepoDir+repository.ArchiveExt)
+	defer s.OSRepository.Remove(plain)
+	err = s.OSRepository.PackArchive(location.Path, plain, location.Filter)
+	if err != nil {
+		return err
+	}
+	return s.OSRepository.EncryptTree(plain, location.snapshotArchive(), repository.TreeFilter{Links: repository.SymlinkPreserve}, cipher)
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestInitKey(t *testing.T) {
+	t.Run("encrypt saved snapshot", func(t *testing.T) {
+		service := initGameService(t, 1)
+		encryptSave(t, service, true)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		if gitRepo.commits != 2 {
+			t.Errorf("Got %d commits expect 2", gitRepo.commits)
+		}
+		if !osRepo.Exists(path.Join(repository.GameSaveRoot, repository.KeyFile)) {
+			t.Error("Should write key parameters")
+		}
+		for p, content := range snapshotFiles(osRepo) {
+			if strings.Contains(p, "slot1") || strings.Contains(content, "data1") {
+				t.Errorf("Should not store plain save data, found %s", p)
+			}
+		}
+		osRepo.writeFile("game.save/slot1", "newer")
+		err := service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "data1")
+	})
+
+	t.Run("encrypt by key file", func(t *testing.T) {
+		service := initGameService(t, 1)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.MakeDir(repository.GameSaveRoot)
+		err := service.InitKey("<home>/game.key", false)
+		assertNotError(t, err)
+		if !osRepo.Exists("/home/mock/game.key") {
+			t.Error("Should generate key file")
+		}
+		assertEqual(t, getConfig(t, osRepo, "key_file"), "<home>/game.key")
+		err = service.SaveGame()
+		assertNotError(t, err)
+		if !osRepo.Exists(path.Join(repository.GameSaveRoot, "game.save", "slot1")) {
+			t.Error("Should keep file names")
+		}
+		osRepo.writeFile("game.save/slot1", "newer")
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "data1")
+	})
+
+	t.Run("refuse encrypted game save", func(t *testing.T) {
+		service := initGameService(t, 1)
+		encryptSave(t, service, false)
+		err := service.InitKey("", false)
+		if err != ErrKeyExists {
+			t.Errorf("Got %v expect %v", err, ErrKeyExists)
+		}
+	})
+
+	t.Run("refuse empty passphrase", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.passphrases[passphraseEnv] = ""
+		err := service.InitKey("", false)
+		if err != ErrPassphraseEmpty {
+			t.Errorf("Got %v expect %v", err, ErrPassphraseEmpty)
+		}
+	})
+}
+
+func TestEncryptedSave(t *testing.T) {
+	t.Run("encrypt unchanged save identically", func(t *testing.T) {
+		service := initGameService(t, 1)
+		encryptSave(t, service, true)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		before := snapshotFiles(osRepo)
+		err := service.SaveGame()
+		assertNotError(t, err)
+		after := snapshotFiles(osRepo)
+		if len(before) != len(after) {
+			t.Fatalf("Got %d files expect %d", len(after), len(before))
+		}
+		for p, content := range before {
+			if after[p] != content {
+				t.Errorf("Should not change %s", p)
+			}
+		}
+	})
+
+	t.Run("save and load encrypted archive", func(t *testing.T) {
+		service := initGameService(t, 1)
+		service.AddConfig("storage", "archive")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.passphrases[passphraseEnv] = "secret"
+		osRepo.MakeDir(repository.GameSaveRoot)
+		err := service.InitKey("", false)
+		assertNotError(t, err)
+		err = service.SaveGame()
+		assertNotError(t, err)
+		archive := path.Join(repository.GameSaveRoot, "game.save"+repository.ArchiveExt)
+		if osRepo.files[archive] == "archive" {
+			t.Error("Should encrypt archive")
+		}
+		osRepo.writeFile("game.save/slot1", "newer")
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "data1")
+	})
+
+	t.Run("load by wrong passphrase", func(t *testing.T) {
+		service := initGameService(t, 1)
+		encryptSave(t, service, false)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.passphrases[passphraseEnv] = "wrong"
+		osRepo.writeFile("game.save/slot1", "newer")
+		err := service.LoadGame(LoadOptions{})
+		if err != repository.ErrKeyInvalid {
+			t.Errorf("Got %v expect %v", err, repository.ErrKeyInvalid)
+		}
+		assertEqual(t, osRepo.files["game.save/slot1"], "newer")
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	t.Run("rotate passphrase", func(t *testing.T) {
+		service := initGameService(t, 1)
+		encryptSave(t, service, true)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.passphrases[newPassphraseEnv] = "another"
+		err := service.RotateKey("")
+		assertNotError(t, err)
+		osRepo.writeFile("game.save/slot1", "newer")
+		err = service.LoadGame(LoadOptions{})
+		if err != repository.ErrKeyInvalid {
+			t.Errorf("Got %v expect %v", err, repository.ErrKeyInvalid)
+		}
+		osRepo.passphrases[passphraseEnv] = "another"
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "data1")
+	})
+
+	t.Run("rotate hidden save location", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./.factorio")
+		service.AddConfig("game_name", "game")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.passphrases[passphraseEnv] = "secret"
+		osRepo.writeFile(".factorio/slot1", "data1")
+		assertNotError(t, service.SaveGame())
+		assertNotError(t, service.InitKey("", true))
+		osRepo.passphrases[newPassphraseEnv] = "another"
+		assertNotError(t, service.RotateKey(""))
+		osRepo.passphrases[passphraseEnv] = "another"
+		osRepo.writeFile(".factorio/slot1", "newer")
+		err := service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files[".factorio/slot1"], "data1")
+		err = service.DecryptTo("recovered")
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["recovered/.factorio/slot1"], "data1")
+	})
+
+	t.Run("rotate plain game save", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		err := service.RotateKey("")
+		if err != ErrKeyNotExist {
+			t.Errorf("Got %v expect %v", err, ErrKeyNotExist)
+		}
+	})
+}
+
+func TestDecryptTo(t *testing.T) {
+	t.Run("decrypt snapshot into directory", func(t *testing.T) {
+		service := initGameService(t, 1)
+		encryptSave(t, service, true)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		err := service.DecryptTo("recovered")
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["recovered/game.save/slot1"], "data1")
+		err = service.DecryptTo("recovered")
+		if err != ErrRecoverTargetExists {
+			t.Errorf("Got %v expect %v", err, ErrRecoverTargetExists)
+		}
+	})
+
+	t.Run("decrypt without snapshot", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		service.OSRepository.MakeDir(repository.GameSaveRoot)
+		err := service.DecryptTo("recovered")
+		if err != ErrSnapshotNotExist {
+			t.Errorf("Got %v expect %v", err, ErrSnapshotNotExist)
+		}
+	})
+}
+
+func TestVerifyEncrypted(t *testing.T) {
+	t.Run("verify encrypted names and content", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		osRepo.passphrases[passphraseEnv] = "secret"
+		params, _ := repository.NewKeyParams(repository.KDFPassphrase, true)
+		cipher, _ := params.Init([]byte("secret"))
+		committed := map[string][]byte{}
+		for file, content := range gitRepo.files {
+			if file == repository.ManifestFile {
+				committed[file] = cipher.Seal(content)
+			} else {
+				name, _ := cipher.SealName(path.Base(file))
+				committed["game.save/"+name] = cipher.Seal(content)
+			}
+		}
+		committed[repository.KeyFile], _ = params.Encode()
+		gitRepo.files = committed
+		report, err := service.Verify("")
+		assertNotError(t, err)
+		if !report.OK() {
+			t.Errorf("Should be OK, got %+v", report)
+		}
+		name, _ := cipher.SealName("slot1")
+		gitRepo.files["game.save/"+name] = []byte("corrupted")
+		report, _ = service.Verify("")
+		if len(report.Repo) != 1 || report.Repo[0].Problem != ProblemModified {
+			t.Errorf("Should report modified file, got %+v", report.Repo)
+		}
+	})
+}
+
+// encryptSave saves game then encrypts it by passphrase "secret"
+func encryptSave(t *testing.T, service *Service, names bool) {
+	t.Helper()
+	service.OSRepository.(*OsRepositoryMock).passphrases[passphraseEnv] = "secret"
+	err := service.SaveGame()
+	if err == nil {
+		err = service.InitKey("", names)
+	}
+	if err != nil {
+		t.Fatalf("[Helper-encryptSave] Error: %v", err)
+	}
+}
+
+// snapshotFiles returns copy of every file inside GameSaveRoot
+func snapshotFiles(osRepo *OsRepositoryMock) map[string]string {
+	files := map[string]string{}
+	for p, content := range osRepo.files {
+		if strings.HasPrefix(p, repository.GameSaveRoot+"/") {
+			files[p] = content
+		}
+	}
+	return files
+}
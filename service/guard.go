@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// DefaultConfirmThreshold is number of overwritten files above which load asks for confirmation
+	DefaultConfirmThreshold = 50
+
+	confirmThresholdKey = "confirm_threshold"
+)
+
+var (
+	// ErrLoadCanceled represents error if load is not confirmed
+	ErrLoadCanceled = errors.New("Load canceled")
+
+	// systemDirs are refused as save path
+	systemDirs = []string{
+		"/", "/Applications", "/Library", "/System", "/Users", "/Volumes",
+		"/home", "/media", "/mnt", "/opt", "/run", "/srv", "/tmp", "/var",
+	}
+	// systemTrees are refused as save path along with everything inside them
+	systemTrees = []string{
+		"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64",
+		"/proc", "/sbin", "/sys", "/usr",
+	}
+)
+
+// LoadOptions changes how LoadGame overwrites save folders
+type LoadOptions struct {
+	// AssumeYes skips confirmation before many files are overwritten
+	AssumeYes bool
+}
+
+// SavePathError represents error if save path is too dangerous to be overwritten
+type SavePathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *SavePathError) Error() string {
+	return fmt.Sprintf("Refusing save path %s: %s", e.Path, e.Reason)
+}
+
+// checkSavePath returns SavePathError if p is a system directory,
+// the home directory, GameSaveRoot, BackupRoot, their parents or
+// inside them. Symbolic links are resolved before p is checked
+func (s *Service) checkSavePath(p string) error {
+	resolved, err := s.OSRepository.ResolvePath(p)
+	if err != nil {
+		return err
+	}
+	for _, dir := range systemDirs {
+		if resolved == dir {
+			return &SavePathError{p, "it is a system directory"}
+		}
+	}
+	for _, dir := range systemTrees {
+		if isWithin(dir, resolved) {
+			return &SavePathError{p, "it is a system directory"}
+		}
+	}
+	home, err := s.OSRepository.ExpandPath("~")
+	if err != nil {
+		return err
+	}
+	if home, err = s.OSRepository.ResolvePath(home); err != nil {
+		return err
+	}
+	if resolved == home {
+		return &SavePathError{p, "it is the home directory"}
+	}
+	for _, root := range []string{repository.GameSaveRoot, repository.BackupRoot} {
+		root, err = s.OSRepository.ResolvePath(root)
+		if err != nil {
+			return err
+		}
+		if isWithin(resolved, root) {
+			return &SavePathError{p, "it contains gamesave directory " + root}
+		}
+		if isWithin(root, resolved) {
+			return &SavePathError{p, "it is inside gamesave directory " + root}
+		}
+	}
+	return nil
+}
+
+// confirmLoad asks for confirmation if loading snapshot would overwrite
+// or remove more existing files than the configured threshold
+func (s *Service) confirmLoad(locations []SaveLocation, manifest *repository.Manifest) error {
+	threshold := DefaultConfirmThreshold
+	value, err := s.configValue(confirmThresholdKey)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return &repository.ConfigError{Field: confirmThresholdKey, Err: ErrLimitInvalid}
+		}
+		threshold = parsed
+	}
+	if threshold == 0 {
+		return nil
+	}
+	overwritten := 0
+	for _, location := range locations {
+		if !s.OSRepository.Exists(location.Path) {
+			continue
+		}
+		if manifest == nil {
+			entries, err := s.OSRepository.ListFiles(location.Path, location.Filter)
+			if err != nil {
+				return err
+			}
+			overwritten += len(entries)
+			continue
+		}
+		problems, err := s.checkManifest(*manifest, location.RepoDir, location.Path, location.Filter)
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			if problem.Problem != ProblemMissing {
+				overwritten++
+			}
+		}
+	}
+	if overwritten <= threshold {
+		return nil
+	}
+	confirmed, err := s.OSRepository.Confirm(fmt.Sprintf(
+		"Load will overwrite or remove %d existing files, continue?", overwritten,
+	))
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return ErrLoadCanceled
+	}
+	return nil
+}
+
+// isWithin checks whether p is dir or inside dir
+func isWithin(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestCheckSavePath(t *testing.T) {
+	t.Run("refuse dangerous save paths", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		dangerous := []string{
+			"/", "/etc", "/usr/share/game", "/home", "~", "/home/mock/",
+			repository.GameSaveRoot, path.Join(repository.GameSaveRoot, "game.save"),
+			path.Dir(repository.GameSaveRoot), repository.BackupRoot,
+		}
+		for _, p := range dangerous {
+			service.OSRepository.MakeDir(p)
+			err := service.SetSavePath("", p)
+			if _, ok := err.(*SavePathError); !ok {
+				t.Errorf("Should refuse %s, got %v", p, err)
+			}
+		}
+		assertEqual(t, getConfig(t, service.OSRepository, "save_path"), "")
+	})
+
+	t.Run("accept game folder", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		for _, p := range []string{"<home>/game.save", "/tmp/game", "/home/mock/.config/game"} {
+			err := setSavePath(service, "", p)
+			assertNotError(t, err)
+		}
+	})
+
+	t.Run("refuse missing save path", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.SetSavePath("", "./game.save")
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+	})
+
+	t.Run("refuse save of configured dangerous path", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "/etc/game")
+		service.AddConfig("game_name", "game")
+		service.OSRepository.MakeDir("/etc/game")
+		err := service.SaveGame()
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+		_, err = service.PlanSave()
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+	})
+
+	t.Run("refuse load into configured dangerous path", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "<home>")
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "mock/slot1")
+		err := service.LoadGame(LoadOptions{})
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+	})
+}
+
+func TestConfirmLoad(t *testing.T) {
+	t.Run("cancel load overwriting many files", func(t *testing.T) {
+		service := initGameService(t, 4)
+		saveThenModify(t, service, 3)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		err := service.LoadGame(LoadOptions{})
+		if err != ErrLoadCanceled {
+			t.Errorf("Got %v expect %v", err, ErrLoadCanceled)
+		}
+		if osRepo.confirmed != 1 {
+			t.Errorf("Got %d confirmations expect 1", osRepo.confirmed)
+		}
+		assertEqual(t, osRepo.files["game.save/slot1"], "newer")
+	})
+
+	t.Run("load after confirmation", func(t *testing.T) {
+		service := initGameService(t, 4)
+		saveThenModify(t, service, 3)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.confirm = true
+		err := service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "data1")
+	})
+
+	t.Run("skip confirmation by option", func(t *testing.T) {
+		service := initGameService(t, 4)
+		saveThenModify(t, service, 3)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		err := service.LoadGame(LoadOptions{AssumeYes: true})
+		assertNotError(t, err)
+		if osRepo.confirmed != 0 {
+			t.Errorf("Got %d confirmations expect 0", osRepo.confirmed)
+		}
+	})
+
+	t.Run("skip confirmation below threshold", func(t *testing.T) {
+		service := initGameService(t, 4)
+		saveThenModify(t, service, 5)
+		err := service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+	})
+
+	t.Run("disable confirmation", func(t *testing.T) {
+		service := initGameService(t, 4)
+		saveThenModify(t, service, 0)
+		err := service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+	})
+}
+
+// saveThenModify saves game then modifies all of its files,
+// confirmation threshold is set to threshold
+func saveThenModify(t *testing.T, service *Service, threshold int) {
+	t.Helper()
+	err := service.SaveGame()
+	if err == nil {
+		err = service.AddConfig("confirm_threshold", fmt.Sprint(threshold))
+	}
+	if err != nil {
+		t.Fatalf("[Helper-saveThenModify] Error: %v", err)
+	}
+	osRepo := service.OSRepository.(*OsRepositoryMock)
+	for file := range osRepo.selectFiles("game.save", repository.TreeFilter{}) {
+		osRepo.writeFile(path.Join("game.save", file), "newer")
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// HookPreSave runs before save, its failure aborts save
+	HookPreSave = "pre_save"
+	// HookPostSave runs after save
+	HookPostSave = "post_save"
+	// HookPreLoad runs before load, its failure aborts load
+	HookPreLoad = "pre_load"
+	// HookPostLoad runs after load
+	HookPostLoad = "post_load"
+	// HookOnConflict runs when sync finds both sides changed, its failure aborts sync
+	HookOnConflict = "on_conflict"
+)
+
+// HookError represents error if hook command fails
+type HookError struct {
+	Hook string
+	Err  error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("Hook %s failed: %v", e.Hook, e.Err)
+}
+
+// Unwrap returns the error of the hook command
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// runHook runs command configured for hook, if any, with environment
+// variables naming the hook, the game, GameSaveRoot, this machine,
+// save paths of locations and the latest commit of the game
+func (s *Service) runHook(hook, gameName string, locations []SaveLocation) error {
+	command, err := s.configValue(hook)
+	if err != nil || command == "" {
+		return err
+	}
+	machine, err := s.OSRepository.MachineID()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(locations))
+	for _, location := range locations {
+		paths = append(paths, location.Path)
+	}
+	env := []string{
+		"GAMESAVE_HOOK=" + hook,
+		"GAMESAVE_GAME=" + gameName,
+		repository.RootEnv + "=" + repository.GameSaveRoot,
+		repository.MachineEnv + "=" + machine,
+		"GAMESAVE_SAVE_PATHS=" + strings.Join(paths, string(filepath.ListSeparator)),
+	}
+	if commit, err := s.GitRepository.LastCommit(gameName); err == nil {
+		env = append(env, "GAMESAVE_COMMIT="+commit.Hash)
+	}
+	if err = s.OSRepository.RunCommand(command, env); err != nil {
+		return &HookError{Hook: hook, Err: err}
+	}
+	return nil
+}
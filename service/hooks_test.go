@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	t.Run("run hooks around save with game environment", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.AddConfig(HookPreSave, "echo pre")
+		service.AddConfig(HookPostSave, "echo post")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		assertNotError(t, service.SaveGame())
+		assertEqual(t, strings.Join(osRepo.commands, ","), "echo pre,echo post")
+		env := strings.Join(osRepo.commandEnv, "\n")
+		for _, variable := range []string{"GAMESAVE_HOOK=post_save", "GAMESAVE_GAME=game", "GAMESAVE_COMMIT=1"} {
+			if !strings.Contains(env, variable) {
+				t.Errorf("Got %q expect it to contain %s", env, variable)
+			}
+		}
+	})
+
+	t.Run("abort save if pre hook fails", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.AddConfig(HookPreSave, "false")
+		service.AddConfig(HookPostSave, "echo post")
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		service.OSRepository.(*OsRepositoryMock).writeFile(path.Join("game.save", "slot2"), "changed")
+		err := service.SaveGame()
+		var hookErr *HookError
+		if !errors.As(err, &hookErr) || hookErr.Hook != HookPreSave {
+			t.Errorf("Got %v expect error of %s hook", err, HookPreSave)
+		}
+		if gitRepo.commits != 0 {
+			t.Errorf("Got %d commits expect 0", gitRepo.commits)
+		}
+	})
+
+	t.Run("abort load if pre hook fails", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.AddConfig(HookPreLoad, "false")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		addSnapshot(t, service, "game.save/slot2")
+		err := service.LoadGame(LoadOptions{})
+		var hookErr *HookError
+		if !errors.As(err, &hookErr) || hookErr.Hook != HookPreLoad {
+			t.Errorf("Got %v expect error of %s hook", err, HookPreLoad)
+		}
+		assertEqual(t, osRepo.files[path.Join("game.save", "slot2")], "changed")
+	})
+
+	t.Run("run conflict hook before confirmation", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		syncSaved(t, service)
+		service.AddConfig(HookOnConflict, "false")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		service.GitRepository.(*GitRepositoryMock).commits++
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		addSnapshot(t, service, "game.save/slot2")
+		_, err := service.Sync()
+		var hookErr *HookError
+		if !errors.As(err, &hookErr) || osRepo.confirmed != 0 {
+			t.Errorf("Got %v after %d confirmations expect error of %s hook", err, osRepo.confirmed, HookOnConflict)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// DefaultGrowthWarning is percentage of growth since previous snapshot warned on save
+	DefaultGrowthWarning = 50
+	// DefaultMaxFiles is maximum number of files of a game save
+	DefaultMaxFiles = 10000
+	// DefaultMaxSize is maximum size in bytes of a game save
+	DefaultMaxSize = 512 << 20
+
+	growthWarningKey = "growth_warning"
+	maxFilesKey      = "max_files"
+	maxSizeKey       = "max_size"
+)
+
+var (
+	// ErrLimitInvalid represents error if limit is not a non-negative number
+	ErrLimitInvalid = errors.New("Limit is invalid, use a number such as 500, 200MB or 1GiB, 0 disables it")
+)
+
+// SaveLimits are the limits checked before save data is stored,
+// zero disables a limit
+type SaveLimits struct {
+	MaxSize       int64
+	MaxFiles      int
+	GrowthWarning int
+}
+
+// LocationUsage is the size and number of files of a save location
+type LocationUsage struct {
+	Location SaveLocation
+	Size     int64
+	Files    int
+}
+
+// LimitError represents error if save data exceeds SaveLimits
+type LimitError struct {
+	Limits SaveLimits
+	Usage  []LocationUsage
+}
+
+func (e *LimitError) Error() string {
+	size, files := totalUsage(e.Usage)
+	exceeded := []string{}
+	if e.Limits.MaxSize > 0 && size > e.Limits.MaxSize {
+		exceeded = append(exceeded, fmt.Sprintf("size %s is over %s", formatSize(size), formatSize(e.Limits.MaxSize)))
+	}
+	if e.Limits.MaxFiles > 0 && files > e.Limits.MaxFiles {
+		exceeded = append(exceeded, fmt.Sprintf("%d files are over %d", files, e.Limits.MaxFiles))
+	}
+	lines := []string{"Game save exceeds the limit: " + strings.Join(exceeded, ", ")}
+	for _, usage := range e.Usage {
+		lines = append(lines, fmt.Sprintf(
+			"  %s (%s): %s in %d files",
+			usage.Location.Name, usage.Location.Path, formatSize(usage.Size), usage.Files,
+		))
+	}
+	lines = append(lines, "Check the save path or raise the limit by set-limit")
+	return strings.Join(lines, "\n")
+}
+
+// saveLimits returns effective limits of the game, which may come from
+// the game, GAMESAVE_MAX_SIZE, GAMESAVE_MAX_FILES and
+// GAMESAVE_GROWTH_WARNING environment variables or global config like
+// any other config key. Limits not set anywhere are the defaults
+func (s *Service) saveLimits() (SaveLimits, error) {
+	size, err := s.limitValue(maxSizeKey, DefaultMaxSize)
+	if err != nil {
+		return SaveLimits{}, err
+	}
+	files, err := s.limitValue(maxFilesKey, DefaultMaxFiles)
+	if err != nil {
+		return SaveLimits{}, err
+	}
+	growth, err := s.limitValue(growthWarningKey, DefaultGrowthWarning)
+	if err != nil {
+		return SaveLimits{}, err
+	}
+	return SaveLimits{MaxSize: size, MaxFiles: int(files), GrowthWarning: int(growth)}, nil
+}
+
+func (s *Service) limitValue(key string, value int64) (int64, error) {
+	raw, err := s.configValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if raw == "" {
+		return value, nil
+	}
+	if key == maxSizeKey {
+		size, err := repository.ParseSize(raw)
+		if err != nil {
+			return 0, &repository.ConfigError{Field: key, Err: err}
+		}
+		return size, nil
+	}
+	count, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || count < 0 {
+		return 0, &repository.ConfigError{Field: key, Err: ErrLimitInvalid}
+	}
+	return count, nil
+}
+
+// checkLimits returns LimitError if save data of locations exceeds limits
+func (s *Service) checkLimits(locations []SaveLocation, limits SaveLimits) error {
+	usage := make([]LocationUsage, 0, len(locations))
+	for _, location := range locations {
+		entries, err := s.OSRepository.ListFiles(location.Path, location.Filter)
+		if err != nil {
+			return err
+		}
+		current := LocationUsage{Location: location, Files: len(entries)}
+		for _, entry := range entries {
+			current.Size += entry.Size
+		}
+		usage = append(usage, current)
+	}
+	size, files := totalUsage(usage)
+	if (limits.MaxSize > 0 && size > limits.MaxSize) ||
+		(limits.MaxFiles > 0 && files > limits.MaxFiles) {
+		return &LimitError{Limits: limits, Usage: usage}
+	}
+	return nil
+}
+
+// growthWarning returns warning if save data in manifest grows more
+// than limits.GrowthWarning percent since previous manifest
+func growthWarning(manifest repository.Manifest, previous *repository.Manifest, limits SaveLimits) string {
+	if previous == nil || limits.GrowthWarning == 0 {
+		return ""
+	}
+	before, after := manifestSize(*previous), manifestSize(manifest)
+	if before == 0 || (after-before)*100 <= before*int64(limits.GrowthWarning) {
+		return ""
+	}
+	return fmt.Sprintf(
+		"Warning: game save grows by %d%% since the previous save, from %s to %s",
+		(after-before)*100/before, formatSize(before), formatSize(after),
+	)
+}
+
+func manifestSize(manifest repository.Manifest) int64 {
+	var size int64
+	for _, entry := range manifest.Files {
+		size += entry.Size
+	}
+	return size
+}
+
+func totalUsage(usage []LocationUsage) (int64, int) {
+	var size int64
+	var files int
+	for _, location := range usage {
+		size += location.Size
+		files += location.Files
+	}
+	return size, files
+}
+
+// formatSize formats size in bytes into human readable size
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
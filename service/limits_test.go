@@ -0,0 +1,79 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestSaveLimits(t *testing.T) {
+	t.Run("refuse save over size limit", func(t *testing.T) {
+		service := initGameService(t, 2)
+		service.AddConfig("max_size", "8")
+		err := service.SaveGame()
+		limitErr, ok := err.(*LimitError)
+		if !ok {
+			t.Fatalf("Got %v expect LimitError", err)
+		}
+		message := limitErr.Error()
+		if !strings.Contains(message, "size 10 B is over 8 B") || !strings.Contains(message, "default (game.save): 10 B in 2 files") {
+			t.Errorf("Should summarize usage, got %s", message)
+		}
+		if service.OSRepository.Exists(repository.GameSaveRoot) {
+			t.Error("Should not store save over the limit")
+		}
+	})
+
+	t.Run("refuse save over global file limit", func(t *testing.T) {
+		service := initGameService(t, 2)
+		service.OSRepository.(*OsRepositoryMock).env["GAMESAVE_MAX_FILES"] = "1"
+		err := service.SaveGame()
+		if _, ok := err.(*LimitError); !ok {
+			t.Errorf("Got %v expect LimitError", err)
+		}
+	})
+
+	t.Run("game limit overrides global limit", func(t *testing.T) {
+		service := initGameService(t, 2)
+		service.OSRepository.(*OsRepositoryMock).env["GAMESAVE_MAX_FILES"] = "1"
+		service.AddConfig("max_files", "0")
+		err := service.SaveGame()
+		assertNotError(t, err)
+	})
+
+	t.Run("unset game limit by empty value", func(t *testing.T) {
+		service := initGameService(t, 2)
+		service.OSRepository.(*OsRepositoryMock).env["GAMESAVE_MAX_FILES"] = "1"
+		service.AddConfig("max_files", "0")
+		err := service.AddConfig("max_files", "")
+		assertNotError(t, err)
+		err = service.SaveGame()
+		if _, ok := err.(*LimitError); !ok {
+			t.Errorf("Got %v expect LimitError", err)
+		}
+	})
+
+	t.Run("set invalid limit", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		assertError(t, service.AddConfig("max_files", "many"))
+		assertError(t, service.AddConfig("growth_warning", "-5"))
+		assertError(t, service.AddConfig("max_size", "big"))
+	})
+}
+
+func TestGrowthWarning(t *testing.T) {
+	previous := repository.NewManifest()
+	previous.Files["game.save/slot1"] = repository.ManifestEntry{Size: 100}
+	manifest := repository.NewManifest()
+	manifest.Files["game.save/slot1"] = repository.ManifestEntry{Size: 300}
+	limits := SaveLimits{GrowthWarning: 50}
+	warning := growthWarning(manifest, &previous, limits)
+	if !strings.Contains(warning, "grows by 200%") {
+		t.Errorf("Should warn growth, got '%s'", warning)
+	}
+	limits.GrowthWarning = 300
+	assertEqual(t, growthWarning(manifest, &previous, limits), "")
+	limits.GrowthWarning = 0
+	assertEqual(t, growthWarning(manifest, &previous, limits), "")
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// DefaultLocation is the name of save location set by "save_path"
+	DefaultLocation = "default"
+
+	excludeKey  = "exclude"
+	includeKey  = "include"
+	savePathKey = "save_path"
+	storageKey  = "storage"
+	symlinksKey = "symlinks"
+)
+
+var (
+	// ErrLocationConflict represents error if two save locations share a repository directory
+	ErrLocationConflict = errors.New("Save locations use the same repository directory")
+	// ErrLocationNameInvalid represents error if save location name can not be a directory name
+	ErrLocationNameInvalid = errors.New("Save location name is invalid")
+)
+
+// SaveLocation is a folder holding part of game's save data
+// and the directory inside GameSaveRoot it is stored in.
+// Template is the configured path, Path is its expansion
+// on this machine. Filter selects files of the folder to be saved
+type SaveLocation struct {
+	Name     string
+	Path     string
+	RepoDir  string
+	Storage  string
+	Filter   repository.TreeFilter
+	Template string
+}
+
+// snapshotArchive is path of the location inside GameSaveRoot
+// when it is stored as archive
+func (l SaveLocation) snapshotArchive() string {
+	return l.snapshotDir() + repository.ArchiveExt
+}
+
+// snapshotDir is path of the location inside GameSaveRoot
+// when it is stored as files
+func (l SaveLocation) snapshotDir() string {
+	return path.Join(repository.GameSaveRoot, l.RepoDir)
+}
+
+// SetSavePath set path template of save location by its name,
+// empty name means DefaultLocation and empty path removes the location.
+// The template is stored as is and expanded whenever it is used, its
+// expansion should exist and should not be a dangerous path. Relative
+// template is stored joined to the working directory
+func (s *Service) SetSavePath(name, savePath string) error {
+	if savePath != "" {
+		var err error
+		if savePath, err = s.absoluteTemplate(savePath); err != nil {
+			return err
+		}
+		if err = s.validateSavePath(savePath); err != nil {
+			return err
+		}
+	}
+	if name == "" || name == DefaultLocation {
+		return s.OSRepository.SetConfig(savePathKey, savePath)
+	}
+	if !isValidLocationName(name) {
+		return ErrLocationNameInvalid
+	}
+	return s.OSRepository.SetConfig(savePathKey+"."+name, savePath)
+}
+
+// absoluteTemplate returns savePath joined to the working directory if
+// it expands to a relative path, so the stored template does not depend
+// on the directory gamesave is run from
+func (s *Service) absoluteTemplate(savePath string) (string, error) {
+	expanded, err := s.OSRepository.ExpandPath(savePath)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(expanded) {
+		return savePath, nil
+	}
+	return s.OSRepository.AbsPath(savePath)
+}
+
+// validateSavePath ensures expansion of path template exists
+// and is not a dangerous path
+func (s *Service) validateSavePath(savePath string) error {
+	expanded, err := s.OSRepository.ExpandPath(savePath)
+	if err != nil {
+		return err
+	}
+	if !s.OSRepository.Exists(expanded) {
+		return &SavePathError{savePath, "it does not exist"}
+	}
+	return s.checkSavePath(expanded)
+}
+
+// saveLocations returns every configured save location, DefaultLocation
+// first then the named ones sorted by name. DefaultLocation is stored
+// in directory named after its folder, or after folder of the unmapped
+// save path if it is mapped to this machine, named ones in directory
+// of their name
+func (s *Service) saveLocations() ([]SaveLocation, error) {
+	config, err := s.OSRepository.ListConfig()
+	if err != nil {
+		return nil, err
+	}
+	locations := []SaveLocation{}
+	if template := config[savePathKey]; template != "" {
+		locations = append(locations, SaveLocation{
+			Name:     DefaultLocation,
+			RepoDir:  s.mappedRepoDir(),
+			Template: template,
+		})
+	}
+	names := []string{}
+	for key, value := range config {
+		if strings.HasPrefix(key, savePathKey+".") && value != "" {
+			names = append(names, strings.TrimPrefix(key, savePathKey+"."))
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		locations = append(locations, SaveLocation{
+			Name:     name,
+			RepoDir:  name,
+			Template: config[savePathKey+"."+name],
+		})
+	}
+	if len(locations) == 0 {
+		return nil, ErrSavePathEmpty
+	}
+	symlinks, err := repository.ParseSymlinkPolicy(config[symlinksKey])
+	if err != nil {
+		return nil, &repository.ConfigError{Field: symlinksKey, Err: err}
+	}
+	storage, err := repository.ParseStorage(config[storageKey])
+	if err != nil {
+		return nil, &repository.ConfigError{Field: storageKey, Err: err}
+	}
+	filter := repository.TreeFilter{
+		Links:   symlinks,
+		Include: splitPatterns(config[includeKey]),
+		Exclude: splitPatterns(config[excludeKey]),
+	}
+	for i := range locations {
+		locations[i].Storage = storage
+		locations[i].Filter = filter
+		expanded, err := s.OSRepository.ExpandPath(locations[i].Template)
+		if err != nil {
+			return nil, err
+		}
+		locations[i].Path = path.Clean(expanded)
+		if locations[i].RepoDir == "" {
+			locations[i].RepoDir = path.Base(filepath.ToSlash(locations[i].Path))
+		}
+		if locations[i].Name != DefaultLocation && !isValidLocationName(locations[i].Name) {
+			return nil, ErrLocationNameInvalid
+		}
+		if isReservedRepoDir(locations[i].RepoDir) {
+			return nil, &SavePathError{locations[i].Path, "its folder name is reserved by the repository"}
+		}
+	}
+	repoDirs := map[string]bool{}
+	for _, location := range locations {
+		if repoDirs[location.RepoDir] {
+			return nil, ErrLocationConflict
+		}
+		repoDirs[location.RepoDir] = true
+	}
+	return locations, nil
+}
+
+// mappedRepoDir returns folder name of the unmapped save path of the
+// game if its DefaultLocation is mapped to this machine, so every
+// machine stores it in the same directory, otherwise empty
+func (s *Service) mappedRepoDir() string {
+	machine, err := s.OSRepository.MachineID()
+	if err != nil {
+		return ""
+	}
+	config, err := s.OSRepository.ListScopeConfig(repository.ScopeGame)
+	if err != nil || config[savePathKey] == "" || config[savePathKey+"@"+machine] == "" {
+		return ""
+	}
+	expanded, err := s.OSRepository.ExpandPath(config[savePathKey])
+	if err != nil {
+		return ""
+	}
+	return path.Base(filepath.ToSlash(path.Clean(expanded)))
+}
+
+// splitPatterns splits comma separated patterns of TreeFilter
+func splitPatterns(value string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// isValidLocationName reports whether name can be used as repository
+// directory of a named save location, hidden names are refused
+func isValidLocationName(name string) bool {
+	return !strings.HasPrefix(name, ".") && !isReservedRepoDir(name)
+}
+
+// isReservedRepoDir reports whether dir can not be a directory inside
+// GameSaveRoot, as it is not a single folder name or is used by git
+// or gamesave itself
+func isReservedRepoDir(dir string) bool {
+	return dir == "" || dir == "." || dir == ".." ||
+		strings.ContainsAny(dir, "/\\") ||
+		strings.HasPrefix(dir, ".git") ||
+		strings.HasPrefix(dir, ".gamesave")
+}
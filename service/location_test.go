@@ -0,0 +1,207 @@
+package service
+
+import (
+	"path"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestSetSavePath(t *testing.T) {
+	t.Run("set default save path", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := setSavePath(service, "", "./game.save")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, service.OSRepository, "save_path"), "/work/game.save")
+	})
+
+	t.Run("set named save path", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := setSavePath(service, "memcard", "./memcard")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, service.OSRepository, "save_path.memcard"), "/work/memcard")
+	})
+
+	t.Run("store template unexpanded", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := setSavePath(service, "", "<home>/game.save")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, service.OSRepository, "save_path"), "<home>/game.save")
+	})
+
+	t.Run("set invalid template", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := setSavePath(service, "", "<unknown>/game.save")
+		assertError(t, err)
+	})
+
+	t.Run("set invalid location name", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		for _, name := range []string{"..", "a/b", ".gamesave-manifest.json", ".git", ".hidden"} {
+			err := setSavePath(service, name, "./memcard")
+			assertError(t, err)
+		}
+	})
+}
+
+func TestSaveLocations(t *testing.T) {
+	t.Run("list default then named locations", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		setSavePath(service, "states", "./emu/states/")
+		setSavePath(service, "", "./emu/saves")
+		setSavePath(service, "memcard", "./emu/memcard")
+		locations, err := service.saveLocations()
+		assertNotError(t, err)
+		if len(locations) != 3 {
+			t.Fatalf("Got %d locations expect 3", len(locations))
+		}
+		assertEqual(t, locations[0].RepoDir, "saves")
+		assertEqual(t, locations[1].RepoDir, "memcard")
+		assertEqual(t, locations[2].Path, "/work/emu/states")
+	})
+
+	t.Run("expand path template", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		setSavePath(service, "", "<home>/saves")
+		locations, err := service.saveLocations()
+		assertNotError(t, err)
+		assertEqual(t, locations[0].Path, "/home/mock/saves")
+		assertEqual(t, locations[0].Template, "<home>/saves")
+		assertEqual(t, locations[0].RepoDir, "saves")
+	})
+
+	t.Run("apply symlinks policy to every location", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		setSavePath(service, "", "./saves")
+		setSavePath(service, "memcard", "./memcard")
+		service.AddConfig("symlinks", "follow")
+		locations, err := service.saveLocations()
+		assertNotError(t, err)
+		for _, location := range locations {
+			assertEqual(t, string(location.Filter.Links), "follow")
+		}
+	})
+
+	t.Run("skip removed location", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		setSavePath(service, "memcard", "./memcard")
+		setSavePath(service, "memcard", "")
+		_, err := service.saveLocations()
+		assertError(t, err)
+	})
+
+	t.Run("store hidden folder under its name", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		setSavePath(service, "", "<home>/.factorio")
+		locations, err := service.saveLocations()
+		assertNotError(t, err)
+		assertEqual(t, locations[0].RepoDir, ".factorio")
+	})
+
+	t.Run("refuse reserved repository directory", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game/.git")
+		_, err := service.saveLocations()
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+		service.AddConfig("save_path", "./saves")
+		service.AddConfig("save_path..git", "./game")
+		_, err = service.saveLocations()
+		if err != ErrLocationNameInvalid {
+			t.Errorf("Got %v expect %v", err, ErrLocationNameInvalid)
+		}
+	})
+
+	t.Run("conflicting repository directory", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		setSavePath(service, "", "./saves/memcard")
+		setSavePath(service, "memcard", "./memcard")
+		_, err := service.saveLocations()
+		assertError(t, err)
+	})
+}
+
+func TestMultipleLocations(t *testing.T) {
+	t.Run("save and load every location", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		setSavePath(service, "", "./saves")
+		setSavePath(service, "profile", "./config/profile")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("/work/saves/slot1", "save")
+		osRepo.writeFile("/work/config/profile/user.ini", "profile")
+		err := service.SaveGame()
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files[path.Join(repository.GameSaveRoot, "profile/user.ini")], "profile")
+		osRepo.writeFile("/work/saves/slot1", "newer")
+		osRepo.writeFile("/work/config/profile/user.ini", "newer")
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["/work/saves/slot1"], "save")
+		assertEqual(t, osRepo.files["/work/config/profile/user.ini"], "profile")
+	})
+
+	t.Run("roll back every location when one fails", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		setSavePath(service, "", "./saves")
+		setSavePath(service, "profile", "./profile")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("/work/saves/slot1", "save")
+		osRepo.writeFile("/work/profile/user.ini", "profile")
+		service.SaveGame()
+		osRepo.writeFile("/work/saves/slot1", "newer")
+		osRepo.writeFile("/work/profile/user.ini", "newer")
+		osRepo.failRename = "/work/.profile.gamesave-staging"
+		err := service.LoadGame(LoadOptions{})
+		assertError(t, err)
+		assertEqual(t, osRepo.files["/work/saves/slot1"], "newer")
+		assertEqual(t, osRepo.files["/work/profile/user.ini"], "newer")
+	})
+}
+
+// setSavePath creates the expanded save path then sets it
+func setSavePath(service *Service, name, savePath string) error {
+	expanded, err := service.OSRepository.ExpandPath(savePath)
+	if err == nil && savePath != "" {
+		expanded, _ = service.OSRepository.AbsPath(expanded)
+		service.OSRepository.MakeDir(expanded)
+	}
+	return service.SetSavePath(name, savePath)
+}
+
+func TestFilteredSave(t *testing.T) {
+	t.Run("save selected files and keep unsynced ones on load", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		service.AddConfig("include", "*.sav, profile/")
+		service.AddConfig("exclude", "cache.sav")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("game.save/slot1.sav", "data")
+		osRepo.writeFile("game.save/cache.sav", "cache")
+		osRepo.writeFile("game.save/profile/settings.ini", "settings")
+		osRepo.writeFile("game.save/screenshot.png", "image")
+		err := service.SaveGame()
+		assertNotError(t, err)
+		snapshot := repository.GameSaveRoot + "/game.save/"
+		for _, file := range []string{"slot1.sav", "profile/settings.ini"} {
+			if !osRepo.Exists(snapshot + file) {
+				t.Errorf("Should save %s", file)
+			}
+		}
+		for _, file := range []string{"cache.sav", "screenshot.png"} {
+			if osRepo.Exists(snapshot + file) {
+				t.Errorf("Should not save %s", file)
+			}
+		}
+		osRepo.writeFile("game.save/slot1.sav", "newer")
+		osRepo.writeFile("game.save/screenshot.png", "newer image")
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1.sav"], "data")
+		assertEqual(t, osRepo.files["game.save/screenshot.png"], "newer image")
+		assertEqual(t, osRepo.files["game.save/cache.sav"], "cache")
+	})
+}
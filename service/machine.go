@@ -0,0 +1,69 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+// Machine is a machine known by the current game along with save
+// paths mapped to it keyed by config key such as save_path.memcard
+type Machine struct {
+	Name      string
+	Current   bool
+	SavePaths map[string]string
+}
+
+// ListMachines returns every machine which maps save paths of the
+// current game either in its config or in the catalog, this machine
+// is listed even if it maps nothing. Machines are sorted by name
+func (s *Service) ListMachines() ([]Machine, error) {
+	gameName, err := s.gameName()
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.OSRepository.MachineID()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := s.readCatalog()
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.OSRepository.ListScopeConfig(repository.ScopeGame)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]map[string]string{current: {}}
+	for _, values := range []map[string]string{catalog.Games[gameName].Values(), config} {
+		mapped := machineSavePaths(values)
+		for machine, savePaths := range mapped {
+			paths[machine] = savePaths
+		}
+	}
+	machines := make([]Machine, 0, len(paths))
+	for name, savePaths := range paths {
+		machines = append(machines, Machine{name, name == current, savePaths})
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+	return machines, nil
+}
+
+// machineSavePaths groups save path keys mapped to a machine in
+// values by machine, keys are left without their machine
+func machineSavePaths(values map[string]string) map[string]map[string]string {
+	machines := map[string]map[string]string{}
+	for key, value := range values {
+		key, machine := repository.SplitMachineKey(key)
+		if machine == "" {
+			continue
+		}
+		if machines[machine] == nil {
+			machines[machine] = map[string]string{}
+		}
+		machines[machine][key] = value
+	}
+	return machines
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestMachineSavePath(t *testing.T) {
+	t.Run("save and load path mapped to this machine", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		setSavePath(service, "", "./game.save")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.MakeDir("/home/mock/prefix/SaveData")
+		err := service.SetConfig(repository.ScopeGame, "save_path@desktop", "<home>/prefix/SaveData")
+		assertNotError(t, err)
+		osRepo.writeFile("/home/mock/prefix/SaveData/slot1", "data")
+		err = service.SaveGame()
+		assertNotError(t, err)
+		if !osRepo.Exists(repository.GameSaveRoot + "/game.save/slot1") {
+			t.Error("Should save mapped path into the same repository directory")
+		}
+		osRepo.writeFile("/home/mock/prefix/SaveData/slot1", "newer")
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["/home/mock/prefix/SaveData/slot1"], "data")
+	})
+
+	t.Run("check path of another machine only there", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		err := service.SetConfig(repository.ScopeGame, "save_path@deck", "<home>/missing")
+		assertNotError(t, err)
+		err = service.SetConfig(repository.ScopeGame, "save_path@deck", "./missing")
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+		err = service.SetConfig(repository.ScopeGame, "save_path@desktop", "<home>/missing")
+		if _, ok := err.(*SavePathError); !ok {
+			t.Errorf("Got %v expect SavePathError", err)
+		}
+		err = service.SetConfig(repository.ScopeGame, "save_path.mem/card@deck", "<home>/missing")
+		if err != ErrLocationNameInvalid {
+			t.Errorf("Got %v expect %v", err, ErrLocationNameInvalid)
+		}
+	})
+}
+
+func TestListMachines(t *testing.T) {
+	t.Run("list machines of config and catalog", func(t *testing.T) {
+		service := initGameService(t, 0)
+		service.OSRepository.SetConfig("save_path.memcard@deck", "<home>/memcard")
+		catalog := repository.NewCatalog()
+		catalog.Games["game"] = repository.CatalogGame{Machines: map[string]map[string]string{
+			"vm": {"default": "/srv/game.save"},
+		}}
+		service.GitRepository.(*GitRepositoryMock).catalog, _ = catalog.Encode()
+		machines, err := service.ListMachines()
+		assertNotError(t, err)
+		if len(machines) != 3 {
+			t.Fatalf("Got %+v expect 3 machines", machines)
+		}
+		assertEqual(t, machines[0].Name, "deck")
+		assertEqual(t, machines[0].SavePaths["save_path.memcard"], "<home>/memcard")
+		if !machines[1].Current || len(machines[1].SavePaths) != 0 {
+			t.Errorf("Got %+v expect this machine without mapping", machines[1])
+		}
+		assertEqual(t, machines[2].SavePaths["save_path"], "/srv/game.save")
+	})
+
+	t.Run("list machines without game", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		_, err := service.ListMachines()
+		if err != ErrGameNameEmpty {
+			t.Errorf("Got %v expect %v", err, ErrGameNameEmpty)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+// Plan lists files SaveGame or LoadGame would change. Copied and Deleted
+// are paths inside GameSaveRoot on save and paths in save folders on
+// load, Committed are paths inside GameSaveRoot committed on save.
+// Remote is one of Remote constants
+type Plan struct {
+	Game        string
+	Copied      []string
+	Deleted     []string
+	Committed   []string
+	Remote      string
+	Ahead       int
+	Behind      int
+	RemoteError string
+}
+
+// Empty returns true if no file would be changed
+func (p Plan) Empty() bool {
+	return len(p.Copied) == 0 && len(p.Deleted) == 0 && len(p.Committed) == 0
+}
+
+// PlanSave runs the checks of SaveGame and lists files it would copy
+// into the repository, delete from it and commit compared to the latest
+// snapshot. Nothing is changed, remote branch is compared without fetching
+func (s *Service) PlanSave() (Plan, error) {
+	gameName, err := s.gameName()
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{Game: gameName}
+	locations, err := s.saveLocations()
+	if err != nil {
+		return plan, err
+	}
+	for _, location := range locations {
+		if !s.OSRepository.Exists(location.Path) {
+			return plan, ErrSaveFolderNotExist
+		}
+		if err = s.checkSavePath(location.Path); err != nil {
+			return plan, err
+		}
+	}
+	limits, err := s.saveLimits()
+	if err != nil {
+		return plan, err
+	}
+	err = s.checkLimits(locations, limits)
+	if err != nil {
+		return plan, err
+	}
+	manifest, _, err := s.committedManifest(gameName)
+	if err == ErrManifestNotExist {
+		manifest = repository.NewManifest()
+	} else if err != nil {
+		return plan, err
+	}
+	diffs, err := s.compareSave(manifest, locations)
+	if err != nil {
+		return plan, err
+	}
+	listed := map[string]bool{}
+	for _, diff := range diffs {
+		if diff.Change == DiffRemoved {
+			plan.Deleted = append(plan.Deleted, diff.Path)
+		} else {
+			plan.Copied = append(plan.Copied, diff.Path)
+		}
+		committed := diff.Path
+		if locations[0].Storage == repository.StorageArchive {
+			committed = strings.SplitN(diff.Path, "/", 2)[0] + repository.ArchiveExt
+		}
+		if !listed[committed] {
+			listed[committed] = true
+			plan.Committed = append(plan.Committed, committed)
+		}
+	}
+	if len(plan.Committed) > 0 {
+		plan.Committed = append(plan.Committed, repository.ManifestFile)
+	}
+	_, ahead, behind, err := s.GitRepository.PeekRemote(gameName)
+	plan.Ahead, plan.Behind = ahead, behind
+	plan.Remote, plan.RemoteError = remoteState(ahead, behind, err)
+	return plan, nil
+}
+
+// PlanLoad runs the checks of LoadGame and lists files it would copy
+// into save folders and delete from them. Snapshot of remote branch is
+// planned if the local branch is behind it, as load pulls it first.
+// Nothing is changed, remote branch is compared without fetching, so
+// remote commits not fetched yet are reported as remote error
+func (s *Service) PlanLoad() (Plan, error) {
+	gameName, err := s.gameName()
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{Game: gameName}
+	locations, err := s.saveLocations()
+	if err != nil {
+		return plan, err
+	}
+	for _, location := range locations {
+		if err = s.checkSavePath(location.Path); err != nil {
+			return plan, err
+		}
+	}
+	remoteRev, ahead, behind, err := s.GitRepository.PeekRemote(gameName)
+	plan.Ahead, plan.Behind = ahead, behind
+	plan.Remote, plan.RemoteError = remoteState(ahead, behind, err)
+	rev := gameName
+	if err == nil && ahead == 0 && behind > 0 {
+		rev = remoteRev
+	}
+	tree, err := s.GitRepository.ListTree(rev)
+	if err != nil {
+		return plan, ErrSnapshotNotExist
+	}
+	manifest, _, err := s.snapshotManifest(rev, tree)
+	if err != nil {
+		return plan, err
+	}
+	diffs, err := s.compareSave(manifest, locations)
+	if err != nil {
+		return plan, err
+	}
+	for _, diff := range diffs {
+		if diff.Change == DiffAdded {
+			plan.Deleted = append(plan.Deleted, diff.savePath)
+		} else {
+			plan.Copied = append(plan.Copied, diff.savePath)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestPlanSave(t *testing.T) {
+	t.Run("list files copied and committed without changing them", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		osRepo.writeFile(path.Join("game.save", "slot3"), "new")
+		gitRepo.ahead = 1
+		plan, err := service.PlanSave()
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(plan.Copied, ","), "game.save/slot2,game.save/slot3")
+		assertEqual(t, strings.Join(plan.Committed, ","), "game.save/slot2,game.save/slot3,"+repository.ManifestFile)
+		assertEqual(t, plan.Remote, RemoteAhead)
+		if gitRepo.commits != 0 || len(gitRepo.files) != 3 {
+			t.Errorf("Should not commit anything, got %d commits and %d files", gitRepo.commits, len(gitRepo.files))
+		}
+	})
+
+	t.Run("commit archive of changed location", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.AddConfig("storage", repository.StorageArchive)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		delete(osRepo.files, path.Join("game.save", "slot1"))
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		plan, err := service.PlanSave()
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(plan.Deleted, ","), "game.save/slot1")
+		assertEqual(t, strings.Join(plan.Committed, ","), "game.save"+repository.ArchiveExt+","+repository.ManifestFile)
+	})
+
+	t.Run("copy every file of game never saved", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		delete(service.GitRepository.(*GitRepositoryMock).files, repository.ManifestFile)
+		plan, err := service.PlanSave()
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(plan.Copied, ","), "game.save/slot1,game.save/slot2")
+	})
+
+	t.Run("show error if save folder is not exist", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.AddConfig("save_path", "./missing")
+		if _, err := service.PlanSave(); err != ErrSaveFolderNotExist {
+			t.Errorf("Got %v expect %v", err, ErrSaveFolderNotExist)
+		}
+	})
+}
+
+func TestPlanLoad(t *testing.T) {
+	t.Run("list files copied and deleted without changing them", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		delete(osRepo.files, path.Join("game.save", "slot1"))
+		osRepo.writeFile(path.Join("game.save", "slot3"), "new")
+		service.GitRepository.(*GitRepositoryMock).behind = 2
+		plan, err := service.PlanLoad()
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(plan.Copied, ","), "game.save/slot1")
+		assertEqual(t, strings.Join(plan.Deleted, ","), "game.save/slot3")
+		assertEqual(t, plan.Remote, RemoteBehind)
+		if osRepo.files[path.Join("game.save", "slot3")] != "new" {
+			t.Error("Should not change save folder")
+		}
+	})
+
+	t.Run("plan local snapshot if remote is not fetched", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.GitRepository.(*GitRepositoryMock).remoteErr = repository.ErrRemoteNotFetched
+		plan, err := service.PlanLoad()
+		assertNotError(t, err)
+		assertEqual(t, plan.Remote, RemoteUnknown)
+		assertEqual(t, plan.RemoteError, repository.ErrRemoteNotFetched.Error())
+	})
+
+	t.Run("plan snapshot without manifest", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		delete(service.GitRepository.(*GitRepositoryMock).files, repository.ManifestFile)
+		service.OSRepository.(*OsRepositoryMock).writeFile(path.Join("game.save", "slot2"), "changed")
+		plan, err := service.PlanLoad()
+		assertNotError(t, err)
+		assertEqual(t, strings.Join(plan.Copied, ","), "game.save/slot2")
+		if len(plan.Deleted) != 0 {
+			t.Errorf("Got %v expect nothing deleted", plan.Deleted)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"path"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	previousSuffix = ".gamesave-previous"
+	stagingSuffix  = ".gamesave-staging"
+)
+
+var (
+	// ErrStagingMismatch represents error if staged save data differs from the snapshot
+	ErrStagingMismatch = errors.New("Staged save data does not match the snapshot")
+)
+
+// stagedSave tracks a save location while it is being restored
+type stagedSave struct {
+	location    SaveLocation
+	staging     string
+	previous    string
+	hasPrevious bool
+	// empty marks location which has nothing to restore, so swap
+	// only moves its current save data away
+	empty bool
+}
+
+// restoreSave copies snapshot of every location into a staging
+// directory next to it and verifies them, then swaps all of them
+// into place. Every location keeps its previous contents if any
+// step fails
+func (s *Service) restoreSave(locations []SaveLocation, manifest *repository.Manifest, cipher *repository.Cipher) error {
+	staged := make([]*stagedSave, 0, len(locations))
+	for _, location := range locations {
+		stage := &stagedSave{
+			location: location,
+			staging:  siblingPath(location.Path, stagingSuffix),
+			previous: siblingPath(location.Path, previousSuffix),
+		}
+		staged = append(staged, stage)
+		err := s.stageSave(stage, manifest, cipher)
+		if err != nil {
+			s.discardStaging(staged)
+			return err
+		}
+	}
+	return s.swapStaged(staged)
+}
+
+// swapStaged swaps every staged location into place, already swapped
+// locations are rolled back if any of them fails
+func (s *Service) swapStaged(staged []*stagedSave) error {
+	for i, stage := range staged {
+		err := s.swapSave(stage)
+		if err != nil {
+			s.rollbackSwap(staged[:i])
+			s.discardStaging(staged)
+			return err
+		}
+	}
+	for _, stage := range staged {
+		s.OSRepository.Remove(stage.previous)
+	}
+	return nil
+}
+
+// stageSave extracts snapshot of the location into its staging
+// directory and ensures the copy matches the snapshot
+func (s *Service) stageSave(stage *stagedSave, manifest *repository.Manifest, cipher *repository.Cipher) error {
+	err := s.OSRepository.Remove(stage.staging)
+	if err != nil {
+		return err
+	}
+	err = s.keepUnsynced(stage)
+	if err != nil {
+		return err
+	}
+	err = s.extractSnapshot(stage.location, stage.staging, cipher)
+	if err != nil {
+		return err
+	}
+	if manifest == nil && (cipher != nil || s.OSRepository.Exists(stage.location.snapshotArchive())) {
+		return nil
+	}
+	return s.verifyStaging(stage.location.snapshotDir(), stage, manifest)
+}
+
+// keepUnsynced copies files of the save folder which are not selected
+// by its filter into staging, so load leaves them untouched
+func (s *Service) keepUnsynced(stage *stagedSave) error {
+	filter := stage.location.Filter
+	if len(filter.Include) == 0 && len(filter.Exclude) == 0 {
+		return nil
+	}
+	if !s.OSRepository.Exists(stage.location.Path) {
+		return nil
+	}
+	err := s.OSRepository.CopyTree(
+		stage.location.Path,
+		stage.staging,
+		repository.TreeFilter{Links: filter.Links},
+	)
+	if err != nil {
+		return err
+	}
+	synced, err := s.OSRepository.ListFiles(stage.location.Path, filter)
+	if err != nil {
+		return err
+	}
+	for _, entry := range synced {
+		err = s.OSRepository.Remove(path.Join(stage.staging, entry.Path))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractSnapshot copies, unpacks or decrypts snapshot of the location
+// into dst. Snapshot is read in the form it was committed regardless
+// of configured storage mode
+func (s *Service) extractSnapshot(location SaveLocation, dst string, cipher *repository.Cipher) error {
+	archive := location.snapshotArchive()
+	if s.OSRepository.Exists(archive) {
+		if cipher != nil {
+			plain := dst + repository.ArchiveExt
+			defer s.OSRepository.Remove(plain)
+			err := s.OSRepository.DecryptTree(archive, plain, cipher)
+			if err != nil {
+				return err
+			}
+			archive = plain
+		}
+		return s.OSRepository.UnpackArchive(archive, dst)
+	}
+	if cipher != nil {
+		return s.OSRepository.DecryptTree(location.snapshotDir(), dst, cipher)
+	}
+	return s.OSRepository.CopyTree(location.snapshotDir(), dst, location.Filter)
+}
+
+// swapSave replaces save location with its staging directory, the
+// previous save data is moved back if staging can not be moved into place
+func (s *Service) swapSave(stage *stagedSave) error {
+	savePath := stage.location.Path
+	err := s.OSRepository.Remove(stage.previous)
+	if err != nil {
+		return err
+	}
+	stage.hasPrevious = s.OSRepository.Exists(savePath)
+	if stage.hasPrevious {
+		err = s.OSRepository.Rename(savePath, stage.previous)
+		if err != nil {
+			return err
+		}
+	}
+	if stage.empty {
+		return nil
+	}
+	err = s.OSRepository.Rename(stage.staging, savePath)
+	if err != nil && stage.hasPrevious {
+		s.OSRepository.Rename(stage.previous, savePath)
+	}
+	return err
+}
+
+// rollbackSwap puts previous save data back into already swapped locations
+func (s *Service) rollbackSwap(staged []*stagedSave) {
+	for _, stage := range staged {
+		s.OSRepository.Remove(stage.location.Path)
+		if stage.hasPrevious {
+			s.OSRepository.Rename(stage.previous, stage.location.Path)
+		}
+	}
+}
+
+func (s *Service) discardStaging(staged []*stagedSave) {
+	for _, stage := range staged {
+		s.OSRepository.Remove(stage.staging)
+	}
+}
+
+// verifyStaging ensures staging matches the manifest if there is one,
+// otherwise ensures it has the same files and sizes as snapshot
+func (s *Service) verifyStaging(snapshot string, stage *stagedSave, manifest *repository.Manifest) error {
+	if manifest != nil {
+		problems, err := s.checkManifest(
+			*manifest,
+			stage.location.RepoDir,
+			stage.staging,
+			stage.location.Filter,
+		)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return ErrStagingMismatch
+		}
+		return nil
+	}
+	want, err := s.OSRepository.ListFiles(snapshot, stage.location.Filter)
+	if err != nil {
+		return err
+	}
+	got, err := s.OSRepository.ListFiles(stage.staging, stage.location.Filter)
+	if err != nil {
+		return err
+	}
+	if len(got) != len(want) {
+		return ErrStagingMismatch
+	}
+	for i := range want {
+		if got[i].Path != want[i].Path || got[i].Size != want[i].Size {
+			return ErrStagingMismatch
+		}
+	}
+	return nil
+}
+
+// siblingPath returns hidden path next to p, on the same filesystem
+func siblingPath(p, suffix string) string {
+	return path.Join(path.Dir(p), "."+path.Base(p)+suffix)
+}
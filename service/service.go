@@ -3,24 +3,59 @@ package service
 import (
 	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"time"
 
 	"github.com/yusufRahmatullah/game_save/repository"
 )
 
+const (
+	backupTimeFormat = "20060102-150405.000000"
+)
+
 var (
+	// ErrBackupNotExist represents error if there is no backup to be restored
+	ErrBackupNotExist = errors.New("Backup of game save has not been created")
+	// ErrSaveFolderNotExist represents error if Game save path is not exist
+	ErrSaveFolderNotExist = errors.New("Game save folder is not exist")
 	// ErrGameNameEmpty represents error if Game name has not been set
 	ErrGameNameEmpty = errors.New("Game name has not been set")
 	// ErrSavePathEmpty represents error if Game save path has not been set
 	ErrSavePathEmpty = errors.New("Game save path has not been set")
+	// ErrSnapshotNotExist represents error if Game save has never been saved
+	ErrSnapshotNotExist = errors.New("Game save has not been saved")
 )
 
 // IService is interface for interaction with repositories
 type IService interface {
 	AddConfig(key, value string) error
+	DecryptTo(dir string) error
+	Diff(rev string) ([]FileDiff, error)
+	GetConfig(scope repository.ConfigScope, key string) (string, error)
 	InitGitRepo(repoURL string) error
-	LoadGame() error
+	InitRoot(root string) error
+	ListCatalog() (repository.Catalog, error)
+	InitKey(keyFile string, names bool) error
+	ListConfig(scope repository.ConfigScope) (map[string]string, error)
+	ListConfigOrigins() (map[string]repository.ConfigValue, error)
+	ListMachines() ([]Machine, error)
+	LoadGame(options LoadOptions) error
+	PlanLoad() (Plan, error)
+	PlanSave() (Plan, error)
 	PrepareGame() error
+	RotateKey(keyFile string) error
 	SaveGame() error
+	SelectGame(name string) error
+	SetConfig(scope repository.ConfigScope, key, value string) error
+	SetDisplayName(displayName string) error
+	SetSavePath(name, savePath string) error
+	SetupCatalog(assumeYes bool) ([]string, error)
+	Status(gameName string) ([]GameStatus, error)
+	Sync() (string, error)
+	UndoLoad() error
+	UseGame(name string) error
+	Verify(gameName string) (VerifyReport, error)
 }
 
 // Service is the implementation of IService
@@ -29,51 +64,145 @@ type Service struct {
 	OSRepository  repository.IOSRepository
 }
 
-// AddConfig add key and value to configuration
+// AddConfig add key and value to configuration, value of known
+// key is validated by OSRepository and ConfigError naming the key is
+// returned. Empty value unsets the key
 func (s *Service) AddConfig(key, value string) error {
 	return s.OSRepository.SetConfig(key, value)
 }
 
-// InitGitRepo initialize Git repository URL
+// InitGitRepo initialize Git repository URL, the catalog
+// is fetched along if the repository has one
 func (s *Service) InitGitRepo(repoURL string) error {
-	return s.GitRepository.Clone(repoURL)
+	err := s.GitRepository.Clone(repoURL)
+	if err != nil {
+		return err
+	}
+	return s.syncCatalog()
 }
 
 // LoadGame load game's save data by copying the save data
-// from git repository to save path
-func (s *Service) LoadGame() error {
-	savePath := s.OSRepository.GetConfig("save_path")
-	if savePath == "" {
-		return ErrSavePathEmpty
+// from git repository to every save location. The current save
+// data is backed up first so it can be restored by UndoLoad.
+// Dangerous save path is refused and confirmation is asked before
+// many existing files are overwritten unless options.AssumeYes is set
+func (s *Service) LoadGame(options LoadOptions) error {
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
 	}
-	return s.OSRepository.Copy(repository.GameSaveRoot, savePath)
+	locations, err := s.saveLocations()
+	if err != nil {
+		return err
+	}
+	for _, location := range locations {
+		if err = s.checkSavePath(location.Path); err != nil {
+			return err
+		}
+		if !s.OSRepository.Exists(location.snapshotDir()) &&
+			!s.OSRepository.Exists(location.snapshotArchive()) {
+			return ErrSnapshotNotExist
+		}
+	}
+	if err = s.runHook(HookPreLoad, gameName, locations); err != nil {
+		return err
+	}
+	cipher, err := s.snapshotCipher()
+	if err != nil {
+		return err
+	}
+	manifest, err := s.readManifest(cipher)
+	if err != nil {
+		return err
+	}
+	if !options.AssumeYes {
+		if err = s.confirmLoad(locations, manifest); err != nil {
+			return err
+		}
+	}
+	err = s.backupSave(gameName, locations)
+	if err != nil {
+		return err
+	}
+	err = s.restoreSave(locations, manifest, cipher)
+	if err != nil {
+		return err
+	}
+	return s.runHook(HookPostLoad, gameName, locations)
 }
 
 // PrepareGame prepare Git to change the current branch to game name
+// and pull it, the catalog is synced with remote along
 func (s *Service) PrepareGame() error {
-	gameName := s.OSRepository.GetConfig("game_name")
-	if gameName == "" {
-		return ErrGameNameEmpty
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
 	}
-	err := s.GitRepository.Checkout(gameName)
+	err = s.GitRepository.Checkout(gameName)
 	if err != nil {
 		return err
 	}
-	return s.GitRepository.Pull(gameName)
+	err = s.GitRepository.Pull(gameName)
+	if err != nil {
+		return err
+	}
+	return s.syncCatalog()
 }
 
-// SaveGame persists game's save data by copying save data
-// from save path to git repository
+// SaveGame persists game's save data by copying or archiving every
+// save location to git repository and commit them along with checksum
+// manifest. Save data exceeding the limits is refused and nothing is
+// committed if the save data is unchanged. Save paths and patterns of
+// the game are recorded into the catalog, which is pushed to remote
+// if it can be reached
 func (s *Service) SaveGame() error {
-	gameName := s.OSRepository.GetConfig("game_name")
-	if gameName == "" {
-		return ErrGameNameEmpty
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
+	}
+	locations, err := s.saveLocations()
+	if err != nil {
+		return err
+	}
+	if err = s.runHook(HookPreSave, gameName, locations); err != nil {
+		return err
+	}
+	for _, location := range locations {
+		if !s.OSRepository.Exists(location.Path) {
+			return ErrSaveFolderNotExist
+		}
+		if err = s.checkSavePath(location.Path); err != nil {
+			return err
+		}
+	}
+	limits, err := s.saveLimits()
+	if err != nil {
+		return err
+	}
+	err = s.checkLimits(locations, limits)
+	if err != nil {
+		return err
+	}
+	cipher, err := s.snapshotCipher()
+	if err != nil {
+		return err
+	}
+	previous, err := s.readManifest(cipher)
+	if err != nil {
+		return err
+	}
+	manifest := repository.NewManifest()
+	for _, location := range locations {
+		err = s.storeSave(location, manifest, cipher)
+		if err != nil {
+			return err
+		}
 	}
-	savePath := s.OSRepository.GetConfig("save_path")
-	if savePath == "" {
-		return ErrSavePathEmpty
+	keepModTimes(manifest, previous)
+	if warning := growthWarning(manifest, previous, limits); warning != "" {
+		fmt.Println(warning)
 	}
-	err := s.OSRepository.Copy(savePath, repository.GameSaveRoot)
+	err = s.writeManifest(manifest, cipher)
 	if err != nil {
 		return err
 	}
@@ -81,10 +210,180 @@ func (s *Service) SaveGame() error {
 	if err != nil {
 		return err
 	}
-	return s.GitRepository.Commit(s.generateCommitMessage())
+	changed, err := s.GitRepository.HasChanges()
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Println("Game save is up to date")
+	} else if err = s.GitRepository.Commit(s.generateCommitMessage(gameName)); err != nil {
+		return err
+	}
+	err = s.updateCatalog(gameName, "")
+	if err != nil {
+		return err
+	}
+	if err = s.syncCatalog(); err != nil {
+		// saving works offline, catalog is pushed by the next sync
+		fmt.Printf("Catalog is not synced with remote: %v\n", err)
+	}
+	return s.runHook(HookPostSave, gameName, locations)
+}
+
+// InitRoot sets GameSaveRoot by root, or by GAMESAVE_HOME, root
+// of the global config or ~/.gamesave if root is empty
+func (s *Service) InitRoot(root string) error {
+	return s.OSRepository.InitRoot(root)
 }
 
-func (s *Service) generateCommitMessage() string {
-	gameName := s.OSRepository.GetConfig("game_name")
-	return fmt.Sprintf("Update %s", gameName)
+// SelectGame makes the added game name selected instead
+// of the game of current directory or the active game
+func (s *Service) SelectGame(name string) error {
+	names, err := s.OSRepository.ListGames()
+	if err != nil {
+		return err
+	}
+	for _, added := range names {
+		if added == name {
+			s.OSRepository.SelectGame(name)
+			return nil
+		}
+	}
+	return repository.ErrGameNotExist
+}
+
+// UndoLoad restores the save data backed up by the latest LoadGame
+// and removes that backup. Backup is staged next to every location
+// before it is swapped in, locations which did not exist before the
+// load are removed
+func (s *Service) UndoLoad() error {
+	gameName, err := s.gameName()
+	if err != nil {
+		return err
+	}
+	locations, err := s.saveLocations()
+	if err != nil {
+		return err
+	}
+	for _, location := range locations {
+		if err = s.checkSavePath(location.Path); err != nil {
+			return err
+		}
+	}
+	gameBackup := path.Join(repository.BackupRoot, gameName)
+	if !s.OSRepository.Exists(gameBackup) {
+		return ErrBackupNotExist
+	}
+	backups, err := s.OSRepository.ListDir(gameBackup)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return ErrBackupNotExist
+	}
+	sort.Strings(backups)
+	latest := path.Join(gameBackup, backups[len(backups)-1])
+	staged := make([]*stagedSave, 0, len(locations))
+	for _, location := range locations {
+		stage := &stagedSave{
+			location: location,
+			staging:  siblingPath(location.Path, stagingSuffix),
+			previous: siblingPath(location.Path, previousSuffix),
+		}
+		staged = append(staged, stage)
+		backup := path.Join(latest, location.RepoDir)
+		if !s.OSRepository.Exists(backup) {
+			// location did not exist before load
+			stage.empty = true
+			continue
+		}
+		err = s.OSRepository.Remove(stage.staging)
+		if err == nil {
+			err = s.OSRepository.CopyTree(backup, stage.staging, repository.TreeFilter{Links: location.Filter.Links})
+		}
+		if err != nil {
+			s.discardStaging(staged)
+			return err
+		}
+	}
+	err = s.swapStaged(staged)
+	if err != nil {
+		return err
+	}
+	return s.OSRepository.Remove(latest)
+}
+
+// UseGame makes the added game name the active game
+func (s *Service) UseGame(name string) error {
+	return s.OSRepository.UseGame(name)
+}
+
+// storeSave replaces snapshot of location inside GameSaveRoot with
+// its current save data, encrypted by cipher if it is not nil,
+// and adds the save data into manifest
+func (s *Service) storeSave(location SaveLocation, manifest repository.Manifest, cipher *repository.Cipher) error {
+	err := s.OSRepository.Remove(location.snapshotDir())
+	if err != nil {
+		return err
+	}
+	err = s.OSRepository.Remove(location.snapshotArchive())
+	if err != nil {
+		return err
+	}
+	switch {
+	case location.Storage == repository.StorageArchive && cipher != nil:
+		err = s.packEncrypted(location, cipher)
+	case location.Storage == repository.StorageArchive:
+		err = s.OSRepository.PackArchive(location.Path, location.snapshotArchive(), location.Filter)
+	case cipher != nil:
+		err = s.OSRepository.EncryptTree(location.Path, location.snapshotDir(), location.Filter, cipher)
+	default:
+		err = s.OSRepository.CopyTree(location.Path, location.snapshotDir(), location.Filter)
+		if err != nil {
+			return err
+		}
+		return s.addToManifest(manifest, location.RepoDir, location.snapshotDir(), location.Filter)
+	}
+	if err != nil {
+		return err
+	}
+	return s.addToManifest(manifest, location.RepoDir, location.Path, location.Filter)
+}
+
+// backupSave copies every file of every location into BackupRoot
+// under directory named by game name and current time
+func (s *Service) backupSave(gameName string, locations []SaveLocation) error {
+	backupDir := path.Join(
+		repository.BackupRoot,
+		gameName,
+		time.Now().Format(backupTimeFormat),
+	)
+	for _, location := range locations {
+		if !s.OSRepository.Exists(location.Path) {
+			continue
+		}
+		err := s.OSRepository.MakeDir(backupDir)
+		if err != nil {
+			return err
+		}
+		err = s.OSRepository.CopyTree(
+			location.Path,
+			path.Join(backupDir, location.RepoDir),
+			repository.TreeFilter{Links: location.Filter.Links},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateCommitMessage returns message of snapshot commit of game
+// name, machine saving it is recorded by machineTrailer
+func (s *Service) generateCommitMessage(gameName string) string {
+	message := fmt.Sprintf("Update %s", gameName)
+	if machine, err := s.OSRepository.MachineID(); err == nil && machine != "" {
+		message += "\n\n" + machineTrailer + machine
+	}
+	return message
 }
@@ -1,7 +1,17 @@
 package service
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusufRahmatullah/game_save/repository"
 )
 
 const (
@@ -24,17 +34,43 @@ var (
 )
 
 type GitRepositoryMock struct {
+	ahead         int
+	behind        int
+	catalog       []byte
+	catalogBase   []byte
+	clean         bool
+	commits       int
 	currentBranch string
+	files         map[string][]byte
+	lastCommitErr error
+	message       string
 	options       map[string]bool
+	remoteCatalog []byte
+	remoteErr     error
 }
 type OsRepositoryMock struct {
-	gameName string
-	savePath string
+	archives    map[string]map[string]string
+	commandEnv  []string
+	commands    []string
+	confirm     bool
+	confirmed   int
+	config      map[string]string
+	configErr   error
+	env         map[string]string
+	failRename  string
+	files       map[string]string
+	games       map[string]bool
+	manifests   map[string]repository.Manifest
+	passphrases map[string]string
+	paths       map[string]bool
+	root        string
+	scoped      map[repository.ConfigScope]map[string]string
 }
 
 func NewGitRepositoryMock(options map[string]bool) *GitRepositoryMock {
 	return &GitRepositoryMock{
 		currentBranch: "",
+		files:         map[string][]byte{},
 		options:       options,
 	}
 }
@@ -48,9 +84,27 @@ func (g *GitRepositoryMock) Commit(message string) error {
 	if val, _ := g.options["repo_url"]; !val {
 		return errors.New("")
 	}
+	g.commits++
+	g.message = message
 	return nil
 }
 
+func (g *GitRepositoryMock) CommitFile(branch, file string, data []byte, message string) error {
+	if branch != repository.CatalogBranch || file != repository.CatalogFile {
+		return errors.New("")
+	}
+	g.catalog = data
+	return nil
+}
+
+func (g *GitRepositoryMock) CompareRemote(branch string) (int, int, error) {
+	return g.ahead, g.behind, g.remoteErr
+}
+
+func (g *GitRepositoryMock) PeekRemote(branch string) (string, int, int, error) {
+	return "origin", g.ahead, g.behind, g.remoteErr
+}
+
 func (g *GitRepositoryMock) Clone(repoURL string) error {
 	if val, _ := g.options["repo_url"]; !val {
 		return errors.New("")
@@ -62,6 +116,17 @@ func (g *GitRepositoryMock) FetchBranch(branch string) error {
 	return nil
 }
 
+// FetchRemote returns "remote" as revision of remoteCatalog
+func (g *GitRepositoryMock) FetchRemote(branch string) (string, error) {
+	if g.remoteErr != nil {
+		return "", g.remoteErr
+	}
+	if branch != repository.CatalogBranch || g.remoteCatalog == nil {
+		return "", repository.ErrRemoteBranchNotExist
+	}
+	return "remote", nil
+}
+
 func (g *GitRepositoryMock) GetCurrentBranch() (string, error) {
 	return g.currentBranch, nil
 }
@@ -70,6 +135,55 @@ func (g *GitRepositoryMock) GetRepoURL() (string, error) {
 	return gitRepoMock, nil
 }
 
+func (g *GitRepositoryMock) HasChanges() (bool, error) {
+	return !g.clean, nil
+}
+
+func (g *GitRepositoryMock) LastCommit(branch string) (repository.CommitInfo, error) {
+	if branch == repository.CatalogBranch {
+		return repository.CommitInfo{Hash: g.catalogRev(g.catalog)}, nil
+	}
+	if g.lastCommitErr != nil {
+		return repository.CommitInfo{}, g.lastCommitErr
+	}
+	if g.commits == 0 {
+		return repository.CommitInfo{}, repository.ErrBranchNotExist
+	}
+	return repository.CommitInfo{
+		Hash:    strconv.Itoa(g.commits),
+		Time:    time.Unix(1700000000, 0),
+		Message: g.message,
+	}, nil
+}
+
+func (g *GitRepositoryMock) ListTree(branch string) ([]string, error) {
+	files := []string{}
+	for file := range g.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// MergeBase returns revision of catalogBase, catalogs which are the
+// same as remoteCatalog or catalog share their revision
+func (g *GitRepositoryMock) MergeBase(rev, other string) (string, error) {
+	if g.catalogBase == nil {
+		return "", nil
+	}
+	return g.catalogRev(g.catalogBase), nil
+}
+
+func (g *GitRepositoryMock) catalogRev(data []byte) string {
+	switch {
+	case bytes.Equal(data, g.remoteCatalog):
+		return "remote"
+	case bytes.Equal(data, g.catalog):
+		return "local"
+	}
+	return "base"
+}
+
 func (g *GitRepositoryMock) Pull(gameName string) error {
 	if val, _ := g.options["repo_url"]; !val {
 		if val2, _ := g.options["branch_exist"]; !val2 {
@@ -88,35 +202,456 @@ func (g *GitRepositoryMock) Push(gameName string) error {
 	return nil
 }
 
+func (g *GitRepositoryMock) PushBranch(branch string) error {
+	if g.remoteErr != nil {
+		return g.remoteErr
+	}
+	g.remoteCatalog = g.catalog
+	g.catalogBase = g.catalog
+	return nil
+}
+
+func (g *GitRepositoryMock) SetBranch(branch, rev string) error {
+	if rev != "remote" {
+		return errors.New("")
+	}
+	g.catalog = g.remoteCatalog
+	g.catalogBase = g.remoteCatalog
+	return nil
+}
+
 func (g *GitRepositoryMock) SetRepoURL(repoURL string) error {
 	return nil
 }
 
+func (g *GitRepositoryMock) ShowFile(branch, file string) ([]byte, error) {
+	catalogs := map[string][]byte{
+		repository.CatalogBranch: g.catalog,
+		"remote":                 g.remoteCatalog,
+		"base":                   g.catalogBase,
+	}
+	if catalog, ok := catalogs[branch]; ok {
+		if catalog == nil || file != repository.CatalogFile {
+			return nil, repository.ErrFileNotExist
+		}
+		return catalog, nil
+	}
+	content, ok := g.files[file]
+	if !ok {
+		return nil, repository.ErrFileNotExist
+	}
+	return content, nil
+}
+
 func NewOsRepositoryMock() *OsRepositoryMock {
-	return &OsRepositoryMock{}
+	return &OsRepositoryMock{
+		archives:    map[string]map[string]string{},
+		config:      map[string]string{},
+		env:         map[string]string{},
+		files:       map[string]string{},
+		games:       map[string]bool{},
+		manifests:   map[string]repository.Manifest{},
+		passphrases: map[string]string{},
+		paths:       map[string]bool{},
+		scoped:      map[repository.ConfigScope]map[string]string{},
+	}
+}
+
+func (o *OsRepositoryMock) Confirm(prompt string) (bool, error) {
+	o.confirmed++
+	return o.confirm, nil
 }
 
 func (o *OsRepositoryMock) Copy(src, dst string) error {
+	if !o.paths[src] {
+		return errors.New("")
+	}
+	if dst == "." || o.paths[dst] {
+		dst = path.Join(dst, path.Base(src))
+	}
+	o.transfer(src, dst, false)
+	return nil
+}
+
+func (o *OsRepositoryMock) CopyTree(src, dst string, filter repository.TreeFilter) error {
+	if !o.paths[src] {
+		return errors.New("")
+	}
+	files := o.selectFiles(src, filter)
+	for p := range o.paths {
+		if _, ok := o.files[p]; !ok && (p == src || strings.HasPrefix(p, src+"/")) {
+			o.MakeDir(dst + strings.TrimPrefix(p, src))
+		}
+	}
+	for rel, content := range files {
+		o.writeFile(path.Join(dst, rel), content)
+	}
+	return nil
+}
+
+func (o *OsRepositoryMock) CreateKeyFile(p string) error {
+	if o.paths[p] {
+		return errors.New("")
+	}
+	o.writeFile(p, "0123456789abcdef0123456789abcdef")
+	return nil
+}
+
+func (o *OsRepositoryMock) DecryptTree(src, dst string, cipher *repository.Cipher) error {
+	return o.convertTree(src, dst, func(rel, content string) (string, string, error) {
+		rel, err := cipher.OpenPath(rel)
+		if err != nil {
+			return "", "", err
+		}
+		data, err := cipher.Open([]byte(content))
+		return rel, string(data), err
+	})
+}
+
+func (o *OsRepositoryMock) EncryptTree(src, dst string, filter repository.TreeFilter, cipher *repository.Cipher) error {
+	return o.convertTree(src, dst, func(rel, content string) (string, string, error) {
+		rel, err := cipher.SealPath(rel)
+		return rel, string(cipher.Seal([]byte(content))), err
+	})
+}
+
+func (o *OsRepositoryMock) Exists(p string) bool {
+	return o.paths[p]
+}
+
+func (o *OsRepositoryMock) ExpandPath(template string) (string, error) {
+	expanded := strings.Replace(template, "<home>", "/home/mock", -1)
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") {
+		expanded = "/home/mock" + expanded[1:]
+	}
+	if strings.Contains(expanded, "<") {
+		return "", errors.New("")
+	}
+	return expanded, nil
+}
+
+func (o *OsRepositoryMock) GetConfig(key string) (string, bool, error) {
+	if o.configErr != nil {
+		return "", false, o.configErr
+	}
+	value, found := o.config[key]
+	if !found {
+		// environment variables override global config of every game
+		value, found = o.env["GAMESAVE_"+strings.ToUpper(key)]
+	}
+	return value, found, nil
+}
+
+func (o *OsRepositoryMock) GetEnv(key string) string {
+	return o.env[key]
+}
+
+func (o *OsRepositoryMock) HashFile(p string) (string, error) {
+	content, ok := o.files[p]
+	if !ok {
+		return "", errors.New("")
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (o *OsRepositoryMock) InitRoot(root string) error {
+	o.root = root
+	return nil
+}
+
+func (o *OsRepositoryMock) ListDir(p string) ([]string, error) {
+	if !o.paths[p] {
+		return nil, errors.New("")
+	}
+	names := []string{}
+	for child := range o.paths {
+		if path.Dir(child) == p {
+			names = append(names, path.Base(child))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (o *OsRepositoryMock) ListConfig() (map[string]string, error) {
+	return o.ListScopeConfig(repository.ScopeEffective)
+}
+
+func (o *OsRepositoryMock) ListConfigOrigins() (map[string]repository.ConfigValue, error) {
+	config, _ := o.ListScopeConfig(repository.ScopeEffective)
+	configs := map[string]repository.ConfigValue{}
+	for key, value := range config {
+		configs[key] = repository.ConfigValue{Value: value, Origin: "game"}
+	}
+	return configs, nil
+}
+
+func (o *OsRepositoryMock) ListFiles(root string, filter repository.TreeFilter) ([]repository.FileEntry, error) {
+	if !o.paths[root] {
+		return nil, errors.New("")
+	}
+	entries := []repository.FileEntry{}
+	for rel, content := range o.selectFiles(root, filter) {
+		entries = append(entries, repository.FileEntry{
+			Path: rel,
+			Size: int64(len(content)),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+func (o *OsRepositoryMock) ListScopeConfig(scope repository.ConfigScope) (map[string]string, error) {
+	if o.configErr != nil {
+		return nil, o.configErr
+	}
+	config := map[string]string{}
+	values := o.config
+	if scope == repository.ScopeGlobal || scope == repository.ScopeLocal {
+		values = o.scoped[scope]
+	}
+	mapped := map[string]string{}
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		if base, machine := repository.SplitMachineKey(key); scope == repository.ScopeEffective && machine != "" {
+			if machine == "desktop" {
+				mapped[base] = value
+			}
+			continue
+		}
+		config[key] = value
+	}
+	for key, value := range mapped {
+		config[key] = value
+	}
+	return config, nil
+}
+
+func (o *OsRepositoryMock) ListGames() ([]string, error) {
+	names := []string{}
+	for name := range o.games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (o *OsRepositoryMock) MachineID() (string, error) {
+	return "desktop", nil
+}
+
+func (o *OsRepositoryMock) MakeDir(p string) error {
+	for ; p != "/" && p != "."; p = path.Dir(p) {
+		o.paths[p] = true
+	}
+	return nil
+}
+
+func (o *OsRepositoryMock) PackArchive(src, dst string, filter repository.TreeFilter) error {
+	if !o.paths[src] {
+		return errors.New("")
+	}
+	o.archives[dst] = o.selectFiles(src, filter)
+	o.writeFile(dst, "archive")
 	return nil
 }
 
-func (o *OsRepositoryMock) GetConfig(key string) string {
-	value := ""
-	switch key {
-	case "game_name":
-		value = o.gameName
-	case "save_path":
-		value = o.savePath
+func (o *OsRepositoryMock) ReadFile(p string) ([]byte, error) {
+	content, ok := o.files[p]
+	if !ok {
+		return nil, errors.New("")
+	}
+	return []byte(content), nil
+}
+
+func (o *OsRepositoryMock) ReadManifest(p string) (repository.Manifest, error) {
+	manifest, ok := o.manifests[p]
+	if !ok {
+		return repository.NewManifest(), errors.New("")
+	}
+	return manifest, nil
+}
+
+func (o *OsRepositoryMock) ReadPassphrase(prompt, env string) (string, error) {
+	passphrase, ok := o.passphrases[env]
+	if !ok {
+		return "", errors.New("")
+	}
+	return passphrase, nil
+}
+
+func (o *OsRepositoryMock) Remove(p string) error {
+	for child := range o.paths {
+		if child == p || strings.HasPrefix(child, p+"/") {
+			delete(o.paths, child)
+			delete(o.files, child)
+		}
+	}
+	return nil
+}
+
+func (o *OsRepositoryMock) Rename(src, dst string) error {
+	if src == o.failRename || !o.paths[src] {
+		return errors.New("")
+	}
+	o.transfer(src, dst, true)
+	return nil
+}
+
+func (o *OsRepositoryMock) AbsPath(p string) (string, error) {
+	if !path.IsAbs(p) {
+		p = path.Join("/work", p)
+	}
+	return p, nil
+}
+
+func (o *OsRepositoryMock) ResolvePath(p string) (string, error) {
+	if !path.IsAbs(p) {
+		p = path.Join("/work", p)
+	}
+	return path.Clean(p), nil
+}
+
+func (o *OsRepositoryMock) RunCommand(command string, env []string) error {
+	o.commands = append(o.commands, command)
+	o.commandEnv = env
+	if command == "false" {
+		return errors.New("exit status 1")
 	}
-	return value
+	return nil
+}
+
+func (o *OsRepositoryMock) SelectGame(name string) string {
+	previous := o.config["game_name"]
+	o.config["game_name"] = name
+	return previous
 }
 
 func (o *OsRepositoryMock) SetConfig(key, value string) error {
-	switch key {
-	case "game_name":
-		o.gameName = value
-	case "save_path":
-		o.savePath = value
+	if repository.IsConfigKey(key) {
+		if err := (&repository.GameConfig{}).Set(key, value); err != nil {
+			return err
+		}
+	}
+	if key == "game_name" {
+		o.games[value] = true
+	}
+	if value == "" {
+		delete(o.config, key)
+	} else {
+		o.config[key] = value
+	}
+	return nil
+}
+
+func (o *OsRepositoryMock) SetScopeConfig(scope repository.ConfigScope, key, value string) error {
+	if scope != repository.ScopeGlobal && scope != repository.ScopeLocal {
+		o.games[o.config["game_name"]] = true
+		return o.SetConfig(key, value)
+	}
+	if err := (&repository.GameConfig{}).Set(key, value); err != nil {
+		return err
+	}
+	if o.scoped[scope] == nil {
+		o.scoped[scope] = map[string]string{}
 	}
+	o.scoped[scope][key] = value
 	return nil
 }
+
+func (o *OsRepositoryMock) UnpackArchive(src, dst string) error {
+	archive, ok := o.archives[src]
+	if !ok {
+		return errors.New("")
+	}
+	o.MakeDir(dst)
+	for name, content := range archive {
+		o.writeFile(path.Join(dst, name), content)
+	}
+	return nil
+}
+
+func (o *OsRepositoryMock) UseGame(name string) error {
+	if !o.games[name] {
+		return repository.ErrGameNotExist
+	}
+	o.config["game_name"] = name
+	return nil
+}
+
+func (o *OsRepositoryMock) WriteFile(p string, data []byte) error {
+	o.writeFile(p, string(data))
+	return nil
+}
+
+func (o *OsRepositoryMock) WriteManifest(p string, manifest repository.Manifest) error {
+	o.manifests[p] = manifest
+	o.writeFile(p, "manifest")
+	return nil
+}
+
+// convertTree writes every file under src, or src itself if it is a file,
+// into dst with relative path and content converted by fn
+func (o *OsRepositoryMock) convertTree(src, dst string, fn func(rel, content string) (string, string, error)) error {
+	if !o.paths[src] {
+		return errors.New("")
+	}
+	if archive, ok := o.archives[src]; ok {
+		o.archives[dst] = archive
+	}
+	o.MakeDir(dst)
+	files := map[string]string{}
+	for p, content := range o.files {
+		if p == src || strings.HasPrefix(p, src+"/") {
+			files[p] = content
+		}
+	}
+	for p, content := range files {
+		rel, converted, err := fn(strings.TrimPrefix(p, src), content)
+		if err != nil {
+			return err
+		}
+		o.writeFile(dst+rel, converted)
+	}
+	return nil
+}
+
+// selectFiles returns content of every file under root selected
+// by filter keyed by path relative to root
+func (o *OsRepositoryMock) selectFiles(root string, filter repository.TreeFilter) map[string]string {
+	files := map[string]string{}
+	for p, content := range o.files {
+		rel := strings.TrimPrefix(p, root+"/")
+		if strings.HasPrefix(p, root+"/") && filter.Selects(rel) {
+			files[rel] = content
+		}
+	}
+	return files
+}
+
+func (o *OsRepositoryMock) transfer(src, dst string, move bool) {
+	for p := range o.paths {
+		if p == src || strings.HasPrefix(p, src+"/") {
+			target := dst + strings.TrimPrefix(p, src)
+			o.paths[target] = true
+			if content, ok := o.files[p]; ok {
+				o.files[target] = content
+			}
+			if move {
+				delete(o.paths, p)
+				delete(o.files, p)
+			}
+		}
+	}
+}
+
+func (o *OsRepositoryMock) writeFile(p, content string) {
+	o.MakeDir(path.Dir(p))
+	o.paths[p] = true
+	o.files[p] = content
+}
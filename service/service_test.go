@@ -1,15 +1,53 @@
 package service
 
-import "testing"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
 
 func TestAddConfig(t *testing.T) {
 	t.Run("set game_name configuration", func(t *testing.T) {
 		service := initService(t, gitOptionNormal)
 		err := service.AddConfig("game_name", "game")
 		assertNotError(t, err)
-		gameName := service.OSRepository.GetConfig("game_name")
+		gameName := getConfig(t, service.OSRepository, "game_name")
 		assertEqual(t, gameName, "game")
 	})
+
+	t.Run("set valid symlinks configuration", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.AddConfig("symlinks", "skip")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, service.OSRepository, "symlinks"), "skip")
+	})
+
+	t.Run("set invalid storage configuration", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.AddConfig("storage", "zip")
+		assertError(t, err)
+	})
+
+	t.Run("set invalid symlinks configuration", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.AddConfig("symlinks", "copy")
+		assertError(t, err)
+	})
+
+	t.Run("name invalid configuration", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		err := service.AddConfig("max_files", "many")
+		configErr, ok := err.(*repository.ConfigError)
+		if !ok || configErr.Field != "max_files" {
+			t.Errorf("Got %v expect ConfigError of max_files", err)
+		}
+	})
 }
 
 func TestInitGitRepo(t *testing.T) {
@@ -56,13 +94,82 @@ func TestLoadGameSave(t *testing.T) {
 	t.Run("load game save in normal condition", func(t *testing.T) {
 		service := initService(t, gitOptionNormal)
 		service.AddConfig("save_path", "./game.save")
-		err := service.LoadGame()
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "game.save/slot1")
+		err := service.LoadGame(LoadOptions{})
 		assertNotError(t, err)
+		if !service.OSRepository.Exists("game.save/slot1") {
+			t.Error("Should copy snapshot into save path")
+		}
+		if service.OSRepository.Exists(".game.save.gamesave-staging") {
+			t.Error("Should remove staging directory")
+		}
+	})
+
+	t.Run("backup existing save before load", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "game.save")
+		service.OSRepository.MakeDir("game.save")
+		err := service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		backups, err := service.OSRepository.ListDir(path.Join(repository.BackupRoot, "game"))
+		assertNotError(t, err)
+		if len(backups) != 1 {
+			t.Errorf("Should create one backup, got %d", len(backups))
+		}
+	})
+
+	t.Run("game_name not set", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		err := service.LoadGame(LoadOptions{})
+		assertError(t, err)
+	})
+
+	t.Run("snapshot not exist", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		err := service.LoadGame(LoadOptions{})
+		assertError(t, err)
+	})
+
+	t.Run("reject snapshot not matching manifest", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("game.save/slot1", "data1")
+		service.SaveGame()
+		osRepo.writeFile(path.Join(repository.GameSaveRoot, "game.save/slot1"), "rot!!")
+		osRepo.writeFile("game.save/slot1", "local")
+		err := service.LoadGame(LoadOptions{})
+		assertError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "local")
+	})
+
+	t.Run("keep previous save when swap fails", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "game.save/new")
+		service.OSRepository.MakeDir("game.save/old")
+		service.OSRepository.(*OsRepositoryMock).failRename = ".game.save.gamesave-staging"
+		err := service.LoadGame(LoadOptions{})
+		assertError(t, err)
+		if !service.OSRepository.Exists("game.save/old") || service.OSRepository.Exists("game.save/new") {
+			t.Error("Should roll back to previous save")
+		}
+		if service.OSRepository.Exists(".game.save.gamesave-staging") {
+			t.Error("Should remove staging directory")
+		}
 	})
 
 	t.Run("save_path not set", func(t *testing.T) {
 		service := initService(t, gitOptionNormal)
-		err := service.LoadGame()
+		err := service.LoadGame(LoadOptions{})
 		assertError(t, err)
 	})
 }
@@ -72,8 +179,97 @@ func TestSaveGame(t *testing.T) {
 		service := initService(t, gitOptionNormal)
 		service.AddConfig("save_path", "./game.save")
 		service.AddConfig("game_name", "game")
+		service.OSRepository.MakeDir("game.save")
+		err := service.SaveGame()
+		assertNotError(t, err)
+	})
+
+	t.Run("write checksum manifest", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("game.save/slot1", "data1")
+		err := service.SaveGame()
+		assertNotError(t, err)
+		manifest, err := osRepo.ReadManifest(path.Join(repository.GameSaveRoot, repository.ManifestFile))
+		assertNotError(t, err)
+		sum := sha256.Sum256([]byte("data1"))
+		assertEqual(t, manifest.Files["game.save/slot1"].SHA256, hex.EncodeToString(sum[:]))
+	})
+
+	t.Run("skip commit when save is unchanged", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		service.OSRepository.MakeDir("game.save")
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.clean = true
 		err := service.SaveGame()
 		assertNotError(t, err)
+		if gitRepo.commits != 0 {
+			t.Error("Should not commit unchanged save")
+		}
+	})
+
+	t.Run("keep modification time of unchanged file", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("game.save/slot1", "data1")
+		manifestPath := path.Join(repository.GameSaveRoot, repository.ManifestFile)
+		previous := repository.NewManifest()
+		sum := sha256.Sum256([]byte("data1"))
+		previous.Files["game.save/slot1"] = repository.ManifestEntry{
+			SHA256:  hex.EncodeToString(sum[:]),
+			Size:    5,
+			ModTime: time.Unix(1000, 0),
+		}
+		osRepo.WriteManifest(manifestPath, previous)
+		err := service.SaveGame()
+		assertNotError(t, err)
+		manifest, _ := osRepo.ReadManifest(manifestPath)
+		if !manifest.Files["game.save/slot1"].ModTime.Equal(time.Unix(1000, 0)) {
+			t.Error("Should keep previous modification time")
+		}
+	})
+
+	t.Run("save and load archive storage", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		service.AddConfig("storage", "archive")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.writeFile("game.save/slot1", "data1")
+		err := service.SaveGame()
+		assertNotError(t, err)
+		archive := path.Join(repository.GameSaveRoot, "game.save"+repository.ArchiveExt)
+		if !osRepo.Exists(archive) || osRepo.Exists(path.Join(repository.GameSaveRoot, "game.save")) {
+			t.Error("Should store save as archive only")
+		}
+		osRepo.writeFile("game.save/slot1", "newer")
+		err = service.LoadGame(LoadOptions{})
+		assertNotError(t, err)
+		assertEqual(t, osRepo.files["game.save/slot1"], "data1")
+	})
+
+	t.Run("save invalid storage", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		service.OSRepository.(*OsRepositoryMock).config["storage"] = "zip"
+		service.OSRepository.MakeDir("game.save")
+		err := service.SaveGame()
+		assertError(t, err)
+	})
+
+	t.Run("save path not exist", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		err := service.SaveGame()
+		assertError(t, err)
 	})
 
 	t.Run("game name not set", func(t *testing.T) {
@@ -99,6 +295,151 @@ func TestSaveGame(t *testing.T) {
 	})
 }
 
+func TestSelectGame(t *testing.T) {
+	t.Run("select added game", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game1")
+		service.AddConfig("game_name", "game2")
+		err := service.SelectGame("game1")
+		assertNotError(t, err)
+		assertEqual(t, getConfig(t, service.OSRepository, "game_name"), "game1")
+	})
+
+	t.Run("select game not added", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game1")
+		err := service.SelectGame("game2")
+		if err != repository.ErrGameNotExist {
+			t.Errorf("Got %v expect %v", err, repository.ErrGameNotExist)
+		}
+		assertEqual(t, getConfig(t, service.OSRepository, "game_name"), "game1")
+	})
+}
+
+func TestUndoLoad(t *testing.T) {
+	t.Run("undo load in normal condition", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "game.save/slot1")
+		service.OSRepository.MakeDir("game.save/slot1")
+		service.LoadGame(LoadOptions{})
+		service.OSRepository.Remove("game.save")
+		err := service.UndoLoad()
+		assertNotError(t, err)
+		if !service.OSRepository.Exists("game.save/slot1") {
+			t.Error("Should restore backed up save")
+		}
+		backups, _ := service.OSRepository.ListDir(path.Join(repository.BackupRoot, "game"))
+		if len(backups) != 0 {
+			t.Errorf("Should remove restored backup, got %d", len(backups))
+		}
+	})
+
+	t.Run("remove location not existing before load", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("save_path.memcard", "./memcard")
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "game.save/slot1")
+		addSnapshot(t, service, "memcard/card1")
+		service.OSRepository.MakeDir("game.save/slot1")
+		service.LoadGame(LoadOptions{})
+		err := service.UndoLoad()
+		assertNotError(t, err)
+		if !service.OSRepository.Exists("game.save/slot1") {
+			t.Error("Should restore backed up save")
+		}
+		if service.OSRepository.Exists("memcard") {
+			t.Error("Should remove location without backup")
+		}
+	})
+
+	t.Run("keep save if backup can not be swapped in", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		addSnapshot(t, service, "game.save/slot1")
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		osRepo.MakeDir("game.save/slot2")
+		service.LoadGame(LoadOptions{})
+		osRepo.failRename = siblingPath("game.save", stagingSuffix)
+		err := service.UndoLoad()
+		assertError(t, err)
+		if !osRepo.Exists("game.save/slot1") {
+			t.Error("Should keep loaded save")
+		}
+		backups, _ := osRepo.ListDir(path.Join(repository.BackupRoot, "game"))
+		if len(backups) != 1 {
+			t.Errorf("Should keep backup, got %d", len(backups))
+		}
+	})
+
+	t.Run("undo load without backup", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("save_path", "./game.save")
+		service.AddConfig("game_name", "game")
+		err := service.UndoLoad()
+		assertError(t, err)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("verify matching repo and save folder", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		report, err := service.Verify("")
+		assertNotError(t, err)
+		if !report.OK() || !report.SaveChecked {
+			t.Errorf("Should be OK, got %+v", report)
+		}
+	})
+
+	t.Run("verify modified and missing files", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.files["game.save/slot1"] = []byte("rot")
+		service.OSRepository.Remove("game.save/slot2")
+		report, err := service.Verify("game")
+		assertNotError(t, err)
+		if len(report.Repo) != 1 || report.Repo[0].Problem != ProblemModified {
+			t.Errorf("Should report modified committed file, got %+v", report.Repo)
+		}
+		if len(report.Save) != 1 || report.Save[0].Problem != ProblemMissing {
+			t.Errorf("Should report missing save file, got %+v", report.Save)
+		}
+	})
+
+	t.Run("verify save folder of other game", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		service.OSRepository.SelectGame("other")
+		report, err := service.Verify("game")
+		assertNotError(t, err)
+		if !report.OK() || !report.SaveChecked || report.Game != "game" {
+			t.Errorf("Should check save folder of game, got %+v", report)
+		}
+		assertEqual(t, getConfig(t, service.OSRepository, "game_name"), "other")
+	})
+
+	t.Run("verify without manifest", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		_, err := service.Verify("")
+		assertError(t, err)
+	})
+}
+
+func getConfig(t *testing.T, osRepo repository.IOSRepository, key string) string {
+	t.Helper()
+	value, _, err := osRepo.GetConfig(key)
+	if err != nil {
+		t.Errorf("Shouldn't show error. Error: %v", err)
+	}
+	return value
+}
+
 func assertEqual(t *testing.T, got, want string) {
 	t.Helper()
 	if got != want {
@@ -120,6 +461,55 @@ func assertNotError(t *testing.T, err error) {
 	}
 }
 
+func addSnapshot(t *testing.T, service *Service, p string) {
+	t.Helper()
+	err := service.OSRepository.MakeDir(path.Join(repository.GameSaveRoot, p))
+	if err != nil {
+		t.Errorf("[Helper-addSnapshot] error: %v", err)
+	}
+}
+
+// initGameService returns service of game saved from game.save holding
+// files slot1 to slotN, content of slotN is dataN
+func initGameService(t *testing.T, files int) *Service {
+	t.Helper()
+	service := initService(t, gitOptionNormal)
+	err := service.AddConfig("save_path", "./game.save")
+	if err == nil {
+		err = service.AddConfig("game_name", "game")
+	}
+	if err != nil {
+		t.Fatalf("[Helper-initGameService] Error: %v", err)
+	}
+	osRepo := service.OSRepository.(*OsRepositoryMock)
+	for i := 1; i <= files; i++ {
+		osRepo.writeFile(fmt.Sprintf("game.save/slot%d", i), fmt.Sprintf("data%d", i))
+	}
+	return service
+}
+
+// commitSnapshot commits every file of game.save along with
+// its checksum manifest as if the game was saved
+func commitSnapshot(t *testing.T, service *Service) {
+	t.Helper()
+	osRepo := service.OSRepository.(*OsRepositoryMock)
+	gitRepo := service.GitRepository.(*GitRepositoryMock)
+	manifest := repository.NewManifest()
+	for rel, content := range osRepo.selectFiles("game.save", repository.TreeFilter{}) {
+		sum := sha256.Sum256([]byte(content))
+		gitRepo.files[path.Join("game.save", rel)] = []byte(content)
+		manifest.Files[path.Join("game.save", rel)] = repository.ManifestEntry{
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   int64(len(content)),
+		}
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("[Helper-commitSnapshot] Error: %v", err)
+	}
+	gitRepo.files[repository.ManifestFile] = data
+}
+
 func initService(t *testing.T, gitOptions map[string]bool) *Service {
 	t.Helper()
 	return &Service{
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// SaveUnchanged means save folders match the last snapshot
+	SaveUnchanged = "unchanged"
+	// SaveModified means save folders differ from the last snapshot
+	SaveModified = "modified"
+	// SaveNotSaved means game has no snapshot
+	SaveNotSaved = "never saved"
+	// SavePathNotSet means game has no save path on this machine
+	SavePathNotSet = "no save path"
+
+	// RemoteUpToDate means local branch and remote branch are the same
+	RemoteUpToDate = "up to date"
+	// RemoteAhead means local branch has commits missing on remote
+	RemoteAhead = "ahead"
+	// RemoteBehind means remote branch has commits missing locally
+	RemoteBehind = "behind"
+	// RemoteDiverged means both branches have commits missing on the other
+	RemoteDiverged = "diverged"
+	// RemoteNotPushed means game has not been pushed to remote
+	RemoteNotPushed = "not pushed"
+	// RemoteUnknown means remote can not be reached
+	RemoteUnknown = "unknown"
+
+	machineTrailer = "Machine: "
+)
+
+// GameStatus compares save folders of a game against its last snapshot
+// and its local branch against remote. ChangedFiles counts files
+// differing from the snapshot, Ahead and Behind count commits
+type GameStatus struct {
+	Game         string     `json:"game"`
+	CheckedOut   bool       `json:"checked_out"`
+	Save         string     `json:"save"`
+	ChangedFiles int        `json:"changed_files"`
+	Remote       string     `json:"remote"`
+	Ahead        int        `json:"ahead"`
+	Behind       int        `json:"behind"`
+	RemoteError  string     `json:"remote_error,omitempty"`
+	SavedAt      *time.Time `json:"saved_at,omitempty"`
+	SavedOn      string     `json:"saved_on,omitempty"`
+}
+
+// Status reports status of game name, or of every added game if it is
+// empty, sorted by name. Remote branches are fetched without changing
+// local branches nor save folders
+func (s *Service) Status(gameName string) ([]GameStatus, error) {
+	names := []string{gameName}
+	if gameName == "" {
+		var err error
+		if names, err = s.OSRepository.ListGames(); err != nil {
+			return nil, err
+		}
+	}
+	previous := s.OSRepository.SelectGame("")
+	defer s.OSRepository.SelectGame(previous)
+	current, _ := s.GitRepository.GetCurrentBranch() // repository may have no commit yet
+	statuses := []GameStatus{}
+	for _, name := range names {
+		s.OSRepository.SelectGame(name)
+		status, err := s.gameStatus(name)
+		if err != nil {
+			return nil, err
+		}
+		status.CheckedOut = name == current
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *Service) gameStatus(gameName string) (GameStatus, error) {
+	status := GameStatus{Game: gameName, Save: SaveNotSaved}
+	if commit, err := s.GitRepository.LastCommit(gameName); err == nil {
+		status.SavedAt = &commit.Time
+		for _, line := range strings.Split(commit.Message, "\n") {
+			if strings.HasPrefix(line, machineTrailer) {
+				status.SavedOn = strings.TrimPrefix(line, machineTrailer)
+			}
+		}
+	}
+	ahead, behind, err := s.GitRepository.CompareRemote(gameName)
+	status.Ahead, status.Behind = ahead, behind
+	status.Remote, status.RemoteError = remoteState(ahead, behind, err)
+	if status.SavedAt == nil {
+		return status, nil
+	}
+	manifest, _, err := s.committedManifest(gameName)
+	if err == ErrManifestNotExist {
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	locations, err := s.saveLocations()
+	if err == ErrSavePathEmpty {
+		status.Save = SavePathNotSet
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	for _, location := range locations {
+		problems, err := s.checkManifest(manifest, location.RepoDir, location.Path, location.Filter)
+		if err != nil {
+			return status, err
+		}
+		status.ChangedFiles += len(problems)
+	}
+	status.Save = SaveUnchanged
+	if status.ChangedFiles > 0 {
+		status.Save = SaveModified
+	}
+	return status, nil
+}
+
+// remoteState describes result of CompareRemote as one of Remote
+// constants along with message of the error if remote is unknown
+func remoteState(ahead, behind int, err error) (string, string) {
+	switch {
+	case err == repository.ErrRemoteBranchNotExist:
+		return RemoteNotPushed, ""
+	case err != nil:
+		return RemoteUnknown, strings.TrimSpace(err.Error())
+	case ahead > 0 && behind > 0:
+		return RemoteDiverged, ""
+	case ahead > 0:
+		return RemoteAhead, ""
+	case behind > 0:
+		return RemoteBehind, ""
+	}
+	return RemoteUpToDate, ""
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestStatus(t *testing.T) {
+	t.Run("compare save folder against the last snapshot", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.commits, gitRepo.message = 1, "Update game\n\n"+machineTrailer+"deck"
+		statuses, err := service.Status("game")
+		assertNotError(t, err)
+		if len(statuses) != 1 || statuses[0].Save != SaveUnchanged || statuses[0].Remote != RemoteUpToDate {
+			t.Fatalf("Got %+v expect unchanged and up to date", statuses)
+		}
+		assertEqual(t, statuses[0].SavedOn, "deck")
+		if statuses[0].SavedAt == nil {
+			t.Error("Should report time of the last save")
+		}
+		service.OSRepository.(*OsRepositoryMock).writeFile(path.Join("game.save", "slot3"), "new")
+		statuses, _ = service.Status("game")
+		if statuses[0].Save != SaveModified || statuses[0].ChangedFiles != 1 {
+			t.Errorf("Got %+v expect one modified file", statuses[0])
+		}
+	})
+
+	t.Run("compare local branch against remote", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.commits = 1
+		remotes := []struct {
+			ahead, behind int
+			err           error
+			want          string
+		}{
+			{1, 0, nil, RemoteAhead},
+			{0, 2, nil, RemoteBehind},
+			{1, 2, nil, RemoteDiverged},
+			{0, 0, repository.ErrRemoteBranchNotExist, RemoteNotPushed},
+			{0, 0, errors.New("Could not resolve host"), RemoteUnknown},
+		}
+		for _, remote := range remotes {
+			gitRepo.ahead, gitRepo.behind, gitRepo.remoteErr = remote.ahead, remote.behind, remote.err
+			statuses, err := service.Status("game")
+			assertNotError(t, err)
+			assertEqual(t, statuses[0].Remote, remote.want)
+		}
+	})
+
+	t.Run("report every added game", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game2")
+		service.AddConfig("game_name", "game1")
+		statuses, err := service.Status("")
+		assertNotError(t, err)
+		if len(statuses) != 2 || statuses[0].Game != "game1" || statuses[1].Save != SaveNotSaved {
+			t.Errorf("Got %+v expect both games never saved", statuses)
+		}
+		assertEqual(t, getConfig(t, service.OSRepository, "game_name"), "game1")
+		service.Status("game2")
+		assertEqual(t, getConfig(t, service.OSRepository, "game_name"), "game1")
+	})
+
+	t.Run("record machine on save", func(t *testing.T) {
+		service := initService(t, gitOptionNormal)
+		service.AddConfig("game_name", "game")
+		assertEqual(t, service.generateCommitMessage("game"), "Update game\n\n"+machineTrailer+"desktop")
+	})
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// SyncUpToDate means save folder already matches the latest snapshot
+	SyncUpToDate = "up to date"
+	// SyncSaved means save folder has been saved as the latest snapshot
+	SyncSaved = "saved"
+	// SyncLoaded means the latest snapshot has been loaded into save folder
+	SyncLoaded = "loaded"
+
+	// syncStateFile is path of the last synced states inside BackupRoot
+	syncStateFile = "sync.json"
+)
+
+var (
+	// ErrSyncCanceled represents error if sync of both changed sides is not confirmed
+	ErrSyncCanceled = errors.New("Sync canceled")
+	// ErrSyncConflict represents error if both sides changed and confirmation can not be asked
+	ErrSyncConflict = errors.New("Save folder and snapshot both changed since the last sync, use save or load instead")
+)
+
+// syncState is the snapshot commit and the content of save folder
+// when a game was last synced on a machine
+type syncState struct {
+	Commit   string    `json:"commit"`
+	Content  string    `json:"content"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// syncStates holds syncState keyed by game name then by MachineID
+type syncStates map[string]map[string]syncState
+
+// Sync saves or loads the configured game, whichever of save folder
+// and the latest snapshot changed since the last sync on this machine.
+// If the game has not been synced on this machine, save folder is saved
+// if it is modified after the latest snapshot, otherwise it is loaded.
+// Confirmation is asked if both changed. The game branch should be
+// prepared by PrepareGame first
+func (s *Service) Sync() (string, error) {
+	gameName, err := s.gameName()
+	if err != nil {
+		return "", err
+	}
+	locations, err := s.saveLocations()
+	if err != nil {
+		return "", err
+	}
+	machine, err := s.OSRepository.MachineID()
+	if err != nil {
+		return "", err
+	}
+	states, err := s.readSyncStates()
+	if err != nil {
+		return "", err
+	}
+	action, err := s.syncAction(gameName, locations, states[gameName][machine])
+	if err != nil {
+		return "", err
+	}
+	switch action {
+	case SyncSaved:
+		err = s.SaveGame()
+	case SyncLoaded:
+		err = s.LoadGame(LoadOptions{})
+	}
+	if err != nil {
+		return "", err
+	}
+	commit, err := s.GitRepository.LastCommit(gameName)
+	if err != nil {
+		return "", err
+	}
+	content, _, err := s.folderState(locations)
+	if err != nil {
+		return "", err
+	}
+	if states[gameName] == nil {
+		states[gameName] = map[string]syncState{}
+	}
+	states[gameName][machine] = syncState{commit.Hash, content, time.Now().UTC()}
+	return action, s.writeSyncStates(states)
+}
+
+// syncAction decides whether Sync saves or loads the game by comparing
+// save folder and the latest snapshot against the last synced state
+func (s *Service) syncAction(gameName string, locations []SaveLocation, last syncState) (string, error) {
+	commit, err := s.GitRepository.LastCommit(gameName)
+	if err == repository.ErrBranchNotExist {
+		return SyncSaved, nil
+	} else if err != nil {
+		return "", err
+	}
+	manifest, _, err := s.committedManifest(gameName)
+	if err == ErrManifestNotExist {
+		manifest = repository.NewManifest()
+	} else if err != nil {
+		return "", err
+	}
+	diffs, err := s.compareSave(manifest, locations)
+	if err != nil || len(diffs) == 0 {
+		return SyncUpToDate, err
+	}
+	content, saveTime, err := s.folderState(locations)
+	if err != nil {
+		return "", err
+	}
+	newer := SyncLoaded
+	if saveTime.After(commit.Time) {
+		newer = SyncSaved
+	}
+	saveChanged := last.Content != content
+	snapshotChanged := last.Commit != commit.Hash
+	switch {
+	case last.Commit == "":
+		return newer, nil
+	case saveChanged && snapshotChanged:
+		if err = s.runHook(HookOnConflict, gameName, locations); err != nil {
+			return "", err
+		}
+		side := "snapshot is newer and will be loaded"
+		if newer == SyncSaved {
+			side = "save folder is newer and will be saved"
+		}
+		confirmed, err := s.OSRepository.Confirm(fmt.Sprintf(
+			"Save folder and snapshot both changed since the last sync, %s. Continue?", side,
+		))
+		if err != nil {
+			return "", ErrSyncConflict
+		}
+		if !confirmed {
+			return "", ErrSyncCanceled
+		}
+		return newer, nil
+	case snapshotChanged:
+		return SyncLoaded, nil
+	}
+	return SyncSaved, nil
+}
+
+// folderState returns checksum of content of every file in locations
+// along with the newest modification time among them
+func (s *Service) folderState(locations []SaveLocation) (string, time.Time, error) {
+	manifest := repository.NewManifest()
+	for _, location := range locations {
+		if !s.OSRepository.Exists(location.Path) {
+			continue
+		}
+		err := s.addToManifest(manifest, location.RepoDir, location.Path, location.Filter)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	hash := sha256.New()
+	var newest time.Time
+	for _, key := range manifestKeys(manifest) {
+		entry := manifest.Files[key]
+		fmt.Fprintf(hash, "%s\x00%s\n", key, entry.SHA256)
+		if entry.ModTime.After(newest) {
+			newest = entry.ModTime
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), newest, nil
+}
+
+// readSyncStates reads the last synced states kept in BackupRoot
+func (s *Service) readSyncStates() (syncStates, error) {
+	statePath := path.Join(repository.BackupRoot, syncStateFile)
+	states := syncStates{}
+	if !s.OSRepository.Exists(statePath) {
+		return states, nil
+	}
+	data, err := s.OSRepository.ReadFile(statePath)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &states)
+	return states, err
+}
+
+// writeSyncStates writes the last synced states into BackupRoot
+func (s *Service) writeSyncStates(states syncStates) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = s.OSRepository.MakeDir(repository.BackupRoot)
+	if err != nil {
+		return err
+	}
+	return s.OSRepository.WriteFile(path.Join(repository.BackupRoot, syncStateFile), data)
+}
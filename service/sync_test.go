@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	t.Run("save game never saved", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		action, err := service.Sync()
+		assertNotError(t, err)
+		assertEqual(t, action, SyncSaved)
+	})
+
+	t.Run("report error reading the latest snapshot", func(t *testing.T) {
+		service := initGameService(t, 2)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.lastCommitErr = errors.New("broken repository")
+		_, err := service.Sync()
+		if err != gitRepo.lastCommitErr || gitRepo.commits != 0 {
+			t.Errorf("Got %v after %d commits expect %v", err, gitRepo.commits, gitRepo.lastCommitErr)
+		}
+	})
+
+	t.Run("save folder changed since the last sync", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		syncSaved(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		service.OSRepository.(*OsRepositoryMock).writeFile(path.Join("game.save", "slot2"), "changed")
+		action, err := service.Sync()
+		assertNotError(t, err)
+		assertEqual(t, action, SyncSaved)
+		if gitRepo.commits != 2 {
+			t.Errorf("Got %d commits expect 2", gitRepo.commits)
+		}
+	})
+
+	t.Run("load snapshot changed since the last sync", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		syncSaved(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.commits++
+		addSnapshotFile(t, service, path.Join("game.save", "slot3"), "new")
+		addSnapshot(t, service, "game.save/slot3")
+		action, err := service.Sync()
+		assertNotError(t, err)
+		assertEqual(t, action, SyncLoaded)
+	})
+
+	t.Run("confirm if both sides changed since the last sync", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		syncSaved(t, service)
+		osRepo := service.OSRepository.(*OsRepositoryMock)
+		service.GitRepository.(*GitRepositoryMock).commits++
+		osRepo.writeFile(path.Join("game.save", "slot2"), "changed")
+		addSnapshot(t, service, "game.save/slot2")
+		_, err := service.Sync()
+		if err != ErrSyncCanceled || osRepo.confirmed != 1 {
+			t.Errorf("Got %v after %d confirmations expect %v", err, osRepo.confirmed, ErrSyncCanceled)
+		}
+		osRepo.confirm = true
+		action, err := service.Sync()
+		assertNotError(t, err)
+		assertEqual(t, action, SyncLoaded)
+	})
+
+	t.Run("record the last sync per machine", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		syncSaved(t, service)
+		states, err := service.readSyncStates()
+		assertNotError(t, err)
+		if states["game"]["desktop"].Commit != "1" {
+			t.Errorf("Got %+v expect state of desktop", states)
+		}
+	})
+}
+
+// syncSaved records the committed snapshot as the last sync
+// of this machine
+func syncSaved(t *testing.T, service *Service) {
+	t.Helper()
+	service.GitRepository.(*GitRepositoryMock).commits = 1
+	action, err := service.Sync()
+	if err != nil || action != SyncUpToDate {
+		t.Fatalf("[Helper-syncSaved] Got %s Error: %v", action, err)
+	}
+}
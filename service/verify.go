@@ -0,0 +1,391 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+const (
+	// ProblemMissing means file in manifest is not found
+	ProblemMissing = "missing"
+	// ProblemModified means file checksum differs from manifest
+	ProblemModified = "checksum mismatch"
+	// ProblemUnexpected means file is not listed in manifest
+	ProblemUnexpected = "not in manifest"
+)
+
+var (
+	// ErrManifestNotExist represents error if Game save has no checksum manifest
+	ErrManifestNotExist = errors.New("Checksum manifest of game save is not exist")
+	// ErrVerifyFailed represents error if save data does not match its manifest
+	ErrVerifyFailed = errors.New("Game save does not match the checksum manifest")
+)
+
+// FileProblem describes a file that does not match the manifest
+type FileProblem struct {
+	Path    string
+	Problem string
+}
+
+// VerifyReport is the result of comparing the committed snapshot
+// and the save folders against the checksum manifest
+type VerifyReport struct {
+	Game        string
+	Repo        []FileProblem
+	Save        []FileProblem
+	SaveChecked bool
+}
+
+// OK returns true if no problem was found
+func (r VerifyReport) OK() bool {
+	return len(r.Repo) == 0 && len(r.Save) == 0
+}
+
+// Verify compares the committed snapshot of game and its save locations
+// against the checksum manifest. Configured game is used if gameName
+// is empty, config of another game is selected while it is checked
+func (s *Service) Verify(gameName string) (VerifyReport, error) {
+	if gameName != "" {
+		previous := s.OSRepository.SelectGame(gameName)
+		defer s.OSRepository.SelectGame(previous)
+	}
+	gameName, err := s.configValue("game_name")
+	report := VerifyReport{Game: gameName}
+	if err != nil {
+		return report, err
+	}
+	if gameName == "" {
+		return report, ErrGameNameEmpty
+	}
+	manifest, cipher, err := s.committedManifest(gameName)
+	if err != nil {
+		return report, err
+	}
+	report.Repo, err = s.checkCommitted(gameName, manifest, cipher)
+	if err != nil {
+		return report, err
+	}
+	locations, err := s.saveLocations()
+	if err == ErrSavePathEmpty {
+		return report, nil
+	} else if err != nil {
+		return report, err
+	}
+	report.SaveChecked = true
+	report.Save = []FileProblem{}
+	for _, location := range locations {
+		problems, err := s.checkManifest(manifest, location.RepoDir, location.Path, location.Filter)
+		if err != nil {
+			return report, err
+		}
+		report.Save = append(report.Save, problems...)
+	}
+	return report, nil
+}
+
+// committedManifest reads the checksum manifest committed on branch
+// along with the cipher decrypting the snapshot, cipher is nil if the
+// snapshot is not encrypted. The cipher is returned along with
+// ErrManifestNotExist too
+func (s *Service) committedManifest(branch string) (repository.Manifest, *repository.Cipher, error) {
+	var cipher *repository.Cipher
+	if params, err := s.GitRepository.ShowFile(branch, repository.KeyFile); err == nil {
+		cipher, err = s.unlock(params)
+		if err != nil {
+			return repository.Manifest{}, nil, err
+		}
+	}
+	data, err := s.GitRepository.ShowFile(branch, repository.ManifestFile)
+	if err != nil {
+		return repository.Manifest{}, cipher, ErrManifestNotExist
+	}
+	if cipher != nil {
+		data, err = cipher.Open(data)
+		if err != nil {
+			return repository.Manifest{}, nil, err
+		}
+	}
+	manifest, err := repository.ParseManifest(data)
+	return manifest, cipher, err
+}
+
+// snapshotManifest reads the checksum manifest committed on rev like
+// committedManifest. Snapshot committed before manifests were recorded
+// gets the manifest built by hashing files of its tree instead, files
+// outside directories and archives are left out
+func (s *Service) snapshotManifest(rev string, tree []string) (repository.Manifest, *repository.Cipher, error) {
+	manifest, cipher, err := s.committedManifest(rev)
+	if err != ErrManifestNotExist {
+		return manifest, cipher, err
+	}
+	manifest = repository.NewManifest()
+	for _, file := range tree {
+		root := strings.SplitN(file, "/", 2)[0]
+		if root == file {
+			archived := strings.TrimSuffix(file, repository.ArchiveExt)
+			if archived == file {
+				continue
+			}
+			entries, err := s.archiveChecksums(rev, file, cipher)
+			if err != nil {
+				return manifest, cipher, err
+			}
+			for name, entry := range entries {
+				manifest.Files[path.Join(archived, name)] = entry
+			}
+			continue
+		}
+		key := file
+		if cipher != nil {
+			opened, err := cipher.OpenPath(strings.TrimPrefix(file, root))
+			if err != nil {
+				return manifest, cipher, fmt.Errorf("%s: %v", file, err)
+			}
+			key = root + opened
+		}
+		data, err := s.GitRepository.ShowFile(rev, file)
+		if err == nil && cipher != nil {
+			data, err = cipher.Open(data)
+		}
+		if err != nil {
+			return manifest, cipher, fmt.Errorf("%s: %v", file, err)
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files[key] = repository.ManifestEntry{
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   int64(len(data)),
+		}
+	}
+	return manifest, cipher, nil
+}
+
+// addToManifest hashes every file in dir and adds it to manifest
+// with path prefixed by prefix
+func (s *Service) addToManifest(manifest repository.Manifest, prefix, dir string, filter repository.TreeFilter) error {
+	entries, err := s.OSRepository.ListFiles(dir, filter)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		sum, err := s.OSRepository.HashFile(path.Join(dir, entry.Path))
+		if err != nil {
+			return err
+		}
+		manifest.Files[path.Join(prefix, entry.Path)] = repository.ManifestEntry{
+			SHA256:  sum,
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+		}
+	}
+	return nil
+}
+
+// checkCommitted compares files committed on branch against manifest,
+// only top level directories listed in manifest are checked. Save
+// location committed as archive is checked by the files inside it.
+// Committed files are decrypted by cipher if it is not nil
+func (s *Service) checkCommitted(branch string, manifest repository.Manifest, cipher *repository.Cipher) ([]FileProblem, error) {
+	files, err := s.GitRepository.ListTree(branch)
+	if err != nil {
+		return nil, err
+	}
+	roots := map[string]bool{}
+	for key := range manifest.Files {
+		roots[strings.SplitN(key, "/", 2)[0]] = true
+	}
+	committed := map[string]repository.ManifestEntry{}
+	stored := map[string]string{}
+	for _, file := range files {
+		root := strings.SplitN(file, "/", 2)[0]
+		archived := strings.TrimSuffix(file, repository.ArchiveExt)
+		if file != archived && roots[archived] {
+			entries, err := s.archiveChecksums(branch, file, cipher)
+			if err != nil {
+				return nil, err
+			}
+			for name, entry := range entries {
+				committed[path.Join(archived, name)] = entry
+			}
+		} else if roots[root] {
+			key := file
+			if cipher != nil {
+				if opened, err := cipher.OpenPath(strings.TrimPrefix(file, root)); err == nil {
+					key = root + opened
+				}
+			}
+			committed[key] = repository.ManifestEntry{}
+			stored[key] = file
+		}
+	}
+	problems := []FileProblem{}
+	for _, file := range sortedEntryKeys(committed) {
+		if _, listed := manifest.Files[file]; !listed {
+			problems = append(problems, FileProblem{file, ProblemUnexpected})
+		}
+	}
+	for _, key := range manifestKeys(manifest) {
+		entry, ok := committed[key]
+		if !ok {
+			problems = append(problems, FileProblem{key, ProblemMissing})
+			continue
+		}
+		if entry.SHA256 == "" {
+			data, err := s.GitRepository.ShowFile(branch, stored[key])
+			if err != nil {
+				return nil, err
+			}
+			if cipher != nil {
+				data, err = cipher.Open(data)
+			}
+			if err != nil {
+				problems = append(problems, FileProblem{key, ProblemModified})
+				continue
+			}
+			sum := sha256.Sum256(data)
+			entry.SHA256 = hex.EncodeToString(sum[:])
+		}
+		if entry.SHA256 != manifest.Files[key].SHA256 {
+			problems = append(problems, FileProblem{key, ProblemModified})
+		}
+	}
+	return problems, nil
+}
+
+// archiveChecksums returns checksum of every file inside archive committed
+// on branch, the archive is decrypted by cipher if it is not nil
+func (s *Service) archiveChecksums(branch, archive string, cipher *repository.Cipher) (map[string]repository.ManifestEntry, error) {
+	data, err := s.GitRepository.ShowFile(branch, archive)
+	if err != nil {
+		return nil, err
+	}
+	if cipher != nil {
+		data, err = cipher.Open(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repository.ArchiveChecksums(bytes.NewReader(data))
+}
+
+// checkManifest compares files in dir against manifest entries
+// whose path is prefixed by prefix, every entry is missing if
+// dir is not exist
+func (s *Service) checkManifest(manifest repository.Manifest, prefix, dir string, filter repository.TreeFilter) ([]FileProblem, error) {
+	entries := []repository.FileEntry{}
+	if s.OSRepository.Exists(dir) {
+		var err error
+		entries, err = s.OSRepository.ListFiles(dir, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	problems := []FileProblem{}
+	found := map[string]bool{}
+	for _, entry := range entries {
+		key := path.Join(prefix, entry.Path)
+		found[key] = true
+		want, ok := manifest.Files[key]
+		if !ok {
+			problems = append(problems, FileProblem{key, ProblemUnexpected})
+			continue
+		}
+		if entry.Size != want.Size {
+			problems = append(problems, FileProblem{key, ProblemModified})
+			continue
+		}
+		sum, err := s.OSRepository.HashFile(path.Join(dir, entry.Path))
+		if err != nil {
+			return nil, err
+		}
+		if sum != want.SHA256 {
+			problems = append(problems, FileProblem{key, ProblemModified})
+		}
+	}
+	for _, key := range manifestKeys(manifest) {
+		if strings.HasPrefix(key, prefix+"/") && !found[key] {
+			problems = append(problems, FileProblem{key, ProblemMissing})
+		}
+	}
+	return problems, nil
+}
+
+// readManifest reads manifest of the checked out snapshot decrypting
+// it by cipher if it is not nil, returns nil if the snapshot has no manifest
+func (s *Service) readManifest(cipher *repository.Cipher) (*repository.Manifest, error) {
+	manifestPath := path.Join(repository.GameSaveRoot, repository.ManifestFile)
+	if !s.OSRepository.Exists(manifestPath) {
+		return nil, nil
+	}
+	if cipher == nil {
+		manifest, err := s.OSRepository.ReadManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		return &manifest, nil
+	}
+	data, err := s.OSRepository.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	data, err = cipher.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := repository.ParseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// writeManifest writes manifest of the checked out snapshot
+// encrypting it by cipher if it is not nil
+func (s *Service) writeManifest(manifest repository.Manifest, cipher *repository.Cipher) error {
+	manifestPath := path.Join(repository.GameSaveRoot, repository.ManifestFile)
+	if cipher == nil {
+		return s.OSRepository.WriteManifest(manifestPath, manifest)
+	}
+	data, err := manifest.Encode()
+	if err != nil {
+		return err
+	}
+	return s.OSRepository.WriteFile(manifestPath, cipher.Seal(data))
+}
+
+// keepModTimes copies modification time of files whose content is
+// unchanged since previous manifest, so unchanged save data produces
+// identical manifest
+func keepModTimes(manifest repository.Manifest, previous *repository.Manifest) {
+	if previous == nil {
+		return
+	}
+	for key, entry := range manifest.Files {
+		old, ok := previous.Files[key]
+		if ok && old.SHA256 == entry.SHA256 && old.Size == entry.Size {
+			entry.ModTime = old.ModTime
+			manifest.Files[key] = entry
+		}
+	}
+}
+
+// manifestKeys returns sorted paths listed in manifest
+func manifestKeys(manifest repository.Manifest) []string {
+	return sortedEntryKeys(manifest.Files)
+}
+
+func sortedEntryKeys(entries map[string]repository.ManifestEntry) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yusufRahmatullah/game_save/repository"
+)
+
+func TestVerifyArchive(t *testing.T) {
+	t.Run("verify files inside committed archive", func(t *testing.T) {
+		service := initGameService(t, 2)
+		commitSnapshot(t, service)
+		gitRepo := service.GitRepository.(*GitRepositoryMock)
+		gitRepo.files["game.save"+repository.ArchiveExt] = packTestArchive(t, gitRepo.files)
+		delete(gitRepo.files, "game.save/slot1")
+		delete(gitRepo.files, "game.save/slot2")
+		report, err := service.Verify("")
+		assertNotError(t, err)
+		if len(report.Repo) != 0 {
+			t.Errorf("Should be OK, got %+v", report.Repo)
+		}
+		gitRepo.files["game.save/stray"] = []byte("stray")
+		report, _ = service.Verify("")
+		if len(report.Repo) != 1 || report.Repo[0].Problem != ProblemUnexpected {
+			t.Errorf("Should report unexpected file, got %+v", report.Repo)
+		}
+	})
+}
+
+// packTestArchive packs committed files of game.save into archive
+func packTestArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gamesave_archive")
+	if err != nil {
+		t.Fatalf("[Helper-packTestArchive] Error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "game.save"), 0755)
+	for _, name := range []string{"slot1", "slot2"} {
+		ioutil.WriteFile(filepath.Join(dir, "game.save", name), files["game.save/"+name], 0644)
+	}
+	rep := repository.OSRepository{}
+	archive := filepath.Join(dir, "save"+repository.ArchiveExt)
+	err = rep.PackArchive(filepath.Join(dir, "game.save"), archive, repository.TreeFilter{Links: repository.SymlinkPreserve})
+	if err != nil {
+		t.Fatalf("[Helper-packTestArchive] Error: %v", err)
+	}
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("[Helper-packTestArchive] Error: %v", err)
+	}
+	return data
+}